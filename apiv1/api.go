@@ -1,24 +1,26 @@
 package apiv1
 
 import (
-	json "encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
+	"net/url"
 
-	"github.com/ghodss/yaml"
 	"github.com/gorilla/mux"
 	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/fix"
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/outbound"
 	"github.com/italia/publiccode-validator/utils"
 	log "github.com/sirupsen/logrus"
 )
 
-var app utils.App
-
-// parse returns new parsed and validated buffer and errors if any
-func parse(b []byte) ([]byte, error, error) {
+// Parse returns new parsed and validated buffer, warnings and errors
+// if any. It's the same path used by Validate, exported for the
+// command line. Requests stop when ctx is done
+func Parse(ctx context.Context, b []byte, opts utils.Options) ([]byte, utils.ValidationErrors, error, error) {
 	url, err := utils.GetURLFromYMLBuffer(b)
 	if err != nil {
 		// this error should not be blocking because it just means
@@ -26,35 +28,139 @@ func parse(b []byte) ([]byte, error, error) {
 		// one case for that: partial validation during editing
 		log.Warnf("url not found in body (useful to get RemoteBaseURL): %s", err)
 	}
-	p := publiccode.NewParser()
-	p.DisableNetwork = app.DisableNetwork
+	bindCredential(url, &opts)
+	resolveRemoteBase(ctx, url, &opts)
+	return parse(ctx, b, url, opts)
+}
 
+// bindCredential binds the credential of the request, if any, to
+// the host of url, the repository of the document. The url is the
+// client's, so the credentials of the server are never used
+func bindCredential(url *url.URL, opts *utils.Options) {
 	if url != nil {
-		p.RemoteBaseURL = utils.GetRawURL(url)
+		opts.BindCredential(url.String())
 	}
-	log.Debugf("parse() called with disableNetwork: %v, and remoteBaseUrl: %s", p.DisableNetwork, p.RemoteBaseURL)
-	errParse := p.Parse(b)
-	pc, err := p.ToYAML()
+}
 
-	// hack to reset global vars to default values
-	app.DisableNetwork = false
-	return pc, errParse, err
+// parse validates b, whose repository is url, with the RemoteBaseURL
+// of opts already resolved by the caller. Like parseRemoteFile, it
+// doesn't start the fetches of the parser when ctx is already done
+func parse(ctx context.Context, b []byte, url *url.URL, opts utils.Options) ([]byte, utils.ValidationErrors, error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	p := newParser(b, url, opts)
+	log.Debugf("Parse() called with disableNetwork: %v, and remoteBaseUrl: %s", p.DisableNetwork, p.RemoteBaseURL)
+	warnings, errParse := checkWarnings(b, utils.NewValidationErrors(p.Parse(b), b), opts)
+	pc, err := toYAML(p, b, errParse, opts)
+
+	return pc, warnings, errParse, err
 }
 
-func parseRemoteURL(urlString string) ([]byte, error, error) {
-	log.Infof("called parseRemoteURL() url: %s", urlString)
-	p := publiccode.NewParser()
-	urlString, err := utils.GetRawFile(urlString)
+// ParseRemoteURL returns new parsed and validated buffer from a remote
+// file, warnings and errors if any. urlString is the URL of a file or
+// of a repository, see utils.ResolveRemoteFile. Requests stop when
+// ctx is done
+func ParseRemoteURL(ctx context.Context, urlString string, opts utils.Options) ([]byte, utils.ValidationErrors, error, error) {
+	log.Infof("called ParseRemoteURL() url: %s", urlString)
+	if err := outbound.Check(ctx, urlString); err != nil {
+		return nil, nil, nil, err
+	}
+	opts.BindRemoteCredential(urlString)
+	rawURL, checkout, err := utils.ResolveRemoteFile(ctx, urlString, opts.Ref, opts.Credential)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	errParse := p.ParseRemoteFile(urlString)
+	if checkout != nil && opts.RemoteBaseURL == "" {
+		opts.RemoteBaseURL = checkout.RawRoot
+	}
+	file, err := utils.FetchConditional(ctx, rawURL, "", "", opts.Credential)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return parseRemoteFile(ctx, file.Body, opts)
+}
+
+// parseRemoteFile validates b, the content of a remote file. The
+// fetches of the parser can't be stopped, so it doesn't start them
+// when ctx is already done
+func parseRemoteFile(ctx context.Context, b []byte, opts utils.Options) ([]byte, utils.ValidationErrors, error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	p := newParser(b, nil, opts)
+	warnings, errParse := checkWarnings(b, utils.NewValidationErrors(p.Parse(b), b), opts)
+	pc, err := toYAML(p, b, errParse, opts)
+
+	return pc, warnings, errParse, err
+}
+
+// toYAML returns the normalized document parsed by p. With the
+// preserve option the edits are applied to b, the submitted document,
+// when valid
+func toYAML(p *publiccode.Parser, b []byte, errParse error, opts utils.Options) ([]byte, error) {
 	pc, err := p.ToYAML()
+	if err != nil || errParse != nil || !opts.Preserve {
+		return pc, err
+	}
+	return fix.Preserve(b, pc)
+}
+
+// resolveRemoteBase sets the RemoteBaseURL of opts, if empty, to the
+// raw root of url, the repository of the document, at the ref option.
+// It's the only place resolving it, with the credential of the request.
+// Without network or on failures the parser falls back to master,
+// HEAD on self-hosted forges. It returns the resolved checkout, if any
+func resolveRemoteBase(ctx context.Context, url *url.URL, opts *utils.Options) *utils.Checkout {
+	if url == nil || opts.RemoteBaseURL != "" || opts.DisableNetwork {
+		return nil
+	}
+	checkout, err := utils.ResolveRef(ctx, url, opts.Ref, opts.Credential)
+	if err != nil {
+		log.Warnf("RemoteBaseURL not resolved: %v", err)
+		opts.RemoteBaseURL = utils.GetRawURL(url)
+		return nil
+	}
+	opts.RemoteBaseURL = checkout.RawRoot
+	return &checkout
+}
+
+// writeCheckout reports the ref and the commit validated
+func writeCheckout(w http.ResponseWriter, checkout *utils.Checkout) {
+	if checkout == nil {
+		return
+	}
+	w.Header().Set("Repository-Ref", checkout.Ref)
+	if checkout.Commit != "" {
+		w.Header().Set("Repository-Commit", checkout.Commit)
+	}
+}
 
-	return pc, errParse, err
+// newParser returns the parser for b. With the lenient option the
+// parser upgrades legacy keys, but it also ignores inputTypes and
+// outputTypes, so it's used only when b has legacy keys
+func newParser(b []byte, url *url.URL, opts utils.Options) *publiccode.Parser {
+	p := opts.NewParser(url)
+	p.Strict = !opts.Lenient || !utils.NewWarnings(b).HasCode(utils.CodeDeprecatedKey)
+	return p
 }
 
-func promptError(err error, w http.ResponseWriter, acceptHeader string,
+// checkWarnings returns the warnings of b, in strict mode
+// they are returned as errors together with errParse. Legacy keys
+// are warnings only with the lenient option, the parser refuses
+// them otherwise
+func checkWarnings(b []byte, errParse error, opts utils.Options) (utils.ValidationErrors, error) {
+	warnings := utils.NewWarnings(b)
+	if !opts.Lenient {
+		warnings = warnings.WithoutCode(utils.CodeDeprecatedKey)
+	}
+	if opts.Strict {
+		return nil, warnings.Promote(errParse)
+	}
+	return warnings, errParse
+}
+
+func promptError(err error, w http.ResponseWriter, f format,
 	httpStatus int, mess string) {
 
 	message := utils.Message{
@@ -66,39 +172,38 @@ func promptError(err error, w http.ResponseWriter, acceptHeader string,
 		message.Error = err.Error()
 	}
 
-	log.Debugf("promptError message: %v", message)
-	w.Header().Set("Content-type", acceptHeader)
-	w.WriteHeader(message.Status)
-
-	if acceptHeader == "application/json" {
-		o, _ := json.Marshal(message)
-		w.Write(o)
-	} else {
-		o, _ := yaml.Marshal(message)
-		w.Write(o)
-	}
+	writeMessage(w, f, message)
 }
 
-func elaborate(pc []byte, errParse error, errConverting error, w http.ResponseWriter, acceptHeader string) {
-	if errConverting != nil {
-		promptError(errConverting, w, acceptHeader, http.StatusBadRequest, "Error converting")
+// elaborate writes the normalized document when valid, with warnings
+// as Warning headers, or the message with errors and warnings. With
+// envelope valid documents are in the message too. Human reports are
+// written in both cases
+func elaborate(pc []byte, warnings utils.ValidationErrors, errParse error, errConverting error, envelope bool, w http.ResponseWriter, f format) {
+	utils.ObserveValidation(errParse, errConverting)
+	if errConverting != nil || errParse != nil {
+		writeMessage(w, f, toMessage(warnings, errParse, errConverting))
 		return
 	}
-	if errParse != nil {
-		promptError(errParse, w, acceptHeader, http.StatusUnprocessableEntity, "Validation Errors")
-		return
+
+	for _, warning := range i18n.LocalizeErrors(warnings, f.lang) {
+		w.Header().Add("Warning", fmt.Sprintf("299 - %q", warning.Error()))
 	}
 
-	// set response CT based on client accept header
-	// and return respectively content
-	if acceptHeader == "application/json" {
-		w.Header().Set("Content-type", "application/json")
-		w.Write(utils.Yaml2json(pc))
+	if envelope {
+		writeEnvelope(w, f, toMessage(warnings, nil, nil), pc)
 		return
 	}
-	// default choice
-	w.Header().Set("Content-type", "application/x-yaml")
-	w.Write(pc)
+	switch f.mediaType {
+	case mediaText, mediaHTML:
+		writeMessage(w, f, toMessage(warnings, nil, nil))
+	case mediaJSON:
+		w.Header().Set("Content-type", mediaJSON)
+		w.Write(utils.Yaml2json(pc))
+	default:
+		w.Header().Set("Content-type", contentType(f.mediaType))
+		w.Write(pc)
+	}
 }
 
 // ValidateRemoteURL validate remote URL
@@ -112,19 +217,26 @@ func ValidateRemoteURL(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	urlString := vars["url"]
 
-	acceptHeader := "application/x-yaml"
-	if r.Header.Get("Accept") != "*/*" {
-		acceptHeader = r.Header.Get("Accept")
+	f, ok := negotiate(w, r, documentTypes)
+	if !ok {
+		return
 	}
 	if urlString == "" {
-		promptError(errors.New("URL not found"), w, acceptHeader, http.StatusNotFound, "URL error")
+		promptError(errors.New("URL not found"), w, f, http.StatusNotFound, "URL error")
+		return
+	}
+	opts := utils.OptionsFromRequest(r)
+	if opts.Ref != "" && !utils.ValidRef(opts.Ref) {
+		promptError(fmt.Errorf("invalid ref %q", opts.Ref), w, f, http.StatusBadRequest, "Invalid ref")
 		return
 	}
 
 	// parsing
-	pc, errParse, errConverting := parseRemoteURL(urlString)
+	pc, warnings, errParse, errConverting, checkout, cacheStatus := parseRemoteURLCached(r.Context(), urlString, opts)
+	w.Header().Set("Cache-Status", cacheStatus)
+	writeCheckout(w, checkout)
 
-	elaborate(pc, errParse, errConverting, w, acceptHeader)
+	elaborate(pc, warnings, errParse, errConverting, opts.Envelope, w, f)
 }
 
 // ValidateParam will take a query parameter to enable
@@ -136,17 +248,8 @@ func ValidateParam(w http.ResponseWriter, r *http.Request) {
 	if (*r).Method == "OPTIONS" {
 		return
 	}
-	// Getting vars from parameters
-	vars := mux.Vars(r)
-	disableNetwork, err := strconv.ParseBool(vars["disableNetwork"])
-	app.DisableNetwork = disableNetwork
 
-	if err != nil {
-		app.DisableNetwork = false
-		log.Info("var disableNetwork not set, default to true")
-	}
-
-	Validate(w, r)
+	validate(w, r, utils.OptionsFromRequest(r))
 }
 
 // Validate returns a YML or JSON object validated and upgraded
@@ -159,13 +262,18 @@ func Validate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acceptHeader := "application/x-yaml"
-	if r.Header.Get("Accept") != "*/*" {
-		acceptHeader = r.Header.Get("Accept")
+	validate(w, r, utils.OptionsFromRequest(r))
+}
+
+// validate validates the request body using request scoped options
+func validate(w http.ResponseWriter, r *http.Request, opts utils.Options) {
+	f, ok := negotiate(w, r, documentTypes)
+	if !ok {
+		return
 	}
 
 	if r.Body == nil {
-		promptError(fmt.Errorf("empty payload"), w, acceptHeader, http.StatusBadRequest, "Empty payload")
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
 		return
 	}
 
@@ -175,11 +283,13 @@ func Validate(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 
 	if err != nil {
-		promptError(err, w, acceptHeader, http.StatusBadRequest, "Error reading body")
+		status, mess := utils.ReadBodyError(err)
+		promptError(err, w, f, status, mess)
+		return
 	}
 
 	if len(body) == 0 {
-		promptError(fmt.Errorf("empty payload"), w, acceptHeader, http.StatusBadRequest, "Empty payload")
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
 		return
 	}
 
@@ -190,8 +300,17 @@ func Validate(w http.ResponseWriter, r *http.Request) {
 	// here, based on content-type header must convert
 	// [yaml/json] content into []byte
 
+	if opts.Ref != "" && !utils.ValidRef(opts.Ref) {
+		promptError(fmt.Errorf("invalid ref %q", opts.Ref), w, f, http.StatusBadRequest, "Invalid ref")
+		return
+	}
+	// nil when the document has no url
+	repoURL, _ := utils.GetURLFromYMLBuffer(body)
+	bindCredential(repoURL, &opts)
+	writeCheckout(w, resolveRemoteBase(r.Context(), repoURL, &opts))
+
 	// parsing
-	pc, errParse, errConverting := parse(body)
+	pc, warnings, errParse, errConverting := parse(r.Context(), body, repoURL, opts)
 
-	elaborate(pc, errParse, errConverting, w, acceptHeader)
+	elaborate(pc, warnings, errParse, errConverting, opts.Envelope, w, f)
 }
@@ -0,0 +1,214 @@
+package apiv1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/outbound"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// batchItem is a single document of a batch request
+type batchItem struct {
+	id  string
+	doc []byte
+}
+
+// documentSeparator splits a multi-document YAML stream
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?$`)
+
+// ValidateBatch validates many documents in one call.
+// The body is a JSON array or a multi-document YAML stream, each
+// item is either a publiccode document or an object with an
+// optional id and the document under the document key
+func ValidateBatch(w http.ResponseWriter, r *http.Request) {
+	log.Info("/api/v1/validate/batch")
+	utils.SetupResponse(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	f, ok := negotiate(w, r, dataTypes)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
+		return
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		status, mess := utils.ReadBodyError(err)
+		promptError(err, w, f, status, mess)
+		return
+	}
+
+	items, err := splitBatch(body)
+	if err != nil {
+		promptError(err, w, f, http.StatusBadRequest, "Error reading batch")
+		return
+	}
+	if len(items) == 0 {
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
+		return
+	}
+
+	opts := utils.OptionsFromRequest(r)
+	// a credential can't be bound to the hosts of many repositories
+	opts.Credential = nil
+	results := validateBatch(r.Context(), items, opts, utils.Settings().BatchWorkers)
+	for i := range results {
+		results[i].Message = i18n.Localize(results[i].Message, f.lang)
+	}
+
+	writeData(w, f, http.StatusOK, results)
+}
+
+// validateBatch validates items with a pool of workers,
+// results keep the same order of items. Items left when ctx
+// is done are not validated
+func validateBatch(ctx context.Context, items []batchItem, opts utils.Options, workers int) []utils.BatchResult {
+	results := make([]utils.BatchResult, len(items))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for n := 0; n < workers && n < len(items); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				pc, warnings, errParse, errConverting := Parse(ctx, items[i].doc, opts)
+				utils.ObserveValidation(errParse, errConverting)
+				results[i] = utils.BatchResult{
+					Index:   i,
+					ID:      items[i].id,
+					Message: toMessage(warnings, errParse, errConverting),
+				}
+				if results[i].Status == http.StatusOK {
+					results[i].Normalized = utils.Yaml2json(pc)
+				}
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// toMessage returns the same outcome of elaborate as a message,
+// 403 for URLs refused by the outbound policy
+func toMessage(warnings utils.ValidationErrors, errParse error, errConverting error) utils.Message {
+	if _, ok := outbound.Refused(errConverting); ok {
+		return utils.Message{Status: http.StatusForbidden, Message: "URL refused", Error: errConverting.Error()}
+	}
+	if errConverting != nil {
+		return utils.Message{Status: http.StatusBadRequest, Message: "Error converting", Error: errConverting.Error()}
+	}
+	if errParse != nil {
+		message := utils.Message{
+			Status:          http.StatusUnprocessableEntity,
+			Message:         "Validation Errors",
+			ValidationError: utils.ErrorsToValidationErrors(errParse),
+			Warnings:        warnings,
+		}
+		if message.ValidationError == nil {
+			message.Error = errParse.Error()
+		}
+		return message
+	}
+	return utils.Message{Status: http.StatusOK, Message: "Valid", Warnings: warnings}
+}
+
+// splitBatch returns the documents of a JSON array
+// or of a multi-document YAML stream
+func splitBatch(body []byte) ([]batchItem, error) {
+	var items []batchItem
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, err
+		}
+		for _, raw := range raws {
+			items = append(items, jsonBatchItem(raw))
+		}
+		return items, nil
+	}
+
+	for _, doc := range documentSeparator.Split(string(body), -1) {
+		var m map[interface{}]interface{}
+		if err := yamlv2.Unmarshal([]byte(doc), &m); err != nil {
+			// let the parser report syntax errors of the single document
+			items = append(items, batchItem{doc: []byte(doc)})
+			continue
+		}
+		if len(m) == 0 {
+			continue
+		}
+		item, err := yamlBatchItem(m, []byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func jsonBatchItem(raw json.RawMessage) batchItem {
+	var wrapper struct {
+		ID       interface{}     `json:"id"`
+		Document json.RawMessage `json:"document"`
+	}
+	if err := json.Unmarshal(raw, &wrapper); err != nil || wrapper.Document == nil {
+		// not a wrapper, JSON is valid YAML for the parser
+		return batchItem{doc: raw}
+	}
+
+	item := batchItem{doc: wrapper.Document}
+	if wrapper.ID != nil {
+		item.id = fmt.Sprintf("%v", wrapper.ID)
+	}
+	// document as a YAML string
+	var s string
+	if json.Unmarshal(wrapper.Document, &s) == nil {
+		item.doc = []byte(s)
+	}
+	return item
+}
+
+func yamlBatchItem(m map[interface{}]interface{}, doc []byte) (batchItem, error) {
+	document, ok := m["document"]
+	if !ok {
+		return batchItem{doc: doc}, nil
+	}
+
+	item := batchItem{}
+	if id, ok := m["id"]; ok {
+		item.id = fmt.Sprintf("%v", id)
+	}
+	if s, ok := document.(string); ok {
+		item.doc = []byte(s)
+		return item, nil
+	}
+	b, err := yamlv2.Marshal(document)
+	if err != nil {
+		return item, err
+	}
+	item.doc = b
+	return item, nil
+}
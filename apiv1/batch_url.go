@@ -0,0 +1,254 @@
+package apiv1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// hostLimiter bounds the number of concurrent fetches per host
+type hostLimiter struct {
+	mu      sync.Mutex
+	perHost int
+	hosts   map[string]chan struct{}
+}
+
+func newHostLimiter(perHost int) *hostLimiter {
+	return &hostLimiter{perHost: perHost, hosts: make(map[string]chan struct{})}
+}
+
+var limiter struct {
+	once sync.Once
+	l    *hostLimiter
+}
+
+// hostLimits returns the limiter shared by all the batches, so that
+// the limit of the server settings applies to every host as a whole
+func hostLimits() *hostLimiter {
+	limiter.once.Do(func() {
+		limiter.l = newHostLimiter(utils.Settings().BatchPerHost)
+	})
+	return limiter.l
+}
+
+// acquire blocks until a slot for every one of hosts is free and
+// returns the function to release them, false if ctx is done first.
+// hosts are sorted, so that slots are always taken in the same order
+func (l *hostLimiter) acquire(ctx context.Context, hosts []string) (func(), bool) {
+	var taken []chan struct{}
+	release := func() {
+		for _, sem := range taken {
+			<-sem
+		}
+	}
+	for _, host := range hosts {
+		l.mu.Lock()
+		sem, ok := l.hosts[host]
+		if !ok {
+			sem = make(chan struct{}, l.perHost)
+			l.hosts[host] = sem
+		}
+		l.mu.Unlock()
+
+		select {
+		case sem <- struct{}{}:
+			taken = append(taken, sem)
+		case <-ctx.Done():
+			release()
+			return nil, false
+		}
+	}
+	return release, true
+}
+
+// ValidateRemoteURLBatch validates a list of repository or raw file
+// URLs, sent as a JSON array of strings or as text with one URL per line.
+// Results are streamed as NDJSON in completion order, as soon as
+// every URL is validated. The write timeout of the server applies to
+// every result instead of the whole stream, and the batch stops when
+// the client goes away
+func ValidateRemoteURLBatch(w http.ResponseWriter, r *http.Request) {
+	log.Info("/api/v1/validateURL/batch")
+	utils.SetupResponse(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	f, ok := negotiate(w, r, streamTypes)
+	if !ok {
+		return
+	}
+	if f.mediaType == "application/x-ndjson" {
+		f.mediaType = mediaJSON
+	}
+
+	if r.Body == nil {
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
+		return
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		status, mess := utils.ReadBodyError(err)
+		promptError(err, w, f, status, mess)
+		return
+	}
+
+	urls, err := splitURLs(body)
+	if err != nil {
+		promptError(err, w, f, http.StatusBadRequest, "Error reading batch")
+		return
+	}
+	if len(urls) == 0 {
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
+		return
+	}
+
+	opts := utils.OptionsFromRequest(r)
+	if opts.Ref != "" && !utils.ValidRef(opts.Ref) {
+		promptError(fmt.Errorf("invalid ref %q", opts.Ref), w, f, http.StatusBadRequest, "Invalid ref")
+		return
+	}
+	// a credential can't be bound to the hosts of many repositories
+	opts.Credential = nil
+
+	settings := utils.Settings()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	results := make(chan utils.BatchResult)
+	go func() {
+		validateURLs(ctx, urls, opts, settings.BatchWorkers, results)
+		close(results)
+	}()
+
+	// the stream lasts as long as the batch
+	extendDeadline := func() {
+		if settings.WriteTimeout > 0 {
+			utils.SetWriteDeadline(r, time.Now().Add(settings.WriteTimeout))
+		}
+	}
+	defer extendDeadline()
+
+	w.Header().Set("Content-type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	var errWrite error
+	for res := range results {
+		if errWrite != nil {
+			continue
+		}
+		res.Message = i18n.Localize(res.Message, f.lang)
+		extendDeadline()
+		if errWrite = encoder.Encode(res); errWrite != nil {
+			log.Infof("validateURL/batch stopped: %v", errWrite)
+			cancel()
+			continue
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// validateURLs fetches and validates urls with a pool of workers,
+// within the limits of hostLimits, sending every result as soon as
+// it's ready. It stops when ctx is done
+func validateURLs(ctx context.Context, urls []string, opts utils.Options, workers int, results chan<- utils.BatchResult) {
+	limiter := hostLimits()
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for n := 0; n < workers && n < len(urls); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res, ok := validateURL(ctx, i, urls[i], opts, limiter)
+				if !ok {
+					continue
+				}
+				select {
+				case results <- res:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+loop:
+	for i := range urls {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			log.Infof("validateURLs() stopped after %d of %d urls: %v", i, len(urls), ctx.Err())
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// validateURL returns the result of urlString, false if ctx is done
+// before its turn
+func validateURL(ctx context.Context, i int, urlString string, opts utils.Options, limiter *hostLimiter) (utils.BatchResult, bool) {
+	res := utils.BatchResult{Index: i, URL: urlString}
+
+	u, err := url.Parse(urlString)
+	if err != nil || u.Host == "" {
+		res.Message = utils.Message{Status: http.StatusBadRequest, Message: "URL error", Error: "URL is not valid"}
+		return res, true
+	}
+
+	// limits are on the hosts requests go to, like the API and the
+	// raw files of GitHub, not on the one of urlString
+	release, ok := limiter.acquire(ctx, utils.RemoteHosts(urlString))
+	if !ok {
+		return res, false
+	}
+	pc, warnings, errParse, errConverting, checkout, _ := parseRemoteURLCached(ctx, urlString, opts)
+	release()
+	res.Checkout = checkout
+	utils.ObserveValidation(errParse, errConverting)
+
+	res.Message = toMessage(warnings, errParse, errConverting)
+	if res.Status == http.StatusOK {
+		res.Normalized = utils.Yaml2json(pc)
+	}
+	return res, true
+}
+
+// splitURLs returns the URLs of a JSON array of strings
+// or of a text with one URL per line
+func splitURLs(body []byte) ([]string, error) {
+	var urls []string
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &urls); err != nil {
+			return nil, err
+		}
+		return urls, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
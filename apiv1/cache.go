@@ -0,0 +1,344 @@
+package apiv1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/italia/publiccode-validator/cache"
+	"github.com/italia/publiccode-validator/outbound"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheName identifies the cache in Cache-Status headers (RFC 9211)
+const cacheName = "publiccode-validator"
+
+// remoteResult is the cached outcome of the validation of a remote file
+type remoteResult struct {
+	PC            []byte                 `json:"pc,omitempty"`
+	Warnings      utils.ValidationErrors `json:"warnings,omitempty"`
+	Errors        utils.ValidationErrors `json:"errors,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	ErrConverting string                 `json:"errConverting,omitempty"`
+}
+
+func newRemoteResult(pc []byte, warnings utils.ValidationErrors, errParse error, errConverting error) remoteResult {
+	res := remoteResult{PC: pc, Warnings: warnings}
+	if errs, ok := errParse.(utils.ValidationErrors); ok {
+		res.Errors = errs
+	} else if errParse != nil {
+		res.Error = errParse.Error()
+	}
+	if errConverting != nil {
+		res.ErrConverting = errConverting.Error()
+	}
+	return res
+}
+
+func (res remoteResult) unpack() ([]byte, utils.ValidationErrors, error, error) {
+	var errParse, errConverting error
+	if len(res.Errors) > 0 {
+		errParse = res.Errors
+	} else if res.Error != "" {
+		errParse = errors.New(res.Error)
+	}
+	if res.ErrConverting != "" {
+		errConverting = errors.New(res.ErrConverting)
+	}
+	return res.PC, res.Warnings, errParse, errConverting
+}
+
+// remoteResults are the results of the variants of a remote file,
+// see variant
+type remoteResults map[string]remoteResult
+
+var remote struct {
+	once     sync.Once
+	store    cache.Store
+	resolved cache.Store
+}
+
+// remoteCache returns the store of remote results set by
+// the server settings, nil if the cache is disabled
+func remoteCache() cache.Store {
+	remote.once.Do(func() {
+		settings := utils.Settings()
+		if settings.CacheSize <= 0 {
+			return
+		}
+		// resolutions are cheap to redo, they are kept only in memory
+		remote.resolved = cache.NewLRU(settings.CacheSize)
+		if settings.CacheDir != "" {
+			store, err := cache.NewDisk(settings.CacheDir, settings.CacheSize)
+			if err != nil {
+				log.Errorf("cache disabled: %v", err)
+				return
+			}
+			remote.store = store
+		} else {
+			remote.store = cache.NewLRU(settings.CacheSize)
+		}
+	})
+	return remote.store
+}
+
+// cacheKey identifies the results of rawURL, the file fetched, at the
+// commit of checkout, if any. Results fetched with the credential of
+// the request are kept apart, by hash of the credential
+func cacheKey(rawURL string, checkout *utils.Checkout, opts utils.Options) string {
+	key := rawURL
+	if checkout != nil {
+		key += " commit=" + checkout.Commit
+	}
+	return key + credentialKey(opts)
+}
+
+// credentialKey is the part of the keys of the credential of the request
+func credentialKey(opts utils.Options) string {
+	if c := opts.Credential; c != nil {
+		return fmt.Sprintf(" credential=%x", sha256.Sum256([]byte(c.Host+" "+c.Authorization())))
+	}
+	return ""
+}
+
+// resolution is the raw file and the checkout of a remote URL at a ref
+type resolution struct {
+	RawURL   string          `json:"rawURL"`
+	Checkout *utils.Checkout `json:"checkout,omitempty"`
+	RawRoot  string          `json:"rawRoot,omitempty"`
+}
+
+// resolveRemoteFile is utils.ResolveRemoteFile, with the resolutions
+// kept in resolved for the TTL of the cache, so that fresh results are
+// served without asking the API of the platform. Without resolved,
+// when the cache is bypassed, the URL is always resolved
+func resolveRemoteFile(ctx context.Context, resolved cache.Store, urlString string, opts utils.Options) (string, *utils.Checkout, error) {
+	if resolved == nil {
+		return utils.ResolveRemoteFile(ctx, urlString, opts.Ref, opts.Credential)
+	}
+
+	key := urlString + " ref=" + opts.Ref + credentialKey(opts)
+	var res resolution
+	if entry, ok := resolved.Get(key); ok && time.Since(entry.Stored) < utils.Settings().CacheTTL &&
+		json.Unmarshal(entry.Value, &res) == nil {
+		if res.Checkout != nil {
+			res.Checkout.RawRoot = res.RawRoot
+		}
+		return res.RawURL, res.Checkout, nil
+	}
+
+	rawURL, checkout, err := utils.ResolveRemoteFile(ctx, urlString, opts.Ref, opts.Credential)
+	if err != nil {
+		return rawURL, checkout, err
+	}
+	res = resolution{RawURL: rawURL, Checkout: checkout}
+	if checkout != nil {
+		res.RawRoot = checkout.RawRoot
+	}
+	if value, err := json.Marshal(res); err == nil {
+		resolved.Set(key, cache.Entry{Value: value, Stored: time.Now()})
+	}
+	return rawURL, checkout, nil
+}
+
+// keyLocks serializes the updates of every key of the store,
+// so that concurrent variants don't drop each other
+var keyLocks = struct {
+	sync.Mutex
+	locks map[string]*keyLock
+}{locks: make(map[string]*keyLock)}
+
+type keyLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockKey locks key and returns the function to unlock it
+func lockKey(key string) func() {
+	keyLocks.Lock()
+	l, ok := keyLocks.locks[key]
+	if !ok {
+		l = &keyLock{}
+		keyLocks.locks[key] = l
+	}
+	l.users++
+	keyLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		keyLocks.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(keyLocks.locks, key)
+		}
+		keyLocks.Unlock()
+	}
+}
+
+// revalidate marks the entry of key as fresh, with the validators
+// of file, if it's still the one revalidated, stored with etag
+// and lastModified
+func revalidate(store cache.Store, key string, etag string, lastModified string, file utils.RemoteFile) {
+	unlock := lockKey(key)
+	defer unlock()
+	entry, found := store.Get(key)
+	if !found || entry.ETag != etag || entry.LastModified != lastModified {
+		// replaced in the meantime
+		return
+	}
+	entry.Stored = time.Now()
+	if file.ETag != "" {
+		entry.ETag = file.ETag
+	}
+	if file.LastModified != "" {
+		entry.LastModified = file.LastModified
+	}
+	store.Set(key, entry)
+}
+
+// storeResult adds res, the result of the variant v of file, to the
+// entry of key. Results of other variants are kept if they are of
+// the same file
+func storeResult(store cache.Store, key string, v string, file utils.RemoteFile, res remoteResult) error {
+	unlock := lockKey(key)
+	defer unlock()
+	var results remoteResults
+	if entry, found := store.Get(key); !found || !sameFile(entry, file) ||
+		json.Unmarshal(entry.Value, &results) != nil || results == nil {
+		// results of other variants are of a previous version
+		results = remoteResults{}
+	}
+	results[v] = res
+	value, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	store.Set(key, cache.Entry{
+		Value:        value,
+		ETag:         file.ETag,
+		LastModified: file.LastModified,
+		Digest:       digest(file.Body),
+		Stored:       time.Now(),
+	})
+	return nil
+}
+
+// variant identifies the results of the options changing the
+// outcome, kept in the same entry
+func variant(opts utils.Options) string {
+	return fmt.Sprintf("disableNetwork=%t strict=%t lenient=%t preserve=%t", opts.DisableNetwork, opts.Strict, opts.Lenient, opts.Preserve)
+}
+
+// parseRemoteURLCached is ParseRemoteURL using the cache of results.
+// Fresh results are returned as they are, stale ones are revalidated
+// with a conditional request. Results with the remoteBaseURL of the
+// client are not cached. Requests stop when ctx is done. It also
+// returns the checkout validated, nil for file URLs without ref,
+// and the Cache-Status
+func parseRemoteURLCached(ctx context.Context, urlString string, opts utils.Options) ([]byte, utils.ValidationErrors, error, error, *utils.Checkout, string) {
+	opts.BindRemoteCredential(urlString)
+	store := remoteCache()
+	if opts.ServerCredential || opts.RemoteBaseURL != "" {
+		// results fetched with the credential of the server are never
+		// stored, nor served to other clients. The remoteBaseURL of
+		// clients would let them fill the cache with any key
+		store = nil
+	}
+	fwd := "uri-miss"
+	if store == nil {
+		fwd = "bypass"
+	}
+
+	if err := outbound.Check(ctx, urlString); err != nil {
+		return nil, nil, nil, err, nil, fmt.Sprintf("%s; fwd=%s", cacheName, fwd)
+	}
+	var resolved cache.Store
+	if store != nil {
+		resolved = remote.resolved
+	}
+	rawURL, checkout, err := resolveRemoteFile(ctx, resolved, urlString, opts)
+	if err != nil {
+		return nil, nil, nil, err, nil, fmt.Sprintf("%s; fwd=%s", cacheName, fwd)
+	}
+	if checkout != nil && opts.RemoteBaseURL == "" {
+		opts.RemoteBaseURL = checkout.RawRoot
+	}
+	if store == nil {
+		file, err := utils.FetchConditional(ctx, rawURL, "", "", opts.Credential)
+		if err != nil {
+			return nil, nil, nil, err, checkout, cacheName + "; fwd=bypass"
+		}
+		pc, warnings, errParse, errConverting := parseRemoteFile(ctx, file.Body, opts)
+		return pc, warnings, errParse, errConverting, checkout, cacheName + "; fwd=bypass"
+	}
+
+	key := cacheKey(rawURL, checkout, opts)
+	v := variant(opts)
+	entry, found := store.Get(key)
+	var results remoteResults
+	if found && json.Unmarshal(entry.Value, &results) != nil {
+		// unreadable entry, fetch it again
+		found, results = false, nil
+	}
+
+	var etag, lastModified string
+	if found {
+		res, ok := results[v]
+		ttl := utils.Settings().CacheTTL
+		age := time.Since(entry.Stored)
+		switch {
+		case ok && age < ttl:
+			pc, warnings, errParse, errConverting := res.unpack()
+			return pc, warnings, errParse, errConverting, checkout, fmt.Sprintf("%s; hit; ttl=%d", cacheName, int((ttl - age).Seconds()))
+		case ok:
+			fwd = "stale"
+			etag, lastModified = entry.ETag, entry.LastModified
+		default:
+			// the file is cached, not with these options
+			fwd = "vary-miss"
+		}
+	}
+
+	log.Infof("fetching %s, cache %s", rawURL, fwd)
+	file, err := utils.FetchConditional(ctx, rawURL, etag, lastModified, opts.Credential)
+	if err != nil {
+		return nil, nil, nil, err, checkout, fmt.Sprintf("%s; fwd=%s", cacheName, fwd)
+	}
+
+	if file.NotModified {
+		revalidate(store, key, etag, lastModified, file)
+		pc, warnings, errParse, errConverting := results[v].unpack()
+		return pc, warnings, errParse, errConverting, checkout, fmt.Sprintf("%s; fwd=stale; fwd-status=304; stored", cacheName)
+	}
+
+	if err := ctx.Err(); err != nil {
+		// not parsed, nothing to store
+		return nil, nil, nil, err, checkout, fmt.Sprintf("%s; fwd=%s; fwd-status=200", cacheName, fwd)
+	}
+	pc, warnings, errParse, errConverting := parseRemoteFile(ctx, file.Body, opts)
+	if err := storeResult(store, key, v, file, newRemoteResult(pc, warnings, errParse, errConverting)); err != nil {
+		log.Errorf("cache: %v", err)
+		return pc, warnings, errParse, errConverting, checkout, fmt.Sprintf("%s; fwd=%s; fwd-status=200", cacheName, fwd)
+	}
+	return pc, warnings, errParse, errConverting, checkout, fmt.Sprintf("%s; fwd=%s; fwd-status=200; stored", cacheName, fwd)
+}
+
+// sameFile tells whether file is the one of entry, by its validators
+// or, when the host sends none, by the digest of its content
+func sameFile(entry cache.Entry, file utils.RemoteFile) bool {
+	if file.ETag == "" && file.LastModified == "" {
+		return entry.Digest != "" && entry.Digest == digest(file.Body)
+	}
+	return entry.ETag == file.ETag && entry.LastModified == file.LastModified
+}
+
+// digest returns the digest of the content of a file
+func digest(body []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+}
@@ -0,0 +1,100 @@
+package apiv1
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ghodss/yaml"
+	"github.com/italia/publiccode-validator/diff"
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const mediaDiff = "text/x-diff"
+
+// diffTypes are the media types of Diff, text/x-diff
+// is the unified diff alone
+var diffTypes = append(append([]string{}, dataTypes...), mediaDiff)
+
+// diffResult is the response of Diff: the validation of the
+// submitted document, the normalized one and how they differ
+type diffResult struct {
+	utils.Message
+	// Normalized is the document returned by validate
+	Normalized string        `json:"normalized"`
+	Changes    []diff.Change `json:"changes"`
+	// Unified is the unified diff from the submitted document,
+	// in YAML, to the normalized one
+	Unified string `json:"unified"`
+}
+
+// Diff validates the request body like Validate and returns how the
+// normalized document differs from it, both by key and as unified diff
+func Diff(w http.ResponseWriter, r *http.Request) {
+	log.Info("/api/v1/diff")
+	utils.SetupResponse(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	f, ok := negotiate(w, r, diffTypes)
+	if !ok {
+		return
+	}
+	errFormat := f
+	if f.mediaType == mediaDiff {
+		errFormat.mediaType = mediaJSON
+	}
+
+	if r.Body == nil {
+		promptError(fmt.Errorf("empty payload"), w, errFormat, http.StatusBadRequest, "Empty payload")
+		return
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		status, mess := utils.ReadBodyError(err)
+		promptError(err, w, errFormat, status, mess)
+		return
+	}
+	if len(body) == 0 {
+		promptError(fmt.Errorf("empty payload"), w, errFormat, http.StatusBadRequest, "Empty payload")
+		return
+	}
+
+	pc, warnings, errParse, errConverting := Parse(r.Context(), body, utils.OptionsFromRequest(r))
+	utils.ObserveValidation(errParse, errConverting)
+	if errConverting != nil {
+		writeMessage(w, errFormat, toMessage(warnings, errParse, errConverting))
+		return
+	}
+	changes, err := diff.Compare(body, pc)
+	if err != nil {
+		promptError(err, w, errFormat, http.StatusUnprocessableEntity, "Error comparing")
+		return
+	}
+
+	// JSON documents are compared line by line as YAML
+	submitted := body
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		if submitted, err = yaml.JSONToYAML(trimmed); err != nil {
+			submitted = body
+		}
+	}
+	unified := diff.Unified("submitted", submitted, "normalized", pc)
+
+	if f.mediaType == mediaDiff {
+		w.Header().Set("Content-type", contentType(mediaDiff))
+		w.Write([]byte(unified))
+		return
+	}
+	writeData(w, f, http.StatusOK, diffResult{
+		Message:    i18n.Localize(toMessage(warnings, errParse, nil), f.lang),
+		Normalized: string(pc),
+		Changes:    changes,
+		Unified:    unified,
+	})
+}
@@ -0,0 +1,72 @@
+package apiv1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/italia/publiccode-validator/fix"
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// fixResult is the response of Fix: the validation of the fixed
+// document, the document itself and how it was fixed
+type fixResult struct {
+	utils.Message
+	// Fixed is the fixed document in YAML
+	Fixed string          `json:"fixed"`
+	Fixes []fix.Fix       `json:"fixes"`
+	Patch []fix.Operation `json:"patch"`
+}
+
+// Fix applies safe automatic corrections to the request body and
+// validates the result. Issues that can't be fixed are left in
+// validationErrors, the patch turns the body into the fixed document
+func Fix(w http.ResponseWriter, r *http.Request) {
+	log.Info("/api/v1/fix")
+	utils.SetupResponse(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	f, ok := negotiate(w, r, dataTypes)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
+		return
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		status, mess := utils.ReadBodyError(err)
+		promptError(err, w, f, status, mess)
+		return
+	}
+	if len(body) == 0 {
+		promptError(fmt.Errorf("empty payload"), w, f, http.StatusBadRequest, "Empty payload")
+		return
+	}
+
+	fixed, err := fix.Apply(body)
+	if err != nil {
+		promptError(err, w, f, http.StatusUnprocessableEntity, "Error fixing")
+		return
+	}
+
+	_, warnings, errParse, errConverting := Parse(r.Context(), fixed.Document, utils.OptionsFromRequest(r))
+	utils.ObserveValidation(errParse, errConverting)
+
+	// the status is the one of the validation of the fixed document
+	message := i18n.Localize(toMessage(warnings, errParse, errConverting), f.lang)
+	writeData(w, f, message.Status, fixResult{
+		Message: message,
+		Fixed:   string(fixed.Document),
+		Fixes:   fixed.Fixes,
+		Patch:   fixed.Patch,
+	})
+}
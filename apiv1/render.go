@@ -0,0 +1,124 @@
+package apiv1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// media types of v1 responses
+const (
+	mediaYAML = "application/x-yaml"
+	mediaJSON = "application/json"
+	mediaText = "text/plain"
+	mediaHTML = "text/html"
+)
+
+// documentTypes are the media types of single validation responses,
+// the first one is the default. Text and HTML are human reports
+var documentTypes = []string{mediaYAML, "application/yaml", "text/yaml", mediaJSON, mediaText, mediaHTML}
+
+// dataTypes are the media types of batch responses
+var dataTypes = []string{mediaYAML, "application/yaml", "text/yaml", mediaJSON}
+
+// streamTypes are the media types accepted by streamed responses,
+// always NDJSON. Errors before the stream use the others
+var streamTypes = []string{mediaYAML, "application/yaml", "text/yaml", mediaJSON, "application/x-ndjson"}
+
+// format of a response
+type format struct {
+	mediaType string
+	lang      string
+}
+
+// negotiate returns the format of the response to r: the media type
+// of offers preferred by the Accept header and the language.
+// When no media type matches it writes a 406 and returns false
+func negotiate(w http.ResponseWriter, r *http.Request, offers []string) (format, bool) {
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Language")
+	f := format{lang: i18n.FromRequest(r)}
+	w.Header().Set("Content-Language", f.lang)
+
+	var ok bool
+	f.mediaType, ok = utils.Negotiate(r.Header.Get("Accept"), offers)
+	if !ok {
+		writeMessage(w, format{mediaJSON, f.lang}, utils.Message{
+			Status:  http.StatusNotAcceptable,
+			Message: "Not acceptable",
+			Error:   "supported media types: " + strings.Join(offers, ", "),
+		})
+	}
+	return f, ok
+}
+
+// contentType returns the Content-type header of mediaType
+func contentType(mediaType string) string {
+	if strings.HasPrefix(mediaType, "text/") {
+		return mediaType + "; charset=utf-8"
+	}
+	return mediaType
+}
+
+// writeMessage writes message as response in f
+func writeMessage(w http.ResponseWriter, f format, message utils.Message) {
+	log.Debugf("response message: %v", message)
+	message = i18n.Localize(message, f.lang)
+	w.Header().Set("Content-type", contentType(f.mediaType))
+	w.WriteHeader(message.Status)
+
+	switch f.mediaType {
+	case mediaJSON:
+		o, _ := json.Marshal(message)
+		w.Write(o)
+	case mediaText:
+		w.Write(textReport(message, f.lang))
+	case mediaHTML:
+		w.Write(htmlReport(message, f.lang))
+	default:
+		o, _ := yaml.Marshal(message)
+		w.Write(o)
+	}
+}
+
+// writeEnvelope writes message of a valid document with pc, the
+// normalized document. In YAML pc keeps its comments
+func writeEnvelope(w http.ResponseWriter, f format, message utils.Message, pc []byte) {
+	switch f.mediaType {
+	case mediaText, mediaHTML:
+		writeMessage(w, f, message)
+	case mediaJSON:
+		message.Normalized = utils.Yaml2json(pc)
+		writeMessage(w, f, message)
+	default:
+		o, err := i18n.Localize(message, f.lang).YAMLWithNormalized(pc)
+		if err != nil {
+			log.Errorf("normalized document: %v", err)
+			message.Normalized = utils.Yaml2json(pc)
+			writeMessage(w, f, message)
+			return
+		}
+		w.Header().Set("Content-type", contentType(f.mediaType))
+		w.WriteHeader(message.Status)
+		w.Write(o)
+	}
+}
+
+// writeData writes v, e.g. batch results, with status in f
+// whose media type is one of dataTypes
+func writeData(w http.ResponseWriter, f format, status int, v interface{}) {
+	w.Header().Set("Content-type", contentType(f.mediaType))
+	w.WriteHeader(status)
+	if f.mediaType == mediaJSON {
+		o, _ := json.Marshal(v)
+		w.Write(o)
+		return
+	}
+	o, _ := yaml.Marshal(v)
+	w.Write(o)
+}
@@ -0,0 +1,208 @@
+package apiv1
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// section is a group of keys of the specification shown
+// together in human reports
+type section struct {
+	key   string
+	title string
+	intro string
+}
+
+// sections of human reports, keys not listed here go in the first one
+var sections = []section{
+	{key: "", title: "General", intro: "Name, repository, logo and status of the software."},
+	{key: "description", title: "Description", intro: "What the software does, in every language of the catalog."},
+	{key: "legal", title: "Legal", intro: "License and copyright owners of the software."},
+	{key: "maintenance", title: "Maintenance", intro: "Who maintains the software and how to contact them."},
+	{key: "localisation", title: "Localisation", intro: "Languages the software is available in."},
+	{key: "intendedAudience", title: "Intended audience", intro: "Who the software is designed for."},
+	{key: "dependsOn", title: "Dependencies", intro: "Software and hardware needed to run the software."},
+	{key: "it", title: "Italy", intro: "Information required by the Italian extension of the specification."},
+}
+
+// report is the human readable view of a validation message
+type report struct {
+	Lang     string
+	Title    string
+	Valid    bool
+	Error    string
+	Summary  string
+	Sections []reportSection
+	catalog  i18n.Catalog
+}
+
+type reportSection struct {
+	Title   string
+	Intro   string
+	SpecURL string
+	Issues  []reportIssue
+}
+
+type reportIssue struct {
+	Warning     bool
+	Key         string
+	Reason      string
+	Detail      string
+	Explanation string
+	SpecURL     string
+	Position    string
+}
+
+// newReport groups the issues of message by section, errors first.
+// message is already localized, the rest of the report is in lang
+func newReport(message utils.Message, lang string) report {
+	c := i18n.Get(lang)
+	r := report{
+		Lang:    lang,
+		Title:   message.Message,
+		Valid:   message.Status < 300,
+		Error:   message.Error,
+		Summary: plural(c, len(message.ValidationError), "error") + ", " + plural(c, len(message.Warnings), "warning"),
+		catalog: c,
+	}
+
+	bySection := make([][]reportIssue, len(sections))
+	for _, issues := range [][]utils.ErrorInvalidValue{message.ValidationError, message.Warnings} {
+		for _, e := range issues {
+			issue := reportIssue{
+				Warning:     e.Severity == utils.SeverityWarning,
+				Key:         e.Key,
+				Reason:      e.Reason,
+				Detail:      e.Detail,
+				Explanation: c.Explanations[e.Code],
+				SpecURL:     e.SpecURL,
+			}
+			if e.Line > 0 {
+				issue.Position = fmt.Sprintf(c.T("line %d, column %d"), e.Line, e.Column)
+			}
+			i := sectionOf(e.Key)
+			bySection[i] = append(bySection[i], issue)
+		}
+	}
+	for i, issues := range bySection {
+		if len(issues) == 0 {
+			continue
+		}
+		s := sections[i]
+		specURL := utils.SpecBaseURL + "schema.core.html"
+		if s.key != "" {
+			specURL = utils.KeySpecURL(s.key)
+		}
+		r.Sections = append(r.Sections, reportSection{Title: c.T(s.title), Intro: c.T(s.intro), SpecURL: specURL, Issues: issues})
+	}
+	return r
+}
+
+// sectionOf returns the index in sections of key
+func sectionOf(key string) int {
+	top := strings.SplitN(key, "/", 2)[0]
+	for i, s := range sections {
+		if s.key != "" && s.key == top {
+			return i
+		}
+	}
+	return 0
+}
+
+// plural returns the count of n things, e.g. "2 errors"
+func plural(c i18n.Catalog, n int, thing string) string {
+	if n == 1 {
+		return c.T("1 " + thing)
+	}
+	return fmt.Sprintf(c.T("%d "+thing+"s"), n)
+}
+
+// T translates s in the language of the report
+func (r report) T(s string) string {
+	return r.catalog.T(s)
+}
+
+// textReport returns message as plain text in lang
+func textReport(message utils.Message, lang string) []byte {
+	r := newReport(message, lang)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "publiccode.yml: %s (%s)\n", r.Title, r.Summary)
+	if r.Error != "" {
+		fmt.Fprintf(&b, "\n%s\n", r.Error)
+	}
+	for _, s := range r.Sections {
+		fmt.Fprintf(&b, "\n%s\n%s\n%s\n%s\n", s.Title, strings.Repeat("=", utf8.RuneCountInString(s.Title)), s.Intro, s.SpecURL)
+		for _, i := range s.Issues {
+			severity := r.T("Error")
+			if i.Warning {
+				severity = r.T("Warning")
+			}
+			fmt.Fprintf(&b, "\n  %s %s", strings.ToUpper(severity), i.Key)
+			if i.Position != "" {
+				fmt.Fprintf(&b, " (%s)", i.Position)
+			}
+			fmt.Fprintf(&b, "\n    %s\n", i.Reason)
+			if i.Detail != "" {
+				fmt.Fprintf(&b, "    (%s)\n", i.Detail)
+			}
+			if i.Explanation != "" {
+				fmt.Fprintf(&b, "    %s\n", i.Explanation)
+			}
+			if i.SpecURL != "" {
+				fmt.Fprintf(&b, "    "+r.T("See %s")+"\n", i.SpecURL)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>publiccode.yml: {{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; line-height: 1.4; }
+.valid { color: #08792b; } .invalid { color: #b00020; }
+li { margin-bottom: 1em; } .error { border-left: 4px solid #b00020; padding-left: .5em; }
+.warning { border-left: 4px solid #c67c00; padding-left: .5em; }
+.position, .intro, .detail { color: #555; }
+</style>
+</head>
+<body>
+<h1 class="{{if .Valid}}valid{{else}}invalid{{end}}">{{.Title}}</h1>
+<p>{{.Summary}}</p>
+{{with .Error}}<p class="error">{{.}}</p>
+{{end}}{{range .Sections}}<section>
+<h2>{{.Title}}</h2>
+<p class="intro">{{.Intro}} <a href="{{.SpecURL}}">{{$.T "Specification"}}</a></p>
+<ul>
+{{range .Issues}}<li class="{{if .Warning}}warning{{else}}error{{end}}">
+<strong>{{if .Warning}}{{$.T "Warning"}}{{else}}{{$.T "Error"}}{{end}}</strong> <code>{{.Key}}</code>{{with .Position}} <span class="position">({{.}})</span>{{end}}<br>
+{{.Reason}}{{with .Detail}} <span class="detail">({{.}})</span>{{end}}{{with .Explanation}}<br>
+{{.}}{{end}}{{with .SpecURL}}<br>
+<a href="{{.}}">{{$.T "Read the specification"}}</a>{{end}}
+</li>
+{{end}}</ul>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// htmlReport returns message as an HTML page in lang
+func htmlReport(message utils.Message, lang string) []byte {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, newReport(message, lang)); err != nil {
+		log.Errorf("html report: %v", err)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,41 @@
+package apiv1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/italia/publiccode-validator/schema"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const mediaSchema = "application/schema+json"
+
+// schemaTypes are the media types of schemas
+var schemaTypes = []string{mediaSchema, mediaJSON}
+
+// Schema writes the JSON Schema of publiccode.yml documents
+// of the version in path, to validate them on clients
+func Schema(w http.ResponseWriter, r *http.Request) {
+	log.Info("/api/v1/schema")
+	utils.SetupResponse(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	f, ok := negotiate(w, r, schemaTypes)
+	if !ok {
+		return
+	}
+
+	s, err := schema.Generate(mux.Vars(r)["version"])
+	if err != nil {
+		promptError(err, w, format{mediaJSON, f.lang}, http.StatusNotFound, "Unsupported version")
+		return
+	}
+
+	o, _ := json.MarshalIndent(s, "", "  ")
+	w.Header().Set("Content-type", f.mediaType)
+	w.Write(o)
+}
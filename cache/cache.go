@@ -0,0 +1,214 @@
+// Package cache stores validation results of remote files, with the
+// validators (ETag, Last-Modified) of the files they come from
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Entry is a cached value
+type Entry struct {
+	Value        json.RawMessage `json:"value"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	// Digest identifies the content the value comes from,
+	// for files served without validators
+	Digest string `json:"digest,omitempty"`
+	// Stored is when the value was stored or last revalidated
+	Stored time.Time `json:"stored"`
+}
+
+// Store keeps entries by key, implementations are safe for
+// concurrent use
+type Store interface {
+	Get(key string) (Entry, bool)
+	Set(key string, e Entry)
+}
+
+// LRU is an in-memory Store, it drops the least recently
+// used entry when full
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry Entry
+}
+
+// NewLRU returns an LRU of at most size entries
+func NewLRU(size int) *LRU {
+	return &LRU{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the entry of key, if any
+func (c *LRU) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return Entry{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+// Set stores e under key
+func (c *LRU) Set(key string, e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruItem).entry = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruItem{key: key, entry: e})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruItem).key)
+	}
+}
+
+// Disk is a Store keeping an entry per file in a directory,
+// shared by restarts and by instances mounting the same volume.
+// Over size entries it drops the least recently used ones, down to
+// nine tenths of size so that the directory is seldom scanned
+type Disk struct {
+	dir  string
+	size int
+	// mu guards count and serializes pruning
+	mu sync.Mutex
+	// count is the number of entries, counted again when pruning
+	// as other instances may store entries in dir
+	count int
+}
+
+// tmpPrefix starts the names of files being written
+const tmpPrefix = ".entry-"
+
+// NewDisk returns a Disk store of at most size entries
+// in dir, created if missing
+func NewDisk(dir string, size int) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	d := &Disk{dir: dir, size: size}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".json") {
+			d.count++
+		}
+	}
+	return d, nil
+}
+
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get returns the entry of key, if any
+func (d *Disk) Get(key string) (Entry, bool) {
+	b, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		log.Warnf("cache: corrupted entry %s: %v", d.path(key), err)
+		return Entry{}, false
+	}
+	// the modification time tells the least recently used entries
+	now := time.Now()
+	os.Chtimes(d.path(key), now, now)
+	return e, true
+}
+
+// Set stores e under key, readers never see partial files
+func (d *Disk) Set(key string, e Entry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("cache: %v", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(d.dir, tmpPrefix)
+	if err != nil {
+		log.Errorf("cache: %v", err)
+		return
+	}
+	_, err = tmp.Write(b)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	_, errExists := os.Stat(d.path(key))
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Errorf("cache: %v", err)
+		return
+	}
+	if errExists == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.count++; d.count > d.size {
+		d.prune()
+	}
+}
+
+// prune removes the least recently used entries down to nine
+// tenths of size and the files left by writes interrupted more
+// than an hour ago. d.mu must be held
+func (d *Disk) prune() {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		log.Errorf("cache: %v", err)
+		return
+	}
+	var entries []os.FileInfo
+	for _, f := range files {
+		switch {
+		case strings.HasPrefix(f.Name(), tmpPrefix):
+			if time.Since(f.ModTime()) > time.Hour {
+				os.Remove(filepath.Join(d.dir, f.Name()))
+			}
+		case strings.HasSuffix(f.Name(), ".json"):
+			entries = append(entries, f)
+		}
+	}
+	d.count = len(entries)
+	keep := d.size - d.size/10
+	if d.count <= keep {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().Before(entries[j].ModTime()) })
+	for _, f := range entries[:d.count-keep] {
+		if err := os.Remove(filepath.Join(d.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			log.Errorf("cache: %v", err)
+		}
+	}
+	d.count = keep
+}
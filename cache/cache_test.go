@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", Entry{ETag: `"a"`})
+	c.Set("b", Entry{ETag: `"b"`})
+	// a is now the most recently used
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	c.Set("c", Entry{ETag: `"c"`})
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	e, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, `"a"`, e.ETag)
+
+	c.Set("c", Entry{ETag: `"c2"`})
+	e, _ = c.Get("c")
+	assert.Equal(t, `"c2"`, e.ETag)
+	assert.Equal(t, 2, c.order.Len())
+}
+
+func TestDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := NewDisk(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := d.Get("https://example.org/publiccode.yml")
+	assert.False(t, ok)
+
+	stored := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	e := Entry{Value: json.RawMessage(`{"pc":"bmFtZTogeAo="}`), LastModified: "Thu, 01 Oct 2020 12:00:00 GMT", Stored: stored}
+	d.Set("https://example.org/publiccode.yml", e)
+
+	// another store on the same directory, e.g. after a restart
+	d, _ = NewDisk(dir, 10)
+	got, ok := d.Get("https://example.org/publiccode.yml")
+	assert.True(t, ok)
+	assert.Equal(t, e.LastModified, got.LastModified)
+	assert.JSONEq(t, string(e.Value), string(got.Value))
+	assert.True(t, stored.Equal(got.Stored))
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
+
+func TestDiskSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := NewDisk(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// modification times set apart, file systems may be coarse
+	age := func(key string, d time.Duration) {
+		past := time.Now().Add(-d)
+		os.Chtimes(filepath.Join(dir, filepath.Base(key)), past, past)
+	}
+	d.Set("a", Entry{ETag: `"a"`})
+	age(d.path("a"), 3*time.Minute)
+	d.Set("b", Entry{ETag: `"b"`})
+	age(d.path("b"), 2*time.Minute)
+	// a is now the most recently used
+	_, ok := d.Get("a")
+	assert.True(t, ok)
+	d.Set("c", Entry{ETag: `"c"`})
+
+	_, ok = d.Get("b")
+	assert.False(t, ok)
+	_, ok = d.Get("a")
+	assert.True(t, ok)
+	_, ok = d.Get("c")
+	assert.True(t, ok)
+
+	// replacing entries doesn't prune, leftovers of
+	// interrupted writes are removed by the next pruning
+	tmp, _ := ioutil.TempFile(dir, tmpPrefix)
+	tmp.Close()
+	age(tmp.Name(), 2*time.Hour)
+	d.Set("c", Entry{ETag: `"c2"`})
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 3)
+	d.Set("d", Entry{ETag: `"d"`})
+	files, _ = ioutil.ReadDir(dir)
+	assert.Len(t, files, 2)
+
+	// entries are counted again when opening the directory,
+	// pruning goes down to nine tenths of the size
+	d, err = NewDisk(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, d.count)
+	for i := 0; i < 19; i++ {
+		d.Set(strconv.Itoa(i), Entry{})
+	}
+	files, _ = ioutil.ReadDir(dir)
+	assert.Len(t, files, 18)
+}
@@ -0,0 +1,634 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of the environment variables read by Load
+const EnvPrefix = "PUBLICCODE_VALIDATOR_"
+
+// Types of self-hosted forges
+const (
+	ForgeGitLab          = "gitlab"
+	ForgeGitea           = "gitea"
+	ForgeBitbucketServer = "bitbucket-server"
+)
+
+// Forge is a self-hosted code hosting platform
+type Forge struct {
+	// Host is the hostname, and port if any, of the forge
+	Host string `yaml:"host"`
+	// Type is one of gitlab, gitea or bitbucket-server
+	Type string `yaml:"type"`
+	// RawURL is the template of raw file URLs, overriding the one of
+	// Type. {scheme}, {host}, {repo}, {ref} and {file} are replaced by
+	// the parts of the URL, {repo} is the path of the repository
+	RawURL string `yaml:"rawURL,omitempty"`
+}
+
+// Validate checks the type and the raw URL template of f
+func (f Forge) Validate() error {
+	if f.Host == "" || strings.ContainsAny(f.Host, "/ ") {
+		return fmt.Errorf("invalid forge host %q", f.Host)
+	}
+	switch f.Type {
+	case ForgeGitLab, ForgeGitea, ForgeBitbucketServer:
+	default:
+		return fmt.Errorf("invalid type %q of forge %s, must be %s, %s or %s",
+			f.Type, f.Host, ForgeGitLab, ForgeGitea, ForgeBitbucketServer)
+	}
+	if f.RawURL != "" && (!strings.Contains(f.RawURL, "{ref}") || !strings.Contains(f.RawURL, "{file}")) {
+		return fmt.Errorf("raw URL of forge %s must contain {ref} and {file}", f.Host)
+	}
+	return nil
+}
+
+// Credential authenticates requests to the repositories of a host, as
+// HTTP Basic when Username is set, with a bearer token otherwise
+type Credential struct {
+	// Host is the hostname, and port if any, the credential is sent to
+	Host string `yaml:"host"`
+	// Repositories are the repositories of Host the credential of the
+	// server is used for, on behalf of any client: group/project,
+	// group/* for the ones in group and its subgroups, * for all.
+	// Empty for credentials of requests
+	Repositories []string `yaml:"repositories,omitempty"`
+	// Username is the user of HTTP Basic authentication, if any
+	Username string `yaml:"username,omitempty"`
+	// Token is the access token or password, never printed or logged
+	Token string `yaml:"token"`
+}
+
+// redacted replaces tokens when credentials are printed
+const redacted = "REDACTED"
+
+// Validate checks that c has a host and a token
+func (c Credential) Validate() error {
+	if c.Host == "" || strings.ContainsAny(c.Host, "/ ") {
+		return fmt.Errorf("invalid credential host %q", c.Host)
+	}
+	if c.Token == "" {
+		return fmt.Errorf("missing token of credential for %s", c.Host)
+	}
+	if len(c.Repositories) == 0 {
+		return fmt.Errorf("missing repositories of credential for %s, * for all", c.Host)
+	}
+	for _, r := range c.Repositories {
+		if r == "" || strings.ContainsAny(r, " ?#") || strings.Contains(strings.TrimSuffix(r, "/*"), "*") && r != "*" {
+			return fmt.Errorf("invalid repository %q of credential for %s", r, c.Host)
+		}
+	}
+	return nil
+}
+
+// Covers tells whether repo, the path of a repository on Host,
+// is one of Repositories
+func (c Credential) Covers(repo string) bool {
+	repo = strings.ToLower(strings.Trim(strings.TrimSuffix(repo, ".git"), "/"))
+	if repo == "" {
+		return false
+	}
+	for _, r := range c.Repositories {
+		r = strings.ToLower(strings.Trim(r, "/"))
+		switch {
+		case r == "*":
+			return true
+		case strings.HasSuffix(r, "/*"):
+			if strings.HasPrefix(repo, strings.TrimSuffix(r, "*")) {
+				return true
+			}
+		case r == repo:
+			return true
+		}
+	}
+	return false
+}
+
+// Authorization returns the value of the Authorization header
+func (c Credential) Authorization() string {
+	if c.Username != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Token))
+	}
+	return "Bearer " + c.Token
+}
+
+// String describes c without its token
+func (c Credential) String() string {
+	target := c.Host
+	if len(c.Repositories) > 0 {
+		target += "/" + strings.Join(c.Repositories, "|")
+	}
+	if c.Username != "" {
+		return fmt.Sprintf("%s=%s:%s", target, c.Username, redacted)
+	}
+	return fmt.Sprintf("%s=%s", target, redacted)
+}
+
+// MarshalYAML redacts the token
+func (c Credential) MarshalYAML() (interface{}, error) {
+	type plain Credential
+	c.Token = redacted
+	return plain(c), nil
+}
+
+// Config server settings
+type Config struct {
+	// ListenAddress is the host:port the server listens on
+	ListenAddress string `yaml:"listenAddress"`
+	// LogLevel is one of the logrus levels (debug, info, warn, error...)
+	LogLevel string `yaml:"logLevel"`
+	// LogFormat is text or json
+	LogFormat string `yaml:"logFormat"`
+	// TLSCert and TLSKey are the PEM files of the certificate and
+	// of its key, the server listens on HTTPS when set
+	TLSCert string `yaml:"tlsCert"`
+	TLSKey  string `yaml:"tlsKey"`
+
+	ReadTimeout  time.Duration `yaml:"readTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout"`
+	// ShutdownTimeout is how long in-flight requests are waited
+	// for on SIGTERM before closing their connections
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	// MaxBodySize is the maximum size in bytes of request bodies
+	MaxBodySize int64 `yaml:"maxBodySize"`
+	// DisableNetwork is the network mode used when requests
+	// don't set the disableNetwork parameter
+	DisableNetwork bool `yaml:"disableNetwork"`
+	// CORSOrigins are the origins allowed to call the API, * for any
+	CORSOrigins []string `yaml:"corsOrigins"`
+	// BatchWorkers is the number of documents of a batch
+	// validated concurrently
+	BatchWorkers int `yaml:"batchWorkers"`
+	// BatchPerHost is the number of concurrent requests of
+	// remote batches to every host, like the API and the raw
+	// files of GitHub, shared by all the batches
+	BatchPerHost int `yaml:"batchPerHost"`
+	// CacheSize is the number of remote files whose results are
+	// kept, in memory or in CacheDir, 0 disables the cache
+	CacheSize int `yaml:"cacheSize"`
+	// CacheTTL is how long cached results are used before
+	// revalidating the remote file
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+	// CacheDir stores cached results on disk instead of memory
+	CacheDir string `yaml:"cacheDir"`
+	// Forges are the self-hosted forges, whose URLs are not
+	// recognized from the hostname
+	Forges []Forge `yaml:"forges"`
+	// Credentials authenticate requests to private repositories
+	Credentials []Credential `yaml:"credentials"`
+
+	// FetchTimeout is the time limit of every attempt of requests
+	// to remote hosts, 0 for none
+	FetchTimeout time.Duration `yaml:"fetchTimeout"`
+	// FetchRetries is how many times failed requests to remote
+	// hosts are retried, with exponential backoff
+	FetchRetries int `yaml:"fetchRetries"`
+	// FetchMaxRedirects is the number of redirects followed
+	FetchMaxRedirects int `yaml:"fetchMaxRedirects"`
+	// FetchMaxSize is the size limit in bytes of remote files, 0 for none
+	FetchMaxSize int64 `yaml:"fetchMaxSize"`
+	// UserAgent of requests to remote hosts, publiccode-validator
+	// and its version if empty
+	UserAgent string `yaml:"userAgent"`
+	// Proxy is the URL of the proxy of requests to remote hosts,
+	// read from HTTP_PROXY, HTTPS_PROXY and NO_PROXY if empty
+	Proxy string `yaml:"proxy"`
+	// AllowPrivateNetworks allows fetching hosts resolving to
+	// loopback, private and link-local addresses
+	AllowPrivateNetworks bool `yaml:"allowPrivateNetworks"`
+	// AllowedHosts are fetched even if in DeniedHosts or in private
+	// networks. *.example.org matches subdomains, * every host
+	AllowedHosts []string `yaml:"allowedHosts"`
+	// DeniedHosts are never fetched
+	DeniedHosts []string `yaml:"deniedHosts"`
+}
+
+// Default returns the settings used when nothing else is set
+func Default() Config {
+	return Config{
+		ListenAddress:   ":5000",
+		LogLevel:        "info",
+		LogFormat:       "text",
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    120 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		MaxBodySize:     1 << 20,
+		DisableNetwork:  false,
+		CORSOrigins:     []string{"*"},
+		BatchWorkers:    4,
+		BatchPerHost:    2,
+		CacheSize:       1000,
+		CacheTTL:        10 * time.Minute,
+
+		FetchTimeout:      30 * time.Second,
+		FetchRetries:      2,
+		FetchMaxRedirects: 10,
+		FetchMaxSize:      10 << 20,
+	}
+}
+
+// setting is a single config key, settable from flags and env
+type setting struct {
+	name   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{name: "listen", env: "LISTEN", usage: "listen address (host:port)",
+		set: func(c *Config, v string) error {
+			c.ListenAddress = v
+			return nil
+		}},
+	{name: "log-level", env: "LOG_LEVEL", usage: "log level: debug, info, warn, error",
+		set: func(c *Config, v string) error {
+			c.LogLevel = v
+			return nil
+		}},
+	{name: "log-format", env: "LOG_FORMAT", usage: "log format: text or json",
+		set: func(c *Config, v string) error {
+			c.LogFormat = v
+			return nil
+		}},
+	{name: "tls-cert", env: "TLS_CERT", usage: "PEM file of the TLS certificate, serves HTTPS with tls-key",
+		set: func(c *Config, v string) error {
+			c.TLSCert = v
+			return nil
+		}},
+	{name: "tls-key", env: "TLS_KEY", usage: "PEM file of the key of the TLS certificate",
+		set: func(c *Config, v string) error {
+			c.TLSKey = v
+			return nil
+		}},
+	{name: "read-timeout", env: "READ_TIMEOUT", usage: "maximum duration for reading a request (e.g. 30s)",
+		set: func(c *Config, v string) (err error) {
+			c.ReadTimeout, err = time.ParseDuration(v)
+			return
+		}},
+	{name: "write-timeout", env: "WRITE_TIMEOUT", usage: "maximum duration before timing out writes of a response, of every result of streamed batches",
+		set: func(c *Config, v string) (err error) {
+			c.WriteTimeout, err = time.ParseDuration(v)
+			return
+		}},
+	{name: "idle-timeout", env: "IDLE_TIMEOUT", usage: "maximum time to wait for the next request on keep-alive connections",
+		set: func(c *Config, v string) (err error) {
+			c.IdleTimeout, err = time.ParseDuration(v)
+			return
+		}},
+	{name: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT", usage: "maximum time to wait for in-flight requests on shutdown",
+		set: func(c *Config, v string) (err error) {
+			c.ShutdownTimeout, err = time.ParseDuration(v)
+			return
+		}},
+	{name: "max-body-size", env: "MAX_BODY_SIZE", usage: "maximum request body size in bytes",
+		set: func(c *Config, v string) (err error) {
+			c.MaxBodySize, err = strconv.ParseInt(v, 10, 64)
+			return
+		}},
+	{name: "disable-network", env: "DISABLE_NETWORK", usage: "disable network checks unless requests set disableNetwork", isBool: true,
+		set: func(c *Config, v string) (err error) {
+			c.DisableNetwork, err = strconv.ParseBool(v)
+			return
+		}},
+	{name: "cors-origins", env: "CORS_ORIGINS", usage: "comma separated list of allowed CORS origins, * for any",
+		set: func(c *Config, v string) error {
+			c.CORSOrigins = splitList(v)
+			return nil
+		}},
+	{name: "batch-workers", env: "BATCH_WORKERS", usage: "number of documents of a batch validated concurrently",
+		set: func(c *Config, v string) (err error) {
+			c.BatchWorkers, err = strconv.Atoi(v)
+			return
+		}},
+	{name: "batch-per-host", env: "BATCH_PER_HOST", usage: "number of concurrent requests of a remote batch to every host, like the API and the raw files of GitHub",
+		set: func(c *Config, v string) (err error) {
+			c.BatchPerHost, err = strconv.Atoi(v)
+			return
+		}},
+	{name: "cache-size", env: "CACHE_SIZE", usage: "number of remote files whose results are cached, in memory or in cache-dir, the least recently used are dropped, 0 disables the cache",
+		set: func(c *Config, v string) (err error) {
+			c.CacheSize, err = strconv.Atoi(v)
+			return
+		}},
+	{name: "cache-ttl", env: "CACHE_TTL", usage: "time cached results are used before revalidating the remote file",
+		set: func(c *Config, v string) (err error) {
+			c.CacheTTL, err = time.ParseDuration(v)
+			return
+		}},
+	{name: "cache-dir", env: "CACHE_DIR", usage: "directory storing cached results, instead of memory",
+		set: func(c *Config, v string) error {
+			c.CacheDir = v
+			return nil
+		}},
+	{name: "forges", env: "FORGES", usage: "comma separated list of self-hosted forges as host=type, type is gitlab, gitea or bitbucket-server",
+		set: func(c *Config, v string) error {
+			c.Forges = nil
+			for _, f := range strings.Split(v, ",") {
+				if f = strings.TrimSpace(f); f == "" {
+					continue
+				}
+				parts := strings.SplitN(f, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("invalid forge %q, must be host=type", f)
+				}
+				c.Forges = append(c.Forges, Forge{Host: strings.TrimSpace(parts[0]), Type: strings.TrimSpace(parts[1])})
+			}
+			return nil
+		}},
+	{name: "credentials", env: "CREDENTIALS", usage: "comma separated list of credentials of private repositories, used for any client, as host/repositories=token or host/repositories=username:token with repositories group/project, group/* or *, prefer the environment to keep them out of the process list",
+		set: func(c *Config, v string) error {
+			c.Credentials = nil
+			for _, cred := range strings.Split(v, ",") {
+				if cred = strings.TrimSpace(cred); cred == "" {
+					continue
+				}
+				parts := strings.SplitN(cred, "=", 2)
+				if len(parts) != 2 {
+					// never print the value, it may be a token
+					return errors.New("invalid credential, must be host/repositories=token or host/repositories=username:token")
+				}
+				target := strings.SplitN(strings.TrimSpace(parts[0]), "/", 2)
+				if len(target) != 2 {
+					return fmt.Errorf("missing repositories of credential for %s, use %s/* for all", target[0], target[0])
+				}
+				credential := Credential{Host: target[0], Repositories: []string{target[1]}, Token: strings.TrimSpace(parts[1])}
+				if userToken := strings.SplitN(credential.Token, ":", 2); len(userToken) == 2 {
+					credential.Username, credential.Token = userToken[0], userToken[1]
+				}
+				c.Credentials = append(c.Credentials, credential)
+			}
+			return nil
+		}},
+	{name: "fetch-timeout", env: "FETCH_TIMEOUT", usage: "time limit of every attempt of requests to remote hosts, 0 for none",
+		set: func(c *Config, v string) (err error) {
+			c.FetchTimeout, err = time.ParseDuration(v)
+			return
+		}},
+	{name: "fetch-retries", env: "FETCH_RETRIES", usage: "number of retries of failed requests to remote hosts",
+		set: func(c *Config, v string) (err error) {
+			c.FetchRetries, err = strconv.Atoi(v)
+			return
+		}},
+	{name: "fetch-max-redirects", env: "FETCH_MAX_REDIRECTS", usage: "number of redirects followed by requests to remote hosts",
+		set: func(c *Config, v string) (err error) {
+			c.FetchMaxRedirects, err = strconv.Atoi(v)
+			return
+		}},
+	{name: "fetch-max-size", env: "FETCH_MAX_SIZE", usage: "size limit in bytes of remote files, 0 for none",
+		set: func(c *Config, v string) (err error) {
+			c.FetchMaxSize, err = strconv.ParseInt(v, 10, 64)
+			return
+		}},
+	{name: "user-agent", env: "USER_AGENT", usage: "User-Agent of requests to remote hosts",
+		set: func(c *Config, v string) error {
+			c.UserAgent = v
+			return nil
+		}},
+	{name: "proxy", env: "PROXY", usage: "URL of the proxy of requests to remote hosts, from HTTP_PROXY, HTTPS_PROXY and NO_PROXY if empty",
+		set: func(c *Config, v string) error {
+			c.Proxy = v
+			return nil
+		}},
+	{name: "allow-private-networks", env: "ALLOW_PRIVATE_NETWORKS", usage: "allow fetching hosts resolving to loopback, private and link-local addresses", isBool: true,
+		set: func(c *Config, v string) (err error) {
+			c.AllowPrivateNetworks, err = strconv.ParseBool(v)
+			return
+		}},
+	{name: "allowed-hosts", env: "ALLOWED_HOSTS", usage: "comma separated list of hosts fetched even if denied or in private networks, *.example.org matches subdomains",
+		set: func(c *Config, v string) error {
+			c.AllowedHosts = splitList(v)
+			return nil
+		}},
+	{name: "denied-hosts", env: "DENIED_HOSTS", usage: "comma separated list of hosts never fetched, * for any not allowed",
+		set: func(c *Config, v string) error {
+			c.DeniedHosts = splitList(v)
+			return nil
+		}},
+}
+
+// splitList returns the non empty items of a comma separated list
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// settingValue is the flag.Value of a setting, applied after
+// the config file and the environment
+type settingValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *settingValue) String() string     { return v.value }
+func (v *settingValue) Set(s string) error { v.value = s; return nil }
+func (v *settingValue) IsBoolFlag() bool   { return v.isBool }
+
+// Load returns the configuration built from, in increasing order of
+// precedence: defaults, the YAML config file, PUBLICCODE_VALIDATOR_*
+// environment variables and command line flags.
+// getenv is usually os.Getenv. printConfig reports whether --print-config
+// was requested
+func Load(args []string, getenv func(string) string, output io.Writer) (cfg Config, printConfig bool, err error) {
+	flags := flag.NewFlagSet("publiccode-validator", flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	configFile := flags.String("config", "", "path of a YAML config file (env "+EnvPrefix+"CONFIG)")
+	flags.BoolVar(&printConfig, "print-config", false, "print the resulting configuration and exit")
+	values := make(map[string]*settingValue)
+	for _, s := range settings {
+		values[s.name] = &settingValue{isBool: s.isBool}
+		flags.Var(values[s.name], s.name, s.usage+" (env "+EnvPrefix+s.env+")")
+	}
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+	if flags.NArg() > 0 {
+		err = fmt.Errorf("unexpected argument: %s", flags.Arg(0))
+		return
+	}
+
+	cfg = Default()
+
+	if *configFile == "" {
+		*configFile = getenv(EnvPrefix + "CONFIG")
+	}
+	if *configFile != "" {
+		if err = cfg.loadFile(*configFile); err != nil {
+			return
+		}
+	}
+
+	for _, s := range settings {
+		if v := getenv(EnvPrefix + s.env); v != "" {
+			if err = s.set(&cfg, v); err != nil {
+				err = fmt.Errorf("%s%s: %v", EnvPrefix, s.env, err)
+				return
+			}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if s, ok := findSetting(f.Name); ok && err == nil {
+			if errSet := s.set(&cfg, values[s.name].value); errSet != nil {
+				err = fmt.Errorf("--%s: %v", s.name, errSet)
+			}
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	err = cfg.Validate()
+	return
+}
+
+func findSetting(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// loadFile overrides c with the keys set in a YAML file
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the configuration can be used to start the server
+func (c Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return fmt.Errorf("invalid listen address %q: %v", c.ListenAddress, err)
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("invalid log format %q, must be text or json", c.LogFormat)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("TLS certificate and key must be set together")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		return errors.New("timeouts can't be negative")
+	}
+	if c.MaxBodySize <= 0 {
+		return fmt.Errorf("invalid max body size %d, must be positive", c.MaxBodySize)
+	}
+	if len(c.CORSOrigins) == 0 {
+		return errors.New("at least one CORS origin is needed, use * for any")
+	}
+	if c.BatchWorkers <= 0 {
+		return fmt.Errorf("invalid batch workers %d, must be positive", c.BatchWorkers)
+	}
+	if c.BatchPerHost <= 0 {
+		return fmt.Errorf("invalid batch per host %d, must be positive", c.BatchPerHost)
+	}
+	if c.CacheSize < 0 {
+		return fmt.Errorf("invalid cache size %d, can't be negative", c.CacheSize)
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("cache TTL can't be negative")
+	}
+	hosts := make(map[string]bool)
+	for _, f := range c.Forges {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		if hosts[strings.ToLower(f.Host)] {
+			return fmt.Errorf("forge %s is set more than once", f.Host)
+		}
+		hosts[strings.ToLower(f.Host)] = true
+	}
+	hosts = make(map[string]bool)
+	for _, cred := range c.Credentials {
+		if err := cred.Validate(); err != nil {
+			return err
+		}
+		for _, r := range cred.Repositories {
+			key := strings.ToLower(cred.Host + "/" + r)
+			if hosts[key] {
+				return fmt.Errorf("credential for %s is set more than once", key)
+			}
+			hosts[key] = true
+		}
+	}
+	if c.FetchTimeout < 0 {
+		return errors.New("fetch timeout can't be negative")
+	}
+	if c.FetchRetries < 0 {
+		return fmt.Errorf("invalid fetch retries %d, can't be negative", c.FetchRetries)
+	}
+	if c.FetchMaxRedirects < 0 {
+		return fmt.Errorf("invalid fetch max redirects %d, can't be negative", c.FetchMaxRedirects)
+	}
+	if c.FetchMaxSize < 0 {
+		return fmt.Errorf("invalid fetch max size %d, can't be negative", c.FetchMaxSize)
+	}
+	for _, h := range append(append([]string{}, c.AllowedHosts...), c.DeniedHosts...) {
+		if h == "" || strings.ContainsAny(h, "/: ") || strings.Contains(h[1:], "*") {
+			return fmt.Errorf("invalid host %q, must be a hostname, *.domain or *", h)
+		}
+	}
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid proxy %q", c.Proxy)
+		}
+	}
+	return nil
+}
+
+// SetupLog configures logrus level and format
+func (c Config) SetupLog() {
+	level, err := log.ParseLevel(c.LogLevel)
+	if err == nil {
+		log.SetLevel(level)
+	}
+	if c.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+}
+
+// Print writes the configuration in the same YAML format
+// accepted as config file, with tokens redacted
+func (c Config) Print(w io.Writer) error {
+	o, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(o)
+	return err
+}
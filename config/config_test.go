@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, printConfig, err := Load(nil, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.False(t, printConfig)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.yml")
+	err = ioutil.WriteFile(file, []byte("listenAddress: :6000\nlogLevel: warn\nreadTimeout: 5s\ncorsOrigins:\n- https://a.example\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := Load(
+		[]string{"--config", file, "--listen", "127.0.0.1:7000", "--disable-network"},
+		env(map[string]string{
+			EnvPrefix + "LISTEN":        ":8000",
+			EnvPrefix + "LOG_LEVEL":     "debug",
+			EnvPrefix + "MAX_BODY_SIZE": "1024",
+		}),
+		ioutil.Discard)
+	assert.Nil(t, err)
+
+	// flags win over env, env over file, file over defaults
+	assert.Equal(t, "127.0.0.1:7000", cfg.ListenAddress)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, int64(1024), cfg.MaxBodySize)
+	assert.Equal(t, 5*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, []string{"https://a.example"}, cfg.CORSOrigins)
+	assert.True(t, cfg.DisableNetwork)
+	assert.Equal(t, Default().WriteTimeout, cfg.WriteTimeout)
+
+	cfg, _, err = Load([]string{"--allowed-hosts", "git.comune.example.it, *.example.org", "--denied-hosts", "*"}, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"git.comune.example.it", "*.example.org"}, cfg.AllowedHosts)
+	assert.Equal(t, []string{"*"}, cfg.DeniedHosts)
+
+	cfg, _, err = Load([]string{"--tls-cert", "cert.pem"}, env(map[string]string{EnvPrefix + "TLS_KEY": "key.pem"}), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, "cert.pem", cfg.TLSCert)
+	assert.Equal(t, "key.pem", cfg.TLSKey)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := [][]string{
+		{"--listen", "5000"},
+		{"--log-level", "verbose"},
+		{"--log-format", "xml"},
+		{"--tls-cert", "cert.pem"},
+		{"--tls-key", "key.pem"},
+		{"--read-timeout", "ten"},
+		{"--shutdown-timeout", "-1s"},
+		{"--max-body-size", "0"},
+		{"--cors-origins", ","},
+		{"--batch-workers", "0"},
+		{"--batch-per-host", "-1"},
+		{"--cache-size", "-1"},
+		{"--cache-ttl", "-1m"},
+		{"--forges", "git.example.org"},
+		{"--forges", "git.example.org=svn"},
+		{"--forges", "git.example.org=gitea,git.example.org=gitlab"},
+		{"--credentials", "secret"},
+		{"--credentials", "git.example.org/*="},
+		{"--credentials", "git.example.org=secret"},
+		{"--credentials", "git.example.org/pa*=secret"},
+		{"--credentials", "git.example.org/pa/*=a,git.example.org/pa/*=b"},
+		{"--fetch-timeout", "-1s"},
+		{"--fetch-retries", "-1"},
+		{"--fetch-max-redirects", "many"},
+		{"--fetch-max-size", "-1"},
+		{"--proxy", "proxy.example.org"},
+		{"--allowed-hosts", "https://github.com"},
+		{"--denied-hosts", "git.*.org"},
+		{"--config", "missing.yml"},
+		{"unexpected"},
+	}
+	for _, args := range invalid {
+		_, _, err := Load(args, env(nil), ioutil.Discard)
+		assert.NotNil(t, err, "%v", args)
+	}
+
+	_, _, err := Load(nil, env(map[string]string{EnvPrefix + "DISABLE_NETWORK": "maybe"}), ioutil.Discard)
+	assert.NotNil(t, err)
+}
+
+func TestLoadForges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.yml")
+	err = ioutil.WriteFile(file, []byte(`forges:
+- host: git.comune.example
+  type: gitlab
+- host: code.example.org:3000
+  type: gitea
+  rawURL: "{scheme}://{host}/{repo}/raw/branch/{ref}/{file}"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := Load([]string{"--config", file}, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, []Forge{
+		{Host: "git.comune.example", Type: ForgeGitLab},
+		{Host: "code.example.org:3000", Type: ForgeGitea, RawURL: "{scheme}://{host}/{repo}/raw/branch/{ref}/{file}"},
+	}, cfg.Forges)
+
+	cfg, _, err = Load(nil, env(map[string]string{EnvPrefix + "FORGES": "git.example.org=gitea, bb.example.org=bitbucket-server"}), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, []Forge{
+		{Host: "git.example.org", Type: ForgeGitea},
+		{Host: "bb.example.org", Type: ForgeBitbucketServer},
+	}, cfg.Forges)
+
+	err = ioutil.WriteFile(file, []byte("forges:\n- host: git.example.org\n  type: gitea\n  rawURL: https://{host}/{repo}/raw\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Load([]string{"--config", file}, env(nil), ioutil.Discard)
+	assert.NotNil(t, err)
+}
+
+func TestLoadCredentials(t *testing.T) {
+	cfg, _, err := Load(nil, env(map[string]string{EnvPrefix + "CREDENTIALS": "git.example.org/*=secret, github.com/comune/*=bot:ghp_secret"}), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, []Credential{
+		{Host: "git.example.org", Repositories: []string{"*"}, Token: "secret"},
+		{Host: "github.com", Repositories: []string{"comune/*"}, Username: "bot", Token: "ghp_secret"},
+	}, cfg.Credentials)
+	assert.Equal(t, "Bearer secret", cfg.Credentials[0].Authorization())
+	assert.Equal(t, "Basic Ym90OmdocF9zZWNyZXQ=", cfg.Credentials[1].Authorization())
+
+	// tokens are never printed
+	var b bytes.Buffer
+	assert.Nil(t, cfg.Print(&b))
+	assert.NotContains(t, b.String(), "secret")
+	assert.Contains(t, b.String(), "username: bot")
+	assert.NotContains(t, fmt.Sprintf("%v %+v", cfg, cfg.Credentials), "secret")
+
+	// server credentials are used only for the repositories listed
+	assert.True(t, cfg.Credentials[0].Covers("any/project"))
+	assert.True(t, cfg.Credentials[1].Covers("comune/app"))
+	assert.True(t, cfg.Credentials[1].Covers("Comune/sub/app.git"))
+	assert.False(t, cfg.Credentials[1].Covers("comune"))
+	assert.False(t, cfg.Credentials[1].Covers("comunex/app"))
+	assert.False(t, cfg.Credentials[1].Covers("other/app"))
+	assert.False(t, Credential{Host: "github.com", Token: "secret"}.Covers("comune/app"))
+}
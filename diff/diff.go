@@ -0,0 +1,217 @@
+// Package diff compares publiccode.yml documents, e.g. a submitted
+// one and the normalized version returned by the validator
+package diff
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/italia/publiccode-validator/utils"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// types of Change
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+	Renamed = "renamed"
+)
+
+// Change is a difference between two documents
+type Change struct {
+	Type string `json:"type"`
+	// Key is the path of the value, e.g. legal/license
+	// or maintenance/contacts/0/name
+	Key string `json:"key"`
+	// From is the old key of renamed values
+	From string      `json:"from,omitempty"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Compare returns the changes from old to new, YAML or JSON
+// documents, sorted by key. Keys of older versions moved to their
+// new name are renamed, values added or removed as a whole are
+// reported once, at their key
+func Compare(old []byte, new []byte) ([]Change, error) {
+	var oldTree, newTree map[string]interface{}
+	if err := yaml.Unmarshal(old, &oldTree); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(new, &newTree); err != nil {
+		return nil, err
+	}
+
+	changes := renameLegacyKeys(oldTree, newTree)
+	compare("", oldTree, newTree, &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+// renameLegacyKeys moves the keys of older versions in old to
+// their new name, when it's used in new and not in old
+func renameLegacyKeys(old map[string]interface{}, new map[string]interface{}) []Change {
+	var keys []string
+	walk("", old, func(key string) {
+		if newKey, ok := utils.RenamedKey(key); ok && newKey != "" {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+
+	var changes []Change
+	for _, key := range keys {
+		newKey, _ := utils.RenamedKey(key)
+		_, inOld := get(old, newKey)
+		_, inNew := get(new, newKey)
+		if inOld || !inNew {
+			continue
+		}
+		value, _ := get(old, key)
+		if !set(old, newKey, value) {
+			continue
+		}
+		remove(old, key)
+		changes = append(changes, Change{Type: Renamed, Key: newKey, From: key})
+	}
+	return changes
+}
+
+func compare(key string, old interface{}, new interface{}, changes *[]Change) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, v := range o {
+			if nv, ok := n[k]; ok {
+				compare(join(key, k), v, nv, changes)
+			} else {
+				*changes = append(*changes, Change{Type: Removed, Key: join(key, k), Old: v})
+			}
+		}
+		for k, v := range n {
+			if _, ok := o[k]; !ok {
+				*changes = append(*changes, Change{Type: Added, Key: join(key, k), New: v})
+			}
+		}
+		return
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			k := join(key, strconv.Itoa(i))
+			switch {
+			case i >= len(n):
+				*changes = append(*changes, Change{Type: Removed, Key: k, Old: o[i]})
+			case i >= len(o):
+				*changes = append(*changes, Change{Type: Added, Key: k, New: n[i]})
+			default:
+				compare(k, o[i], n[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Type: Changed, Key: key, Old: old, New: new})
+	}
+}
+
+// Unified returns the unified diff of the lines of old and new,
+// named in the headers, empty if they're equal
+func Unified(oldName string, old []byte, newName string, new []byte) string {
+	text, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines(old),
+		B:        lines(new),
+		FromFile: oldName,
+		ToFile:   newName,
+		Context:  3,
+	})
+	return text
+}
+
+// lines splits b after newlines, adding
+// the missing one to the last line
+func lines(b []byte) []string {
+	l := strings.SplitAfter(string(b), "\n")
+	if l[len(l)-1] == "" {
+		return l[:len(l)-1]
+	}
+	l[len(l)-1] += "\n"
+	return l
+}
+
+// get returns the value of key in m
+func get(m map[string]interface{}, key string) (interface{}, bool) {
+	segments := strings.Split(key, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := m[segment].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = child
+	}
+	value, ok := m[segments[len(segments)-1]]
+	return value, ok
+}
+
+// set sets key in m, adding the missing parents.
+// It returns false when a parent is not a mapping
+func set(m map[string]interface{}, key string, value interface{}) bool {
+	segments := strings.Split(key, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := m[segment].(map[string]interface{})
+		if !ok {
+			if _, exists := m[segment]; exists {
+				return false
+			}
+			child = map[string]interface{}{}
+			m[segment] = child
+		}
+		m = child
+	}
+	m[segments[len(segments)-1]] = value
+	return true
+}
+
+// remove deletes key from m, and its parents when left empty
+func remove(m map[string]interface{}, key string) {
+	segments := strings.Split(key, "/")
+	if len(segments) == 1 {
+		delete(m, key)
+		return
+	}
+	parentKey := strings.Join(segments[:len(segments)-1], "/")
+	parent, _ := get(m, parentKey)
+	if p, ok := parent.(map[string]interface{}); ok {
+		delete(p, segments[len(segments)-1])
+		if len(p) == 0 {
+			remove(m, parentKey)
+		}
+	}
+}
+
+// walk calls fn for every key of m, recursively
+func walk(prefix string, m map[string]interface{}, fn func(key string)) {
+	for k, v := range m {
+		fn(prefix + k)
+		if child, ok := v.(map[string]interface{}); ok {
+			walk(prefix+k+"/", child, fn)
+		}
+	}
+}
+
+func join(key string, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "/" + name
+}
@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	old := `publiccode-yaml-version: "0.1"
+name: Medusa
+softwareType: standalone
+tags: [a]
+platforms: [web, linux]
+it:
+  spid: yes
+  pagopa: true
+`
+	new := `publiccodeYmlVersion: "0.2"
+name: Medusa
+softwareType: standalone/other
+platforms: [web]
+intendedAudience: {}
+it:
+  piattaforme:
+    spid: true
+    pagopa: false
+`
+	changes, err := Compare([]byte(old), []byte(new))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []Change{
+		{Type: Added, Key: "intendedAudience", New: map[string]interface{}{}},
+		{Type: Renamed, Key: "it/piattaforme/pagopa", From: "it/pagopa"},
+		{Type: Changed, Key: "it/piattaforme/pagopa", Old: true, New: false},
+		{Type: Renamed, Key: "it/piattaforme/spid", From: "it/spid"},
+		{Type: Removed, Key: "platforms/1", Old: "linux"},
+		{Type: Renamed, Key: "publiccodeYmlVersion", From: "publiccode-yaml-version"},
+		{Type: Changed, Key: "publiccodeYmlVersion", Old: "0.1", New: "0.2"},
+		{Type: Changed, Key: "softwareType", Old: "standalone", New: "standalone/other"},
+		{Type: Removed, Key: "tags", Old: []interface{}{"a"}},
+	}, changes)
+
+	changes, err = Compare([]byte(`{"name": "Medusa"}`), []byte("name: Medusa\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = Compare([]byte("- a list"), []byte(new))
+	assert.Error(t, err)
+}
+
+func TestUnified(t *testing.T) {
+	assert.Equal(t, `--- submitted
++++ normalized
+@@ -1,2 +1,2 @@
+-publiccodeYmlVersion: "0.1"
++publiccodeYmlVersion: "0.2"
+ name: Medusa
+`, Unified("submitted", []byte("publiccodeYmlVersion: \"0.1\"\nname: Medusa\n"),
+		"normalized", []byte("publiccodeYmlVersion: \"0.2\"\nname: Medusa\n")))
+
+	assert.Empty(t, Unified("a", []byte("name: Medusa\n"), "b", []byte("name: Medusa\n")))
+}
@@ -0,0 +1,346 @@
+// Package fix applies safe automatic corrections to publiccode.yml
+// documents: mechanical changes whose outcome is not ambiguous, such
+// as date formats or keys renamed by newer versions of the specification
+package fix
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/utils"
+)
+
+// Fix is a correction applied to a document
+type Fix struct {
+	// Code of the validation error or warning fixed
+	Code        string `json:"code"`
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Operation is an RFC 6902 JSON Patch operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Result is a fixed document, with the fixes applied and the
+// patch turning the original document into the fixed one
+type Result struct {
+	// Document is the fixed document in YAML, with the
+	// comments and the order of keys of the original one
+	Document []byte
+	Fixes    []Fix
+	Patch    []Operation
+}
+
+// dateLayouts are the formats of releaseDate fixed,
+// day first and month first ones are both tried
+var dateLayouts = []string{
+	"2006/01/02", "2006.01.02", "2006-1-2", "2006/1/2",
+	"02/01/2006", "01/02/2006", "02-01-2006", "01-02-2006", "02.01.2006",
+	"2/1/2006", "1/2/2006", "2 January 2006", "January 2, 2006",
+	time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05",
+}
+
+// Apply returns doc, in YAML or JSON, with the safe fixes applied
+func Apply(doc []byte) (Result, error) {
+	document, err := jsonTree(doc)
+	if err != nil {
+		return Result{}, err
+	}
+
+	f := fixer{document: document}
+	f.legacyKeys()
+	f.version()
+	f.releaseDate()
+	f.countries("intendedAudience/countries")
+	f.countries("intendedAudience/unsupportedCountries")
+
+	fixed, err := PatchYAML(doc, f.patch)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Document: fixed, Fixes: f.fixes, Patch: f.patch}, nil
+}
+
+// fixer changes document keeping track of fixes and patch
+type fixer struct {
+	document map[string]interface{}
+	fixes    []Fix
+	patch    []Operation
+}
+
+func (f *fixer) fix(code string, key string, description string, args ...interface{}) {
+	f.fixes = append(f.fixes, Fix{Code: code, Key: key, Description: fmt.Sprintf(description, args...)})
+}
+
+// legacyKeys renames the keys of older versions, or removes them
+// when dropped by the specification. Keys whose new name is already
+// in use are left alone
+func (f *fixer) legacyKeys() {
+	var keys []string
+	walk("", f.document, func(key string) {
+		if _, ok := utils.RenamedKey(key); ok {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		newKey, _ := utils.RenamedKey(key)
+		if newKey == "" {
+			f.remove(key)
+			f.fix(utils.CodeDeprecatedKey, key, "removed %s, dropped by the specification", key)
+			continue
+		}
+		if _, ok := f.get(newKey); ok || !f.settable(newKey) {
+			continue
+		}
+		f.move(key, newKey)
+		f.fix(utils.CodeDeprecatedKey, key, "renamed %s to %s", key, newKey)
+	}
+}
+
+// version adds a missing publiccodeYmlVersion and upgrades older ones,
+// also under the legacy name renamed by legacyKeys, whose keys have
+// been upgraded by legacyKeys
+func (f *fixer) version() {
+	const key = "publiccodeYmlVersion"
+	value, ok := f.get(key)
+	if !ok {
+		f.set(key, publiccode.Version)
+		f.fix(utils.CodeMissingKey, key, "added %s %s", key, publiccode.Version)
+		return
+	}
+
+	var version string
+	switch v := value.(type) {
+	case string:
+		version = v
+	case float64:
+		version = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return
+	}
+	if !supportedVersion(version) {
+		return
+	}
+	switch {
+	case version != publiccode.Version:
+		f.set(key, publiccode.Version)
+		f.fix(utils.CodeDeprecatedKey, key, "upgraded %s from %s to %s", key, version, publiccode.Version)
+	case value != version:
+		f.set(key, version)
+		f.fix(utils.CodeInvalidType, key, "quoted %s %s", key, version)
+	}
+}
+
+func supportedVersion(version string) bool {
+	for _, v := range publiccode.SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseDate rewrites releaseDate as YYYY-MM-DD, unless
+// the format is ambiguous, e.g. 01/02/2020
+func (f *fixer) releaseDate() {
+	const key = "releaseDate"
+	value, ok := f.get(key)
+	s, isString := value.(string)
+	if !ok || !isString {
+		return
+	}
+	s = strings.TrimSpace(s)
+	if _, err := time.Parse("2006-01-02", s); err == nil && s == value {
+		return
+	}
+
+	dates := map[string]bool{}
+	for _, layout := range append([]string{"2006-01-02"}, dateLayouts...) {
+		if t, err := time.Parse(layout, s); err == nil {
+			dates[t.Format("2006-01-02")] = true
+		}
+	}
+	if len(dates) != 1 {
+		return
+	}
+	for date := range dates {
+		f.set(key, date)
+		f.fix(utils.CodeInvalidDate, key, "rewrote %s %q as %s", key, value, date)
+	}
+}
+
+// countries writes the country codes of key uppercase,
+// as ISO 3166-1 alpha-2 codes are
+func (f *fixer) countries(key string) {
+	value, _ := f.get(key)
+	codes, _ := value.([]interface{})
+	for i, code := range codes {
+		s, ok := code.(string)
+		if !ok {
+			continue
+		}
+		fixed := strings.ToUpper(strings.TrimSpace(s))
+		if fixed == s || len(fixed) != 2 {
+			continue
+		}
+		f.set(fmt.Sprintf("%s/%d", key, i), fixed)
+		f.fix(utils.CodeInvalidCountryCode, key, "rewrote country code %q as %q", s, fixed)
+	}
+}
+
+// get returns the value of key, e.g. legal/license or
+// intendedAudience/countries/0
+func (f *fixer) get(key string) (interface{}, bool) {
+	var value interface{} = f.document
+	for _, segment := range strings.Split(key, "/") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// set adds or replaces the value of key, adding missing parents
+func (f *fixer) set(key string, value interface{}) {
+	segments := strings.Split(key, "/")
+	f.parents(segments)
+
+	parent, _ := f.get(strings.Join(segments[:len(segments)-1], "/"))
+	if len(segments) == 1 {
+		parent = f.document
+	}
+	last := segments[len(segments)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		op := "add"
+		if _, ok := p[last]; ok {
+			op = "replace"
+		}
+		p[last] = value
+		f.operation(Operation{Op: op, Path: pointer(segments)}, value)
+	case []interface{}:
+		i, _ := strconv.Atoi(last)
+		p[i] = value
+		f.operation(Operation{Op: "replace", Path: pointer(segments)}, value)
+	}
+}
+
+// settable tells whether the parents of key are
+// mappings or missing, so set can add it
+func (f *fixer) settable(key string) bool {
+	var value interface{} = f.document
+	for _, segment := range strings.Split(key, "/") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = m[segment]; !ok {
+			return true
+		}
+	}
+	return true
+}
+
+// remove deletes key from its parent mapping,
+// and the parent itself when left empty
+func (f *fixer) remove(key string) {
+	segments := strings.Split(key, "/")
+	parent := f.parent(segments)
+	delete(parent, segments[len(segments)-1])
+	f.patch = append(f.patch, Operation{Op: "remove", Path: pointer(segments)})
+
+	if len(parent) == 0 && len(segments) > 1 {
+		f.remove(strings.Join(segments[:len(segments)-1], "/"))
+	}
+}
+
+// move renames from to key, adding missing parents
+func (f *fixer) move(from string, key string) {
+	fromSegments := strings.Split(from, "/")
+	fromParent := f.parent(fromSegments)
+	value := fromParent[fromSegments[len(fromSegments)-1]]
+
+	segments := strings.Split(key, "/")
+	f.parents(segments)
+	delete(fromParent, fromSegments[len(fromSegments)-1])
+	f.parent(segments)[segments[len(segments)-1]] = value
+	f.patch = append(f.patch, Operation{Op: "move", From: pointer(fromSegments), Path: pointer(segments)})
+}
+
+// parent returns the mapping containing the key of segments
+func (f *fixer) parent(segments []string) map[string]interface{} {
+	if len(segments) == 1 {
+		return f.document
+	}
+	parent, _ := f.get(strings.Join(segments[:len(segments)-1], "/"))
+	m, _ := parent.(map[string]interface{})
+	return m
+}
+
+// parents adds the missing mappings containing the key of segments,
+// down to the first existing value that is not a mapping
+func (f *fixer) parents(segments []string) {
+	m := f.document
+	for i, segment := range segments[:len(segments)-1] {
+		value, ok := m[segment]
+		if !ok {
+			value = map[string]interface{}{}
+			m[segment] = value
+			f.operation(Operation{Op: "add", Path: pointer(segments[:i+1])}, value)
+		}
+		if m, ok = value.(map[string]interface{}); !ok {
+			return
+		}
+	}
+}
+
+func (f *fixer) operation(op Operation, value interface{}) {
+	op.Value, _ = json.Marshal(value)
+	f.patch = append(f.patch, op)
+}
+
+// pointer returns the RFC 6901 JSON pointer of segments
+func pointer(segments []string) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		segment = strings.Replace(segment, "~", "~0", -1)
+		segment = strings.Replace(segment, "/", "~1", -1)
+		b.WriteString("/" + segment)
+	}
+	return b.String()
+}
+
+// walk calls fn for every key of m, recursively
+func walk(prefix string, m map[string]interface{}, fn func(key string)) {
+	for k, v := range m {
+		key := prefix + k
+		fn(key)
+		if child, ok := v.(map[string]interface{}); ok {
+			walk(key+"/", child, fn)
+		}
+	}
+}
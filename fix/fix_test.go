@@ -0,0 +1,184 @@
+package fix
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	doc := `publiccode-yaml-version: "0.1"
+name: Medusa
+releaseDate: 15/04/2017
+tags:
+  - cloud
+description:
+  it:
+    featureList:
+      - one
+intendedAudience:
+  onlyFor:
+    - public-administrations
+  countries:
+    - IT
+    - " de"
+    - fr
+it:
+  spid: true
+  conforme:
+    accessibile: true
+  designKit:
+    ui: true
+`
+	res, err := Apply([]byte(doc))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var fixed map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(res.Document, &fixed))
+	assert.Equal(t, "0.2", fixed["publiccodeYmlVersion"])
+	assert.NotContains(t, fixed, "publiccode-yaml-version")
+	assert.NotContains(t, fixed, "tags")
+	assert.Equal(t, "2017-04-15", fixed["releaseDate"])
+	assert.Equal(t, map[string]interface{}{"features": []interface{}{"one"}}, fixed["description"].(map[string]interface{})["it"])
+	assert.Equal(t, map[string]interface{}{"countries": []interface{}{"IT", "DE", "FR"}}, fixed["intendedAudience"])
+	assert.Equal(t, map[string]interface{}{
+		"piattaforme": map[string]interface{}{"spid": true},
+		"conforme":    map[string]interface{}{"lineeGuidaDesign": true},
+	}, fixed["it"])
+
+	var codes []string
+	for _, fix := range res.Fixes {
+		codes = append(codes, fix.Code+" "+fix.Key)
+	}
+	assert.ElementsMatch(t, []string{
+		"deprecated-key description/it/featureList",
+		"deprecated-key intendedAudience/onlyFor",
+		"deprecated-key it/conforme/accessibile",
+		"deprecated-key it/designKit/ui",
+		"deprecated-key it/spid",
+		"deprecated-key publiccode-yaml-version",
+		"deprecated-key tags",
+		"deprecated-key publiccodeYmlVersion",
+		"invalid-date releaseDate",
+		"invalid-country-code intendedAudience/countries",
+		"invalid-country-code intendedAudience/countries",
+	}, codes)
+
+	// the patch turns the original document into the fixed one
+	var original interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(doc), &original))
+	patched, err := applyPatch(original, res.Patch)
+	if assert.NoError(t, err) {
+		assert.Equal(t, interface{}(fixed), patched)
+	}
+}
+
+func TestApplyUnambiguous(t *testing.T) {
+	for value, want := range map[string]string{
+		"2017-04-15":     "2017-04-15",
+		"2017/04/15":     "2017-04-15",
+		"15.04.2017":     "2017-04-15",
+		"04/04/2017":     "2017-04-04",
+		"05/04/2017":     "05/04/2017",
+		"15 April 2017":  "2017-04-15",
+		"April 15, 2017": "2017-04-15",
+		"yesterday":      "yesterday",
+	} {
+		res, err := Apply([]byte("publiccodeYmlVersion: '0.2'\nreleaseDate: " + value))
+		if !assert.NoError(t, err, value) {
+			continue
+		}
+		var fixed map[string]interface{}
+		assert.NoError(t, yaml.Unmarshal(res.Document, &fixed))
+		assert.Equal(t, want, fixed["releaseDate"], value)
+		if want == value {
+			assert.Empty(t, res.Fixes, value)
+			assert.Empty(t, res.Patch, value)
+		}
+	}
+}
+
+func TestApplyVersion(t *testing.T) {
+	res, err := Apply([]byte("name: Medusa"))
+	if assert.NoError(t, err) && assert.Len(t, res.Patch, 1) {
+		assert.Equal(t, "missing-key", res.Fixes[0].Code)
+		assert.Equal(t, Operation{Op: "add", Path: "/publiccodeYmlVersion", Value: json.RawMessage(`"0.2"`)}, res.Patch[0])
+	}
+
+	res, err = Apply([]byte("publiccodeYmlVersion: 0.2"))
+	if assert.NoError(t, err) && assert.Len(t, res.Fixes, 1) {
+		assert.Equal(t, "invalid-type", res.Fixes[0].Code)
+		assert.Equal(t, "replace", res.Patch[0].Op)
+	}
+
+	// a legacy version is renamed and upgraded, not missing
+	res, err = Apply([]byte("publiccode-yaml-version: '0.1'"))
+	if assert.NoError(t, err) && assert.Len(t, res.Fixes, 2) {
+		assert.Equal(t, Fix{Code: "deprecated-key", Key: "publiccode-yaml-version", Description: "renamed publiccode-yaml-version to publiccodeYmlVersion"}, res.Fixes[0])
+		assert.Equal(t, Fix{Code: "deprecated-key", Key: "publiccodeYmlVersion", Description: "upgraded publiccodeYmlVersion from 0.1 to 0.2"}, res.Fixes[1])
+	}
+
+	// the new key exists, the legacy one is left for the user
+	res, err = Apply([]byte("publiccodeYmlVersion: '0.2'\nit:\n  spid: true\n  piattaforme:\n    spid: false"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, res.Fixes)
+	}
+
+	_, err = Apply([]byte("- a list"))
+	assert.Error(t, err)
+}
+
+// applyPatch applies the operations used by Apply to doc
+func applyPatch(doc interface{}, patch []Operation) (interface{}, error) {
+	for _, op := range patch {
+		var value interface{}
+		switch op.Op {
+		case "add", "replace":
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, err
+			}
+		case "move":
+			parent, key := locate(doc, op.From)
+			value = parent.(map[string]interface{})[key]
+			delete(parent.(map[string]interface{}), key)
+		case "remove":
+			parent, key := locate(doc, op.Path)
+			delete(parent.(map[string]interface{}), key)
+			continue
+		}
+		parent, key := locate(doc, op.Path)
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[key] = value
+		case []interface{}:
+			i, _ := strconv.Atoi(key)
+			p[i] = value
+		}
+	}
+	return doc, nil
+}
+
+// locate returns the parent of the value at pointer and its key
+func locate(doc interface{}, pointer string) (interface{}, string) {
+	segments := strings.Split(pointer, "/")[1:]
+	for i := range segments {
+		segments[i] = strings.Replace(strings.Replace(segments[i], "~1", "/", -1), "~0", "~", -1)
+	}
+	parent := doc
+	for _, segment := range segments[:len(segments)-1] {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			parent = p[segment]
+		case []interface{}:
+			i, _ := strconv.Atoi(segment)
+			parent = p[i]
+		}
+	}
+	return parent, segments[len(segments)-1]
+}
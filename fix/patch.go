@@ -0,0 +1,312 @@
+package fix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// PatchYAML applies patch to doc working on YAML nodes, so comments,
+// order of keys and styles of the values left alone are kept.
+// JSON documents are returned as block YAML
+func PatchYAML(doc []byte, patch []Operation) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the document is not a YAML mapping")
+	}
+	if trimmed := bytes.TrimSpace(doc); trimmed[0] == '{' {
+		blockStyle(&root)
+	}
+
+	for _, op := range patch {
+		if err := applyOperation(root.Content[0], op); err != nil {
+			return nil, fmt.Errorf("%s %s: %v", op.Op, op.Path, err)
+		}
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return nil, err
+	}
+	encoder.Close()
+	return keepBlankLines(doc, b.Bytes()), nil
+}
+
+// keepBlankLines adds to out the blank lines separating the keys of doc,
+// which the YAML encoder drops. Keys are matched by path
+func keepBlankLines(doc []byte, out []byte) []byte {
+	var original, encoded yaml.Node
+	if yaml.Unmarshal(doc, &original) != nil || yaml.Unmarshal(out, &encoded) != nil {
+		return out
+	}
+
+	docLines := strings.Split(string(doc), "\n")
+	separated := map[string]bool{}
+	walkKeys("", &original, func(path string, key *yaml.Node) {
+		if first := firstLine(docLines, key.Line); first > 1 && strings.TrimSpace(docLines[first-2]) == "" {
+			separated[path] = true
+		}
+	})
+
+	outLines := strings.Split(string(out), "\n")
+	var blanks []int
+	walkKeys("", &encoded, func(path string, key *yaml.Node) {
+		if separated[path] {
+			blanks = append(blanks, firstLine(outLines, key.Line))
+		}
+	})
+	sort.Sort(sort.Reverse(sort.IntSlice(blanks)))
+	for _, line := range blanks {
+		if line > 1 && strings.TrimSpace(outLines[line-2]) != "" {
+			outLines = append(outLines[:line-1], append([]string{""}, outLines[line-1:]...)...)
+		}
+	}
+	return []byte(strings.Join(outLines, "\n"))
+}
+
+// firstLine returns the line of the comments above line,
+// line itself if there are none. Lines start from 1
+func firstLine(lines []string, line int) int {
+	for line > 1 && strings.HasPrefix(strings.TrimSpace(lines[line-2]), "#") {
+		line--
+	}
+	return line
+}
+
+// walkKeys calls fn for every key of the block mappings in node
+func walkKeys(prefix string, node *yaml.Node, fn func(path string, key *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkKeys(prefix, child, fn)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			walkKeys(prefix+strconv.Itoa(i)+"/", child, fn)
+		}
+	case yaml.MappingNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			path := prefix + node.Content[i].Value
+			fn(path, node.Content[i])
+			walkKeys(path+"/", node.Content[i+1], fn)
+		}
+	}
+}
+
+func applyOperation(root *yaml.Node, op Operation) error {
+	switch op.Op {
+	case "add", "replace":
+		var v interface{}
+		if err := json.Unmarshal(op.Value, &v); err != nil {
+			return err
+		}
+		var value yaml.Node
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+		// empty mappings would stay in flow style once filled
+		value.Style &^= yaml.FlowStyle
+		return set(root, splitPointer(op.Path), &value, op.Op == "replace")
+	case "remove":
+		_, _, err := take(root, splitPointer(op.Path))
+		return err
+	case "move":
+		from, to := splitPointer(op.From), splitPointer(op.Path)
+		parent, err := lookupNode(root, from[:len(from)-1])
+		if err != nil {
+			return err
+		}
+		// renames keep the position of the key
+		if equalSegments(from[:len(from)-1], to[:len(to)-1]) && parent.Kind == yaml.MappingNode {
+			if i := keyIndex(parent, to[len(to)-1]); i >= 0 {
+				return fmt.Errorf("%s exists", op.Path)
+			}
+			if i := keyIndex(parent, from[len(from)-1]); i >= 0 {
+				parent.Content[i].Value = to[len(to)-1]
+				return nil
+			}
+			return fmt.Errorf("%s not found", op.From)
+		}
+		key, value, err := take(root, from)
+		if err != nil {
+			return err
+		}
+		if err := set(root, to, value, false); err != nil {
+			return err
+		}
+		if key != nil {
+			// keep the comments of the key
+			target, _ := lookupNode(root, to[:len(to)-1])
+			if i := keyIndex(target, to[len(to)-1]); i >= 0 {
+				key.Value = to[len(to)-1]
+				target.Content[i] = key
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported operation")
+}
+
+// set adds or replaces the value at segments. Replaced scalars
+// are changed in place, keeping their comments and style when
+// the type doesn't change
+func set(root *yaml.Node, segments []string, value *yaml.Node, replace bool) error {
+	parent, err := lookupNode(root, segments[:len(segments)-1])
+	if err != nil {
+		return err
+	}
+	last := segments[len(segments)-1]
+
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if i := keyIndex(parent, last); i >= 0 {
+			replaceNode(parent.Content[i+1], value)
+			return nil
+		}
+		if replace {
+			return fmt.Errorf("%s not found", last)
+		}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, value)
+		return nil
+	case yaml.SequenceNode:
+		if last == "-" && !replace {
+			parent.Content = append(parent.Content, value)
+			return nil
+		}
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i > len(parent.Content) || (replace && i == len(parent.Content)) {
+			return fmt.Errorf("invalid index %s", last)
+		}
+		if replace {
+			replaceNode(parent.Content[i], value)
+			return nil
+		}
+		parent.Content = append(parent.Content[:i], append([]*yaml.Node{value}, parent.Content[i:]...)...)
+		return nil
+	}
+	return fmt.Errorf("%s is not a container", strings.Join(segments[:len(segments)-1], "/"))
+}
+
+// replaceNode changes old into value, keeping its comments
+func replaceNode(old *yaml.Node, value *yaml.Node) {
+	if old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode {
+		if old.ShortTag() != value.ShortTag() {
+			old.Style = value.Style
+		}
+		old.Tag = value.Tag
+		old.Value = value.Value
+		return
+	}
+	value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	*old = *value
+}
+
+// take removes the value at segments from its parent and returns
+// it, with its key when the parent is a mapping
+func take(root *yaml.Node, segments []string) (*yaml.Node, *yaml.Node, error) {
+	parent, err := lookupNode(root, segments[:len(segments)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := segments[len(segments)-1]
+
+	switch parent.Kind {
+	case yaml.MappingNode:
+		i := keyIndex(parent, last)
+		if i < 0 {
+			return nil, nil, fmt.Errorf("%s not found", last)
+		}
+		key, value := parent.Content[i], parent.Content[i+1]
+		parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+		return key, value, nil
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(parent.Content) {
+			return nil, nil, fmt.Errorf("invalid index %s", last)
+		}
+		value := parent.Content[i]
+		parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+		return nil, value, nil
+	}
+	return nil, nil, fmt.Errorf("%s is not a container", strings.Join(segments[:len(segments)-1], "/"))
+}
+
+// lookupNode returns the node at segments
+func lookupNode(node *yaml.Node, segments []string) (*yaml.Node, error) {
+	for n, segment := range segments {
+		switch node.Kind {
+		case yaml.MappingNode:
+			i := keyIndex(node, segment)
+			if i < 0 {
+				return nil, fmt.Errorf("%s not found", strings.Join(segments[:n+1], "/"))
+			}
+			node = node.Content[i+1]
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return nil, fmt.Errorf("invalid index %s", segment)
+			}
+			node = node.Content[i]
+		default:
+			return nil, fmt.Errorf("%s is not a container", strings.Join(segments[:n], "/"))
+		}
+	}
+	return node, nil
+}
+
+// keyIndex returns the index of key in the content of a mapping, -1 if missing
+func keyIndex(mapping *yaml.Node, key string) int {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitPointer returns the unescaped segments of an RFC 6901 pointer
+func splitPointer(pointer string) []string {
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		segment = strings.Replace(segment, "~1", "/", -1)
+		segments[i] = strings.Replace(segment, "~0", "~", -1)
+	}
+	return segments
+}
+
+func equalSegments(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// blockStyle turns flow collections and quoted strings,
+// e.g. of a JSON document, into plain YAML
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
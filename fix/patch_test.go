@@ -0,0 +1,76 @@
+package fix
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchYAML(t *testing.T) {
+	doc := `# head
+a: 1 # one
+
+b:
+  # c
+  c: x
+list:
+  - one
+  - two
+`
+	out, err := PatchYAML([]byte(doc), []Operation{
+		{Op: "replace", Path: "/a", Value: json.RawMessage(`"1.0"`)},
+		{Op: "move", From: "/b/c", Path: "/b/d"},
+		{Op: "add", Path: "/e", Value: json.RawMessage(`{}`)},
+		{Op: "move", From: "/b/d", Path: "/e/f"},
+		{Op: "remove", Path: "/list/0"},
+		{Op: "add", Path: "/list/-", Value: json.RawMessage(`"three"`)},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `# head
+a: "1.0" # one
+
+b: {}
+list:
+  - two
+  - three
+e:
+  # c
+  f: x
+`, string(out))
+	}
+
+	out, err = PatchYAML([]byte(`{"a": "1", "b": {"c": [true]}}`), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a: \"1\"\nb:\n  c:\n    - true\n", string(out))
+	}
+
+	_, err = PatchYAML([]byte("a: 1"), []Operation{{Op: "replace", Path: "/b", Value: json.RawMessage(`1`)}})
+	assert.EqualError(t, err, "replace /b: b not found")
+}
+
+func TestPreserve(t *testing.T) {
+	doc := `publiccodeYmlVersion: "0.1" # version
+softwareType: standalone
+tags: [a]
+description:
+  en:
+    featureList: [one] # features
+`
+	normalized := `publiccodeYmlVersion: "0.2"
+softwareType: standalone/other
+intendedAudience: {}
+description:
+  en:
+    features: [one]
+`
+	out, err := Preserve([]byte(doc), []byte(normalized))
+	if assert.NoError(t, err) {
+		assert.Equal(t, `publiccodeYmlVersion: "0.2" # version
+softwareType: standalone/other
+description:
+  en:
+    features: [one] # features
+`, string(out))
+	}
+}
@@ -0,0 +1,91 @@
+package fix
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+)
+
+// Preserve returns doc with the edits that turn it into normalized,
+// the document returned by the parser: legacy keys renamed or removed,
+// publiccodeYmlVersion upgraded and values normalized. Keys added by
+// the parser with their default value are left out, comments and
+// order of keys are kept
+func Preserve(doc []byte, normalized []byte) ([]byte, error) {
+	original, err := jsonTree(doc)
+	if err != nil {
+		return nil, err
+	}
+	target, err := jsonTree(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	f := fixer{document: original}
+	f.legacyKeys()
+	const version = "publiccodeYmlVersion"
+	if _, ok := original[version]; !ok {
+		if v, ok := target[version]; ok {
+			f.set(version, v)
+		}
+	}
+	f.diff("", original, target)
+
+	return PatchYAML(doc, f.patch)
+}
+
+// diff replaces the values of original that differ from the ones of
+// target. Keys missing in target are left alone, key is the path of
+// the values, empty for the document
+func (f *fixer) diff(key string, original interface{}, target interface{}) {
+	switch o := original.(type) {
+	case map[string]interface{}:
+		if t, ok := target.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(o))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if v, ok := t[k]; ok {
+					f.diff(join(key, k), o[k], v)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if t, ok := target.([]interface{}); ok && len(o) == len(t) {
+			for i := range o {
+				f.diff(join(key, strconv.Itoa(i)), o[i], t[i])
+			}
+			return
+		}
+	}
+	if key != "" && !reflect.DeepEqual(original, target) {
+		f.set(key, target)
+	}
+}
+
+func join(key string, segment string) string {
+	if key == "" {
+		return segment
+	}
+	return key + "/" + segment
+}
+
+// jsonTree decodes a YAML or JSON mapping into JSON types
+func jsonTree(doc []byte) (map[string]interface{}, error) {
+	j, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(j, &tree); err != nil || tree == nil {
+		return nil, errors.New("the document is not a YAML mapping")
+	}
+	return tree, nil
+}
@@ -3,16 +3,21 @@ module github.com/italia/publiccode-validator
 go 1.12
 
 require (
+	github.com/alranel/go-spdx v0.0.5
 	github.com/alranel/go-vcsurl v0.0.0-20201009104729-56346a70f40a
 	github.com/dyatlov/go-oembed v0.0.0-20191103150536-a57c85b3b37c // indirect
 	github.com/ghodss/yaml v1.0.0
 	github.com/gorilla/mux v1.7.3
 	github.com/italia/httpclient-lib-go v0.0.1 // indirect
 	github.com/italia/publiccode-parser-go v1.2.2
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v1.7.1
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.4.0
 	github.com/thoas/go-funk v0.7.0 // indirect
+	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/sys v0.0.0-20201029080932-201ba4db2418 // indirect
 	golang.org/x/text v0.3.4 // indirect
 	gopkg.in/yaml.v2 v2.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// parserModule is the module of the parser library
+const parserModule = "github.com/italia/publiccode-parser-go"
+
+// readinessHost is resolved by /readyz when network is enabled,
+// most remote files are fetched from there
+const readinessHost = "raw.githubusercontent.com"
+
+// readinessDocument is validated by /readyz to check the parser,
+// replaced by tests
+var readinessDocument = []byte(`publiccodeYmlVersion: "0.1"
+
+name: Medusa
+url: "https://github.com/italia/developers.italia.it.git"
+softwareVersion: "dev"
+releaseDate: "2017-04-15"
+
+platforms:
+  - web
+
+categories:
+  - cloud-management
+
+developmentStatus: development
+
+softwareType: "standalone"
+
+description:
+  en:
+    genericName: Text Editor
+    shortDescription: A rather short description which is probably useless
+    longDescription: >
+      Very long description of this software, also split
+      on multiple rows. You should note what the software
+      is and why one should need it. This is 158 characters.
+      Very long description of this software, also split
+      on multiple rows. You should note what the software
+      is and why one should need it. This is 316 characters.
+      Very long description of this software, also split
+      on multiple rows. You should note what the software
+      is and why one should need it. This is 474 characters.
+      Very long description of this software, also split
+      on multiple rows. You should note what the software
+      is and why one should need it. This is 632 characters.
+    features:
+      - Just one feature
+
+legal:
+  license: AGPL-3.0-or-later
+
+maintenance:
+  type: "community"
+  contacts:
+    - name: Francesco Rossi
+
+localisation:
+  localisationReady: yes
+  availableLanguages:
+    - en
+`)
+
+// lookupHost resolves host names, replaced by tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// Health is the body of /healthz and /readyz
+type Health struct {
+	Status string `json:"status"`
+	// Checks maps every check of /readyz to ok,
+	// disabled or the error
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Version is the body of /api/v1/version
+type Version struct {
+	Version       string `json:"version"`
+	Date          string `json:"date"`
+	ParserVersion string `json:"parserVersion"`
+	// PubliccodeYmlVersions are the supported publiccodeYmlVersion,
+	// documents are upgraded to PubliccodeYmlVersion
+	PubliccodeYmlVersions []string `json:"publiccodeYmlVersions"`
+	PubliccodeYmlVersion  string   `json:"publiccodeYmlVersion"`
+}
+
+// healthz reports that the server is alive
+func (app *App) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Health{Status: "ok"})
+}
+
+// readyz reports whether the server can validate documents:
+// the parser validates readinessDocument and, when network is
+// enabled, remote hosts can be resolved
+func (app *App) readyz(w http.ResponseWriter, r *http.Request) {
+	health := Health{Status: "ok", Checks: map[string]string{}}
+
+	health.Checks["parser"] = "ok"
+	opts := utils.DefaultOptions()
+	opts.DisableNetwork = true
+	_, err, errConverting := app.parse(readinessDocument, opts)
+	if errConverting != nil {
+		err = errConverting
+	}
+	if err != nil {
+		log.Errorf("readiness: %v", err)
+		health.Checks["parser"] = err.Error()
+		health.Status = "unavailable"
+	}
+
+	health.Checks["network"] = "disabled"
+	if !app.Config.DisableNetwork {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		health.Checks["network"] = "ok"
+		if _, err := lookupHost(ctx, readinessHost); err != nil {
+			log.Errorf("readiness: %v", err)
+			health.Checks["network"] = err.Error()
+			health.Status = "unavailable"
+		}
+	}
+
+	status := http.StatusOK
+	if health.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, health)
+}
+
+// versionInfo returns the validator and parser versions
+func (app *App) versionInfo(w http.ResponseWriter, r *http.Request) {
+	utils.SetupResponse(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+	writeJSON(w, http.StatusOK, Version{
+		Version:               version,
+		Date:                  date,
+		ParserVersion:         parserVersion(),
+		PubliccodeYmlVersions: publiccode.SupportedVersions,
+		PubliccodeYmlVersion:  publiccode.Version,
+	})
+}
+
+// parserVersion returns the version of the parser library
+// the binary was built with
+func parserVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path != parserModule {
+				continue
+			}
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
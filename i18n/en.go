@@ -0,0 +1,84 @@
+package i18n
+
+import "github.com/italia/publiccode-validator/utils"
+
+var en = Catalog{
+	Messages: map[string]string{
+		// responses
+		"Valid":                  "Valid",
+		"Validation Errors":      "Validation Errors",
+		"Error converting":       "Error converting",
+		"URL error":              "URL error",
+		"Empty payload":          "Empty payload",
+		"Error reading body":     "Error reading body",
+		"Request body too large": "Request body too large",
+		"Error reading batch":    "Error reading batch",
+		"Not acceptable":         "Not acceptable",
+		"Error fixing":           "Error fixing",
+		"Unsupported version":    "Unsupported version",
+		"Error comparing":        "Error comparing",
+		"Invalid ref":            "Invalid ref",
+		"URL refused":            "URL refused",
+		"Conversion to json ko":  "Conversion to json ko",
+
+		// reports
+		"1 error":                "1 error",
+		"%d errors":              "%d errors",
+		"1 warning":              "1 warning",
+		"%d warnings":            "%d warnings",
+		"Error":                  "Error",
+		"Warning":                "Warning",
+		"line %d, column %d":     "line %d, column %d",
+		"See %s":                 "See %s",
+		"Specification":          "Specification",
+		"Read the specification": "Read the specification",
+
+		// sections of reports
+		"General":           "General",
+		"Description":       "Description",
+		"Legal":             "Legal",
+		"Maintenance":       "Maintenance",
+		"Localisation":      "Localisation",
+		"Intended audience": "Intended audience",
+		"Dependencies":      "Dependencies",
+		"Italy":             "Italy",
+		"Name, repository, logo and status of the software.":                  "Name, repository, logo and status of the software.",
+		"What the software does, in every language of the catalog.":           "What the software does, in every language of the catalog.",
+		"License and copyright owners of the software.":                       "License and copyright owners of the software.",
+		"Who maintains the software and how to contact them.":                 "Who maintains the software and how to contact them.",
+		"Languages the software is available in.":                             "Languages the software is available in.",
+		"Who the software is designed for.":                                   "Who the software is designed for.",
+		"Software and hardware needed to run the software.":                   "Software and hardware needed to run the software.",
+		"Information required by the Italian extension of the specification.": "Information required by the Italian extension of the specification.",
+	},
+	Explanations: map[string]string{
+		utils.CodeInvalidKey:            "This key is not allowed here.",
+		utils.CodeUnknownKey:            "This key is not part of the specification, check it for typos or remove it.",
+		utils.CodeMissingKey:            "This key is mandatory, add it to the file.",
+		utils.CodeUnsupportedVersion:    "This version of the specification is not supported, use the latest one.",
+		utils.CodeInvalidType:           "The value has the wrong type, e.g. a single value where a list is expected.",
+		utils.CodeInvalidValue:          "The value is not valid for this key.",
+		utils.CodeInvalidURL:            "The value must be a complete URL, starting with https://.",
+		utils.CodeUnreachableURL:        "The URL can't be reached, check that it exists and is public.",
+		utils.CodeURLOutsideRepository:  "The file must be in the same repository of publiccode.yml.",
+		utils.CodeFileNotFound:          "The file doesn't exist, check its path relative to the repository root.",
+		utils.CodeInvalidFileExtension:  "This kind of file is not accepted here.",
+		utils.CodeInvalidImageSize:      "The image is too small, check the size required by the specification.",
+		utils.CodeInvalidMonochrome:     "The monochrome logo must use a single color.",
+		utils.CodeTooLong:               "The text is too long, shorten it.",
+		utils.CodeTooShort:              "The text is too short, describe the software in more detail.",
+		utils.CodeInvalidDate:           "Dates must be written as YYYY-MM-DD, e.g. 2020-10-01.",
+		utils.CodeInvalidEmail:          "The value must be an email address.",
+		utils.CodeInvalidMIME:           "The value must be a MIME type, e.g. text/csv.",
+		utils.CodeInvalidLicense:        "The license must be an SPDX expression, e.g. AGPL-3.0-or-later.",
+		utils.CodeInvalidCategory:       "The category is not in the list of the specification.",
+		utils.CodeInvalidScope:          "The scope is not in the list of the specification.",
+		utils.CodeInvalidLanguageCode:   "Languages must be written as codes, e.g. en or it.",
+		utils.CodeInvalidCountryCode:    "Countries must be written as two letter codes, e.g. IT.",
+		utils.CodeInvalidCodiceIPA:      "The IPA code doesn't belong to any public administration.",
+		utils.CodeInvalidOEmbed:         "The video must be on a platform supporting oEmbed, e.g. YouTube or Vimeo.",
+		utils.CodeDeprecatedKey:         "This key comes from an older version of the specification, update it.",
+		utils.CodeMissingRecommendedKey: "This key is not mandatory, but it makes the software easier to find and evaluate.",
+		utils.CodeInsecureURL:           "Use an https:// URL, if the site supports it.",
+	},
+}
@@ -0,0 +1,135 @@
+// Package i18n translates the messages of responses. Catalogs are
+// keyed on the English messages and on the stable validation error
+// codes, so clients relying on codes are not affected
+package i18n
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/italia/publiccode-validator/utils"
+)
+
+// Default is the language of responses when
+// the client doesn't ask for a supported one
+const Default = "en"
+
+// Catalog holds the translations of a language
+type Catalog struct {
+	// Messages by English message: titles of responses and
+	// words of reports. The English catalog lists all of them
+	Messages map[string]string
+	// Reasons of validation errors by code. They replace the
+	// English reasons of the parser, moved to Detail with their
+	// details like URLs, statuses and limits. The English
+	// catalog has none
+	Reasons map[string]string
+	// Explanations of validation errors by code, used by reports
+	Explanations map[string]string
+}
+
+// catalogs by language code
+var catalogs = map[string]Catalog{
+	"en": en,
+	"it": it,
+}
+
+// Languages returns the supported language codes
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	return languages
+}
+
+// Get returns the catalog of lang, the default one if not supported
+func Get(lang string) Catalog {
+	if c, ok := catalogs[lang]; ok {
+		return c
+	}
+	return catalogs[Default]
+}
+
+// T returns the translation of the English message s,
+// s itself when missing
+func (c Catalog) T(s string) string {
+	if t, ok := c.Messages[s]; ok {
+		return t
+	}
+	return s
+}
+
+// FromRequest returns the language of the response to r: the lang
+// query parameter when supported, otherwise the one preferred by the
+// Accept-Language header
+func FromRequest(r *http.Request) string {
+	if lang := strings.ToLower(r.URL.Query().Get("lang")); lang != "" {
+		if _, ok := catalogs[lang]; ok {
+			return lang
+		}
+	}
+	return Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// Negotiate returns the supported language preferred by an
+// Accept-Language header (RFC 7231 section 5.3.5). Tags match by
+// primary subtag, e.g. it-IT is it. Ties are broken by order
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := Default, 0.0
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(item, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if i := strings.Index(tag, "-"); i >= 0 {
+			tag = tag[:i]
+		}
+		if tag == "*" {
+			tag = Default
+		}
+		if _, ok := catalogs[tag]; !ok {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil || v < 0 || v > 1 {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// Localize returns message translated in lang
+func Localize(message utils.Message, lang string) utils.Message {
+	message.Message = Get(lang).T(message.Message)
+	message.ValidationError = LocalizeErrors(message.ValidationError, lang)
+	message.Warnings = LocalizeErrors(message.Warnings, lang)
+	return message
+}
+
+// LocalizeErrors returns a copy of errs with reasons translated
+// in lang, the reasons of the parser are kept in Detail
+func LocalizeErrors(errs []utils.ErrorInvalidValue, lang string) []utils.ErrorInvalidValue {
+	c := Get(lang)
+	if len(errs) == 0 || len(c.Reasons) == 0 {
+		return errs
+	}
+	localized := make([]utils.ErrorInvalidValue, len(errs))
+	for i, e := range errs {
+		if reason, ok := c.Reasons[e.Code]; ok {
+			e.Reason, e.Detail = reason, e.Reason
+		}
+		localized[i] = e
+	}
+	return localized
+}
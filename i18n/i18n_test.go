@@ -0,0 +1,94 @@
+package i18n
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/italia/publiccode-validator/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogs(t *testing.T) {
+	for lang, c := range catalogs {
+		for _, code := range utils.Codes {
+			assert.NotEmpty(t, c.Explanations[code], "%s explanation of %s", lang, code)
+			if lang != Default {
+				assert.NotEmpty(t, c.Reasons[code], "%s reason of %s", lang, code)
+			}
+		}
+		for message := range catalogs[Default].Messages {
+			assert.NotEmpty(t, c.Messages[message], "%s translation of %q", lang, message)
+		}
+		assert.Len(t, c.Messages, len(catalogs[Default].Messages), lang)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                        "en",
+		"it":                      "it",
+		"it-IT,it;q=0.9,en;q=0.8": "it",
+		"en-US,en;q=0.9,it;q=0.8": "en",
+		"fr, it;q=0.5":            "it",
+		"fr":                      "en",
+		"*":                       "en",
+		"IT-it":                   "it",
+		"en;q=0.2, it;q=0.7":      "it",
+		"it;q=0, en;q=0.1":        "en",
+		"it;q=nonsense, en;q=0.1": "en",
+	} {
+		assert.Equal(t, want, Negotiate(header), header)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?lang=it", nil)
+	r.Header.Set("Accept-Language", "en")
+	assert.Equal(t, "it", FromRequest(r))
+
+	r = httptest.NewRequest("GET", "/?lang=xx", nil)
+	r.Header.Set("Accept-Language", "it-IT")
+	assert.Equal(t, "it", FromRequest(r))
+}
+
+func TestLocalize(t *testing.T) {
+	message := utils.Message{
+		Status:  422,
+		Message: "Validation Errors",
+		ValidationError: []utils.ErrorInvalidValue{
+			{Key: "legal/license", Reason: "invalid license", Code: utils.CodeInvalidLicense},
+			{Key: "foo", Reason: "no code"},
+		},
+	}
+
+	localized := Localize(message, "it")
+	assert.Equal(t, "Errori di validazione", localized.Message)
+	assert.Equal(t, "licenza non valida", localized.ValidationError[0].Reason)
+	assert.Equal(t, "invalid license", localized.ValidationError[0].Detail)
+	assert.Equal(t, "no code", localized.ValidationError[1].Reason)
+	// the original is not modified
+	assert.Equal(t, "invalid license", message.ValidationError[0].Reason)
+
+	assert.Equal(t, message, Localize(message, "en"))
+}
+
+func TestLocalizeDetails(t *testing.T) {
+	errs := []utils.ErrorInvalidValue{
+		{Key: "logo", Reason: "HTTP GET returned 404 for https://example.org/logo.png; 200 is required", Code: utils.CodeUnreachableURL},
+		{Key: "description/en/shortDescription", Reason: "too long (max 150 chars, got 160)", Code: utils.CodeTooLong},
+		{Key: "logo", Reason: "invalid image size of 10x10 (min 1000px of width)", Code: utils.CodeInvalidImageSize},
+		{Key: "name", Reason: "missing mandatory key", Code: utils.CodeMissingKey},
+	}
+
+	localized := LocalizeErrors(errs, "it")
+	// reasons are fully translated, details are in Detail
+	assert.Equal(t, "URL non raggiungibile", localized[0].Reason)
+	assert.Equal(t, "HTTP GET returned 404 for https://example.org/logo.png; 200 is required", localized[0].Detail)
+	assert.Equal(t, "testo troppo lungo", localized[1].Reason)
+	assert.Equal(t, "too long (max 150 chars, got 160)", localized[1].Detail)
+	assert.Equal(t, "dimensioni dell'immagine non valide", localized[2].Reason)
+	assert.Equal(t, "invalid image size of 10x10 (min 1000px of width)", localized[2].Detail)
+	assert.Equal(t, "chiave obbligatoria mancante", localized[3].Reason)
+	// untranslated reasons have no detail
+	assert.Empty(t, LocalizeErrors(errs, "en")[0].Detail)
+}
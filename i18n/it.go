@@ -0,0 +1,114 @@
+package i18n
+
+import "github.com/italia/publiccode-validator/utils"
+
+var it = Catalog{
+	Messages: map[string]string{
+		// responses
+		"Valid":                  "Valido",
+		"Validation Errors":      "Errori di validazione",
+		"Error converting":       "Errore di conversione",
+		"URL error":              "Errore nell'URL",
+		"Empty payload":          "Richiesta vuota",
+		"Error reading body":     "Errore nella lettura della richiesta",
+		"Request body too large": "Richiesta troppo grande",
+		"Error reading batch":    "Errore nella lettura dei documenti",
+		"Not acceptable":         "Formato non disponibile",
+		"Error fixing":           "Errore nella correzione",
+		"Unsupported version":    "Versione non supportata",
+		"Error comparing":        "Errore nel confronto",
+		"Invalid ref":            "Riferimento non valido",
+		"URL refused":            "URL rifiutato",
+		"Conversion to json ko":  "Errore di conversione in JSON",
+
+		// reports
+		"1 error":                "1 errore",
+		"%d errors":              "%d errori",
+		"1 warning":              "1 avviso",
+		"%d warnings":            "%d avvisi",
+		"Error":                  "Errore",
+		"Warning":                "Avviso",
+		"line %d, column %d":     "riga %d, colonna %d",
+		"See %s":                 "Vedi %s",
+		"Specification":          "Standard",
+		"Read the specification": "Leggi lo standard",
+
+		// sections of reports
+		"General":           "Generale",
+		"Description":       "Descrizione",
+		"Legal":             "Licenza",
+		"Maintenance":       "Manutenzione",
+		"Localisation":      "Localizzazione",
+		"Intended audience": "Destinatari",
+		"Dependencies":      "Dipendenze",
+		"Italy":             "Italia",
+		"Name, repository, logo and status of the software.":                  "Nome, repository, logo e stato del software.",
+		"What the software does, in every language of the catalog.":           "Cosa fa il software, in ogni lingua del catalogo.",
+		"License and copyright owners of the software.":                       "Licenza e titolari del copyright del software.",
+		"Who maintains the software and how to contact them.":                 "Chi mantiene il software e come contattarlo.",
+		"Languages the software is available in.":                             "Lingue in cui è disponibile il software.",
+		"Who the software is designed for.":                                   "A chi è rivolto il software.",
+		"Software and hardware needed to run the software.":                   "Software e hardware necessari per usare il software.",
+		"Information required by the Italian extension of the specification.": "Informazioni richieste dall'estensione italiana dello standard.",
+	},
+	Reasons: map[string]string{
+		utils.CodeInvalidKey:            "chiave non ammessa",
+		utils.CodeUnknownKey:            "chiave sconosciuta",
+		utils.CodeMissingKey:            "chiave obbligatoria mancante",
+		utils.CodeUnsupportedVersion:    "versione non supportata",
+		utils.CodeInvalidType:           "tipo non valido",
+		utils.CodeInvalidValue:          "valore non valido",
+		utils.CodeInvalidURL:            "URL non valido",
+		utils.CodeUnreachableURL:        "URL non raggiungibile",
+		utils.CodeURLOutsideRepository:  "URL esterno al repository",
+		utils.CodeFileNotFound:          "file non trovato",
+		utils.CodeInvalidFileExtension:  "estensione del file non valida",
+		utils.CodeInvalidImageSize:      "dimensioni dell'immagine non valide",
+		utils.CodeInvalidMonochrome:     "logo monocromatico non valido",
+		utils.CodeTooLong:               "testo troppo lungo",
+		utils.CodeTooShort:              "testo troppo corto",
+		utils.CodeInvalidDate:           "data non valida",
+		utils.CodeInvalidEmail:          "indirizzo email non valido",
+		utils.CodeInvalidMIME:           "tipo MIME non valido",
+		utils.CodeInvalidLicense:        "licenza non valida",
+		utils.CodeInvalidCategory:       "categoria non valida",
+		utils.CodeInvalidScope:          "ambito non valido",
+		utils.CodeInvalidLanguageCode:   "codice di lingua non valido",
+		utils.CodeInvalidCountryCode:    "codice di paese non valido",
+		utils.CodeInvalidCodiceIPA:      "codice IPA non valido",
+		utils.CodeInvalidOEmbed:         "video non supportato da oEmbed",
+		utils.CodeDeprecatedKey:         "chiave deprecata",
+		utils.CodeMissingRecommendedKey: "chiave raccomandata mancante",
+		utils.CodeInsecureURL:           "URL non sicuro, usa https",
+	},
+	Explanations: map[string]string{
+		utils.CodeInvalidKey:            "Questa chiave non è ammessa in questo punto.",
+		utils.CodeUnknownKey:            "Questa chiave non fa parte dello standard, controlla che sia scritta correttamente o rimuovila.",
+		utils.CodeMissingKey:            "Questa chiave è obbligatoria, aggiungila al file.",
+		utils.CodeUnsupportedVersion:    "Questa versione dello standard non è supportata, usa la più recente.",
+		utils.CodeInvalidType:           "Il valore è del tipo sbagliato, ad esempio un valore singolo dove è prevista una lista.",
+		utils.CodeInvalidValue:          "Il valore non è valido per questa chiave.",
+		utils.CodeInvalidURL:            "Il valore deve essere un URL completo, che inizia con https://.",
+		utils.CodeUnreachableURL:        "L'URL non è raggiungibile, controlla che esista e sia pubblico.",
+		utils.CodeURLOutsideRepository:  "Il file deve trovarsi nello stesso repository di publiccode.yml.",
+		utils.CodeFileNotFound:          "Il file non esiste, controlla il percorso rispetto alla radice del repository.",
+		utils.CodeInvalidFileExtension:  "Questo tipo di file non è accettato qui.",
+		utils.CodeInvalidImageSize:      "L'immagine è troppo piccola, controlla le dimensioni richieste dallo standard.",
+		utils.CodeInvalidMonochrome:     "Il logo monocromatico deve usare un solo colore.",
+		utils.CodeTooLong:               "Il testo è troppo lungo, accorcialo.",
+		utils.CodeTooShort:              "Il testo è troppo corto, descrivi il software in modo più dettagliato.",
+		utils.CodeInvalidDate:           "Le date devono essere nel formato AAAA-MM-GG, ad esempio 2020-10-01.",
+		utils.CodeInvalidEmail:          "Il valore deve essere un indirizzo email.",
+		utils.CodeInvalidMIME:           "Il valore deve essere un tipo MIME, ad esempio text/csv.",
+		utils.CodeInvalidLicense:        "La licenza deve essere un'espressione SPDX, ad esempio AGPL-3.0-or-later.",
+		utils.CodeInvalidCategory:       "La categoria non è nell'elenco dello standard.",
+		utils.CodeInvalidScope:          "L'ambito non è nell'elenco dello standard.",
+		utils.CodeInvalidLanguageCode:   "Le lingue devono essere indicate con il loro codice, ad esempio it o en.",
+		utils.CodeInvalidCountryCode:    "I paesi devono essere indicati con il codice di due lettere, ad esempio IT.",
+		utils.CodeInvalidCodiceIPA:      "Il codice IPA non corrisponde a nessuna pubblica amministrazione.",
+		utils.CodeInvalidOEmbed:         "Il video deve essere su una piattaforma che supporta oEmbed, ad esempio YouTube o Vimeo.",
+		utils.CodeDeprecatedKey:         "Questa chiave viene da una versione precedente dello standard, aggiornala.",
+		utils.CodeMissingRecommendedKey: "Questa chiave non è obbligatoria, ma rende il software più facile da trovare e valutare.",
+		utils.CodeInsecureURL:           "Usa un URL https://, se il sito lo supporta.",
+	},
+}
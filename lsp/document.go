@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// document is a text document opened by the client
+type document struct {
+	version int
+	text    string
+}
+
+func (d *document) lines() []string {
+	lines := strings.Split(d.text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines
+}
+
+// keyLine matches a line with a key, e.g. `  - name: value`.
+// Keys are found by indentation rather than parsing, so that
+// documents being edited, often invalid, still work
+var keyLine = regexp.MustCompile(`^( *)((?:- +)*)([A-Za-z0-9_][A-Za-z0-9_./-]*|"[^"]*"|'[^']*') *:( +(.*))?$`)
+
+// blockScalar matches the indicator of literal and folded scalars
+var blockScalar = regexp.MustCompile(`^[|>][-+0-9]*\s*(#.*)?$`)
+
+type parsedKey struct {
+	// indent is the column of the key, after dashes of sequences
+	indent int
+	key    string
+	value  string
+}
+
+func parseKey(line string) (parsedKey, bool) {
+	m := keyLine.FindStringSubmatch(line)
+	if m == nil {
+		return parsedKey{}, false
+	}
+	return parsedKey{
+		indent: len(m[1]) + len(m[2]),
+		key:    strings.Trim(m[3], `"'`),
+		value:  strings.TrimSpace(m[5]),
+	}, true
+}
+
+// parentPath returns the path of the keys containing a line
+// indented by indent, looking at lines before n. ok is false
+// if the line is inside a block scalar
+func parentPath(lines []string, n int, indent int) (path []string, ok bool) {
+	for i := n - 1; i >= 0 && indent > 0; i-- {
+		k, isKey := parseKey(lines[i])
+		if !isKey || k.indent >= indent {
+			continue
+		}
+		if blockScalar.MatchString(k.value) {
+			return nil, false
+		}
+		path = append([]string{k.key}, path...)
+		indent = k.indent
+	}
+	return path, true
+}
+
+// keyPath returns the path of the key defined on line n
+func keyPath(lines []string, n int) ([]string, bool) {
+	if n < 0 || n >= len(lines) {
+		return nil, false
+	}
+	k, ok := parseKey(lines[n])
+	if !ok {
+		return nil, false
+	}
+	path, ok := parentPath(lines, n, k.indent)
+	if !ok {
+		return nil, false
+	}
+	return append(path, k.key), true
+}
+
+// listPath returns the path of the sequence containing the item
+// starting at column indent of line n, e.g. platforms for `  - web`
+func listPath(lines []string, n int, indent int) ([]string, bool) {
+	for i := n - 1; i >= 0; i-- {
+		k, isKey := parseKey(lines[i])
+		if !isKey {
+			continue
+		}
+		// keys of items of the same sequence
+		if k.indent > indent {
+			continue
+		}
+		if k.value != "" {
+			return nil, false
+		}
+		return keyPath(lines, i)
+	}
+	return nil, false
+}
+
+// runeIndex converts an LSP character offset of line, in UTF-16
+// code units, into an index of runes
+func runeIndex(line string, character int) int {
+	units := 0
+	for i, r := range []rune(line) {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len([]rune(line))
+}
+
+// character converts an index of runes of line into an LSP
+// character offset, in UTF-16 code units
+func character(line string, index int) int {
+	runes := []rune(line)
+	if index > len(runes) {
+		index = len(runes)
+	}
+	if index < 0 {
+		index = 0
+	}
+	return len(utf16.Encode(runes[:index]))
+}
@@ -0,0 +1,110 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server
+const (
+	codeParseError           = -32700
+	codeInvalidParams        = -32602
+	codeMethodNotFound       = -32601
+	codeServerNotInitialized = -32002
+	codeInvalidRequest       = -32600
+)
+
+// request is a JSON-RPC request, or a notification when ID is nil
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   responseError    `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// conn reads and writes messages framed by the LSP base protocol,
+// a Content-Length header followed by the JSON body
+type conn struct {
+	r  *textproto.Reader
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// read returns the next message, io.EOF when the client is gone
+func (c *conn) read() ([]byte, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends v, it's safe for concurrent use
+func (c *conn) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result interface{}) error {
+	return c.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (c *conn) replyError(id *json.RawMessage, code int, message string) error {
+	return c.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	return c.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
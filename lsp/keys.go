@@ -0,0 +1,184 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alranel/go-spdx/spdx"
+)
+
+// keyDoc documents a key of publiccode.yml. Keys use the same format
+// of the parser, with * for the language of description
+type keyDoc struct {
+	key    string
+	doc    string
+	values func() []string
+}
+
+func enum(values ...string) func() []string {
+	return func() []string { return values }
+}
+
+var licenses struct {
+	once sync.Once
+	ids  []string
+}
+
+// licenseIDs returns the SPDX identifiers accepted by legal/license
+func licenseIDs() []string {
+	licenses.once.Do(func() {
+		for _, l := range spdx.List() {
+			licenses.ids = append(licenses.ids, l.ID)
+		}
+		sort.Strings(licenses.ids)
+	})
+	return licenses.ids
+}
+
+var keyDocs = []keyDoc{
+	{key: "publiccodeYmlVersion", doc: "Version of the publiccode.yml specification used by the file.", values: enum("0.2")},
+	{key: "name", doc: "Name of the software, without the version."},
+	{key: "applicationSuite", doc: "Name of the suite the software belongs to."},
+	{key: "url", doc: "URL of the source code repository (git, svn...)."},
+	{key: "landingURL", doc: "URL of the landing page of the software, if different from the repository."},
+	{key: "isBasedOn", doc: "URLs of the original projects, if the software is a variant or a fork."},
+	{key: "softwareVersion", doc: "Latest stable version of the software."},
+	{key: "releaseDate", doc: "Date of the last release of the software, YYYY-MM-DD."},
+	{key: "logo", doc: "Path or URL of the logo, SVG or PNG at least 1000px wide."},
+	{key: "monochromeLogo", doc: "Path or URL of the monochrome (black) logo, SVG or PNG."},
+	{key: "inputTypes", doc: "MIME types of the files the software can read."},
+	{key: "outputTypes", doc: "MIME types of the files the software can write."},
+	{key: "platforms", doc: "Platforms the software runs on.", values: enum("web", "windows", "mac", "linux", "ios", "android")},
+	{key: "categories", doc: "Categories of the software, from the list of the specification."},
+	{key: "usedBy", doc: "Names of the public administrations using the software."},
+	{key: "roadmap", doc: "URL of the roadmap of the software."},
+	{key: "developmentStatus", doc: "Development status of the software.", values: enum("concept", "development", "beta", "stable", "obsolete")},
+	{key: "softwareType", doc: "Type of the software.", values: enum("standalone/mobile", "standalone/iot", "standalone/desktop",
+		"standalone/web", "standalone/backend", "standalone/other", "addon", "library", "configurationFiles")},
+
+	{key: "intendedAudience", doc: "Audience the software is designed for."},
+	{key: "intendedAudience/scope", doc: "Fields of application of the software, from the list of the specification."},
+	{key: "intendedAudience/countries", doc: "ISO 3166-1 alpha-2 codes of the countries the software is designed for."},
+	{key: "intendedAudience/unsupportedCountries", doc: "ISO 3166-1 alpha-2 codes of the countries where the software can't be used."},
+
+	{key: "description", doc: "Description of the software, under a key for every language (e.g. `en`, `it`)."},
+	{key: "description/*/localisedName", doc: "Name of the software in this language, if different."},
+	{key: "description/*/genericName", doc: "Generic name of the kind of software, max 35 chars (e.g. _Text Editor_)."},
+	{key: "description/*/shortDescription", doc: "One line description of the software, max 150 chars."},
+	{key: "description/*/longDescription", doc: "Description of the software, from 500 to 10000 chars."},
+	{key: "description/*/documentation", doc: "URL of the user documentation."},
+	{key: "description/*/apiDocumentation", doc: "URL of the API documentation."},
+	{key: "description/*/features", doc: "Main features of the software, max 100 chars each."},
+	{key: "description/*/screenshots", doc: "Paths or URLs of screenshots of the software."},
+	{key: "description/*/videos", doc: "URLs of videos showing the software, with oEmbed support."},
+	{key: "description/*/awards", doc: "Awards won by the software."},
+
+	{key: "legal", doc: "Legal information about the software."},
+	{key: "legal/license", doc: "SPDX expression of the license of the software (e.g. `AGPL-3.0-or-later`).", values: licenseIDs},
+	{key: "legal/mainCopyrightOwner", doc: "Entity that owns the copyright of most of the code."},
+	{key: "legal/repoOwner", doc: "Entity that owns the repository."},
+	{key: "legal/authorsFile", doc: "Path of the file listing the authors."},
+
+	{key: "maintenance", doc: "Who maintains the software."},
+	{key: "maintenance/type", doc: "How the software is maintained.", values: enum("internal", "contract", "community", "none")},
+	{key: "maintenance/contractors", doc: "Contractors in charge of the maintenance, for `contract` maintenance."},
+	{key: "maintenance/contractors/name", doc: "Name of the contractor."},
+	{key: "maintenance/contractors/until", doc: "Date the contract expires, YYYY-MM-DD."},
+	{key: "maintenance/contractors/email", doc: "Email of the contractor."},
+	{key: "maintenance/contractors/website", doc: "Website of the contractor."},
+	{key: "maintenance/contacts", doc: "Technical contacts, for `internal` and `community` maintenance."},
+	{key: "maintenance/contacts/name", doc: "Name of the contact."},
+	{key: "maintenance/contacts/email", doc: "Email of the contact."},
+	{key: "maintenance/contacts/phone", doc: "Phone number of the contact."},
+	{key: "maintenance/contacts/affiliation", doc: "Organization the contact belongs to."},
+
+	{key: "localisation", doc: "Languages supported by the software."},
+	{key: "localisation/localisationReady", doc: "Whether the software supports, at least by design, multiple languages.", values: enum("true", "false")},
+	{key: "localisation/availableLanguages", doc: "IETF BCP 47 codes of the languages the software is available in."},
+
+	{key: "dependsOn", doc: "Dependencies of the software."},
+	{key: "dependsOn/open", doc: "Open source dependencies."},
+	{key: "dependsOn/proprietary", doc: "Proprietary dependencies."},
+	{key: "dependsOn/hardware", doc: "Hardware dependencies."},
+
+	{key: "it", doc: "Extension of the specification for Italy."},
+	{key: "it/countryExtensionVersion", doc: "Version of the Italian extension.", values: enum("0.2")},
+	{key: "it/conforme", doc: "Compliance with Italian regulations."},
+	{key: "it/conforme/lineeGuidaDesign", doc: "Compliance with the design guidelines for public services.", values: enum("true", "false")},
+	{key: "it/conforme/modelloInteroperabilita", doc: "Compliance with the interoperability model.", values: enum("true", "false")},
+	{key: "it/conforme/misureMinimeSicurezza", doc: "Compliance with the minimum ICT security measures.", values: enum("true", "false")},
+	{key: "it/conforme/gdpr", doc: "Compliance with the GDPR.", values: enum("true", "false")},
+	{key: "it/riuso", doc: "Information for the Developers Italia reuse catalog."},
+	{key: "it/riuso/codiceIPA", doc: "IPA code of the public administration owning the software."},
+	{key: "it/piattaforme", doc: "Integration with national platforms."},
+	{key: "it/piattaforme/spid", doc: "Whether the software supports SPID authentication.", values: enum("true", "false")},
+	{key: "it/piattaforme/pagopa", doc: "Whether the software supports pagoPA payments.", values: enum("true", "false")},
+	{key: "it/piattaforme/cie", doc: "Whether the software supports CIE authentication.", values: enum("true", "false")},
+	{key: "it/piattaforme/anpr", doc: "Whether the software integrates with ANPR.", values: enum("true", "false")},
+}
+
+// dependencyKeys are the keys of every item of dependsOn lists
+var dependencyKeys = []keyDoc{
+	{key: "name", doc: "Name of the dependency."},
+	{key: "versionMin", doc: "Minimum supported version."},
+	{key: "versionMax", doc: "Maximum supported version."},
+	{key: "version", doc: "Only supported version."},
+	{key: "optional", doc: "Whether the dependency is optional.", values: enum("true", "false")},
+}
+
+// docsKey returns the table key of a document path,
+// e.g. description/*/features for description/en/features
+func docsKey(path []string) string {
+	if len(path) > 1 && path[0] == "description" {
+		path = append([]string{path[0], "*"}, path[2:]...)
+	}
+	return strings.Join(path, "/")
+}
+
+// findKey returns the documentation of the key at path
+func findKey(path []string) (keyDoc, bool) {
+	if len(path) == 3 && path[0] == "dependsOn" {
+		for _, d := range dependencyKeys {
+			if d.key == path[2] {
+				d.key = strings.Join(path, "/")
+				return d, true
+			}
+		}
+	}
+	key := docsKey(path)
+	for _, d := range keyDocs {
+		if d.key == key {
+			return d, true
+		}
+	}
+	return keyDoc{}, false
+}
+
+// childKeys returns the documented keys directly under parent
+func childKeys(parent []string) []keyDoc {
+	if len(parent) == 2 && parent[0] == "dependsOn" {
+		var children []keyDoc
+		for _, d := range dependencyKeys {
+			d.key = strings.Join(parent, "/") + "/" + d.key
+			children = append(children, d)
+		}
+		return children
+	}
+	// languages of description are free
+	if len(parent) == 1 && parent[0] == "description" {
+		return nil
+	}
+
+	prefix := docsKey(parent)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var children []keyDoc
+	for _, d := range keyDocs {
+		if strings.HasPrefix(d.key, prefix) && !strings.Contains(d.key[len(prefix):], "/") {
+			children = append(children, d)
+		}
+	}
+	return children
+}
@@ -0,0 +1,153 @@
+package lsp
+
+// The subset of the Language Server Protocol 3.16 types used by
+// the server. Lines and characters are 0-based, characters count
+// UTF-16 code units
+
+// Position in a text document
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range in a text document, the end is exclusive
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic severities
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+)
+
+// Diagnostic is a validation error or warning
+type Diagnostic struct {
+	Range           Range            `json:"range"`
+	Severity        int              `json:"severity"`
+	Code            string           `json:"code,omitempty"`
+	CodeDescription *CodeDescription `json:"codeDescription,omitempty"`
+	Source          string           `json:"source"`
+	Message         string           `json:"message"`
+}
+
+// CodeDescription links the documentation of a diagnostic code
+type CodeDescription struct {
+	Href string `json:"href"`
+}
+
+// PublishDiagnosticsParams of textDocument/publishDiagnostics
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// TextDocumentItem is a document opened by the client
+type TextDocumentItem struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// TextDocumentIdentifier identifies a document
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// VersionedTextDocumentIdentifier identifies a version of a document
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+// DidOpenTextDocumentParams of textDocument/didOpen
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// DidChangeTextDocumentParams of textDocument/didChange. The server
+// asks for full sync, so every change has the whole text
+type DidChangeTextDocumentParams struct {
+	TextDocument   VersionedTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// DidSaveTextDocumentParams of textDocument/didSave
+type DidSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// DidCloseTextDocumentParams of textDocument/didClose
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// TextDocumentPositionParams of hover and completion requests
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// MarkupContent is a markdown text
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover is the result of textDocument/hover
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// Completion item kinds
+const (
+	CompletionKindValue    = 12
+	CompletionKindProperty = 10
+)
+
+// CompletionItem is a single completion proposal
+type CompletionItem struct {
+	Label         string         `json:"label"`
+	Kind          int            `json:"kind"`
+	Detail        string         `json:"detail,omitempty"`
+	Documentation *MarkupContent `json:"documentation,omitempty"`
+	InsertText    string         `json:"insertText,omitempty"`
+}
+
+// CompletionList is the result of textDocument/completion
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+// Text document sync kinds
+const (
+	syncFull = 1
+)
+
+// InitializeResult is the result of initialize
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	} `json:"serverInfo"`
+}
+
+// ServerCapabilities are the features supported by the server
+type ServerCapabilities struct {
+	TextDocumentSync struct {
+		OpenClose bool `json:"openClose"`
+		Change    int  `json:"change"`
+		Save      bool `json:"save"`
+	} `json:"textDocumentSync"`
+	HoverProvider      bool `json:"hoverProvider"`
+	CompletionProvider struct {
+		TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+	} `json:"completionProvider"`
+}
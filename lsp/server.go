@@ -0,0 +1,446 @@
+// Package lsp implements a language server for publiccode.yml files,
+// speaking the Language Server Protocol over a stream, usually stdio.
+// Documents are validated with the same path of /api/v1/validate
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italia/publiccode-validator/apiv1"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// source of the diagnostics shown by editors
+const source = "publiccode.yml"
+
+// changeDelay is how long a document must stay unchanged
+// while typing before it's validated
+var changeDelay = 200 * time.Millisecond
+
+// Server is a language server. Its zero value is ready to use
+type Server struct {
+	// DisableNetwork disables network checks. They are always
+	// disabled while typing and run on open and save only
+	DisableNetwork bool
+	// Strict promotes warnings to errors
+	Strict bool
+	// Version is reported to the client in serverInfo
+	Version string
+
+	conn        *conn
+	mu          sync.Mutex
+	documents   map[string]*document
+	pending     map[string]*time.Timer
+	initialized bool
+	shutdown    bool
+	validations sync.WaitGroup
+}
+
+// Run serves the client until the exit notification or the end of r
+// and returns the process exit code: 0 if the client asked for
+// shutdown before exit, 1 otherwise
+func (s *Server) Run(r io.Reader, w io.Writer) int {
+	s.conn = newConn(r, w)
+	s.documents = make(map[string]*document)
+	s.pending = make(map[string]*time.Timer)
+	defer s.validations.Wait()
+
+	for {
+		body, err := s.conn.read()
+		if err == io.EOF {
+			return 1
+		}
+		if err != nil {
+			log.Errorf("lsp: reading message: %v", err)
+			return 1
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.conn.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		s.handle(req)
+	}
+}
+
+// handle dispatches a request or a notification
+func (s *Server) handle(req request) {
+	if !s.initialized && req.Method != "initialize" {
+		if req.ID != nil {
+			s.conn.replyError(req.ID, codeServerNotInitialized, "server not initialized")
+		}
+		return
+	}
+	if s.shutdown && req.ID != nil {
+		s.conn.replyError(req.ID, codeInvalidRequest, "server is shutting down")
+		return
+	}
+
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = s.initialize()
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			doc := params.TextDocument
+			s.update(doc.URI, doc.Version, doc.Text, true)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.update(params.TextDocument.URI, params.TextDocument.Version, text, false)
+		}
+	case "textDocument/didSave":
+		var params DidSaveTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			if doc := s.document(params.TextDocument.URI); doc != nil {
+				s.update(params.TextDocument.URI, doc.version, doc.text, true)
+			}
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			s.close(params.TextDocument.URI)
+		}
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.completion(params)
+		}
+	default:
+		if req.ID != nil {
+			s.conn.replyError(req.ID, codeMethodNotFound, "method not found: "+req.Method)
+		}
+		return
+	}
+
+	if req.ID == nil {
+		return
+	}
+	if err != nil {
+		s.conn.replyError(req.ID, codeInvalidParams, err.Error())
+		return
+	}
+	s.conn.reply(req.ID, result)
+}
+
+func (s *Server) initialize() InitializeResult {
+	s.initialized = true
+
+	var res InitializeResult
+	res.ServerInfo.Name = "publiccode-validator"
+	res.ServerInfo.Version = s.Version
+	res.Capabilities.TextDocumentSync.OpenClose = true
+	res.Capabilities.TextDocumentSync.Change = syncFull
+	res.Capabilities.TextDocumentSync.Save = true
+	res.Capabilities.HoverProvider = true
+	res.Capabilities.CompletionProvider.TriggerCharacters = []string{":", " ", "-"}
+	return res
+}
+
+func (s *Server) document(uri string) *document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.documents[uri]
+}
+
+// update stores the new text of a document and validates it in
+// background, network checks run only if network is true. Changes
+// without network, sent while typing, are validated after changeDelay
+// and each one cancels the validation pending for the document
+func (s *Server) update(uri string, version int, text string, network bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[uri] = &document{version: version, text: text}
+	s.cancel(uri)
+
+	s.validations.Add(1)
+	run := func() {
+		defer s.validations.Done()
+		s.publish(uri, version, text, network)
+	}
+	if network {
+		go run()
+		return
+	}
+	s.pending[uri] = time.AfterFunc(changeDelay, run)
+}
+
+// cancel stops the validation pending for uri, if any. s.mu must be held
+func (s *Server) cancel(uri string) {
+	if t, ok := s.pending[uri]; ok {
+		if t.Stop() {
+			s.validations.Done()
+		}
+		delete(s.pending, uri)
+	}
+}
+
+// publish sends the diagnostics of a version of a document, unless
+// it changed in the meantime
+func (s *Server) publish(uri string, version int, text string, network bool) {
+	diagnostics := s.validate(uri, text, network)
+
+	// drop results of stale versions, a newer validation is running
+	s.mu.Lock()
+	doc, open := s.documents[uri]
+	current := open && doc.version == version && doc.text == text
+	s.mu.Unlock()
+	if !current {
+		return
+	}
+	s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     &version,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) close(uri string) {
+	s.mu.Lock()
+	delete(s.documents, uri)
+	s.cancel(uri)
+	s.mu.Unlock()
+
+	s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// validate returns the diagnostics of text, using the same path
+// of /api/v1/validate
+func (s *Server) validate(uri string, text string, network bool) []Diagnostic {
+	opts := utils.DefaultOptions()
+	opts.DisableNetwork = s.DisableNetwork || !network
+	opts.Strict = s.Strict
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		opts.LocalBasePath = filepath.Dir(filepath.FromSlash(u.Path))
+	}
+
+	_, warnings, errParse, errConverting := apiv1.Parse(context.Background(), []byte(text), opts)
+
+	lines := (&document{text: text}).lines()
+	diagnostics := []Diagnostic{}
+	if errParse != nil {
+		errs := utils.ErrorsToValidationErrors(errParse)
+		if errs == nil {
+			diagnostics = append(diagnostics, syntaxDiagnostic(lines, errParse.Error()))
+		}
+		for _, e := range errs {
+			diagnostics = append(diagnostics, newDiagnostic(lines, e))
+		}
+	} else if errConverting != nil {
+		diagnostics = append(diagnostics, syntaxDiagnostic(lines, errConverting.Error()))
+	}
+	for _, w := range warnings {
+		diagnostics = append(diagnostics, newDiagnostic(lines, w))
+	}
+	return diagnostics
+}
+
+func newDiagnostic(lines []string, e utils.ErrorInvalidValue) Diagnostic {
+	d := Diagnostic{
+		Range:    toRange(lines, e.Position),
+		Severity: SeverityError,
+		Code:     e.Code,
+		Source:   source,
+		Message:  fmt.Sprintf("%s: %s", e.Key, e.Reason),
+	}
+	if e.Severity == utils.SeverityWarning {
+		d.Severity = SeverityWarning
+	}
+	if e.SpecURL != "" {
+		d.CodeDescription = &CodeDescription{Href: e.SpecURL}
+	}
+	return d
+}
+
+// errorLine finds the line of YAML syntax errors, e.g.
+// "yaml: line 3: mapping values are not allowed in this context"
+var errorLine = regexp.MustCompile(`line (\d+)`)
+
+// syntaxDiagnostic reports an error without a key on the whole
+// line it refers to, if any, on the first line otherwise
+func syntaxDiagnostic(lines []string, message string) Diagnostic {
+	var p utils.Position
+	if m := errorLine.FindStringSubmatch(message); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n <= len(lines) {
+			p = utils.Position{Line: n, Column: 1, EndLine: n, EndColumn: len([]rune(lines[n-1])) + 1}
+		}
+	}
+	return Diagnostic{
+		Range:    toRange(lines, p),
+		Severity: SeverityError,
+		Source:   source,
+		Message:  message,
+	}
+}
+
+// toRange converts a 1-based position counting runes
+// into a range of the protocol
+func toRange(lines []string, p utils.Position) Range {
+	if p.Line < 1 || p.Line > len(lines) {
+		return Range{}
+	}
+	r := Range{Start: Position{Line: p.Line - 1, Character: character(lines[p.Line-1], p.Column-1)}}
+	r.End = r.Start
+	if p.EndLine >= p.Line && p.EndLine <= len(lines) {
+		r.End = Position{Line: p.EndLine - 1, Character: character(lines[p.EndLine-1], p.EndColumn-1)}
+	}
+	return r
+}
+
+// hover documents the key under the cursor
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+	doc := s.document(params.TextDocument.URI)
+	if doc == nil {
+		return nil
+	}
+	lines := doc.lines()
+	n := params.Position.Line
+	path, ok := keyPath(lines, n)
+	if !ok {
+		return nil
+	}
+
+	// only on the key, values have no docs
+	line := lines[n]
+	k, _ := parseKey(line)
+	start := strings.Index(line, path[len(path)-1])
+	if start < 0 || len([]rune(line[:start])) < k.indent {
+		return nil
+	}
+	startChar := character(line, len([]rune(line[:start])))
+	endChar := character(line, len([]rune(line[:start+len(path[len(path)-1])])))
+	if params.Position.Character < startChar || params.Position.Character > endChar {
+		return nil
+	}
+
+	d, ok := findKey(path)
+	if !ok {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: keyMarkdown(d)},
+		Range: &Range{
+			Start: Position{Line: n, Character: startChar},
+			End:   Position{Line: n, Character: endChar},
+		},
+	}
+}
+
+func keyMarkdown(d keyDoc) string {
+	key := docsKey(strings.Split(d.key, "/"))
+	// items of dependsOn share the section of the list
+	if segments := strings.Split(key, "/"); len(segments) == 3 && segments[0] == "dependsOn" {
+		key = strings.Join(segments[:2], "/")
+	}
+	doc := fmt.Sprintf("**%s**\n\n%s", d.key, d.doc)
+	if d.values != nil && len(d.values()) <= 10 {
+		doc += "\n\nValues: `" + strings.Join(d.values(), "`, `") + "`"
+	}
+	return doc + "\n\n[Specification](" + utils.KeySpecURL(key) + ")"
+}
+
+// itemPrefix matches the text before the cursor on a sequence item
+var itemPrefix = regexp.MustCompile(`^( *)- +[^:]*$`)
+
+// keyPrefix matches the text before the cursor on a key being typed
+var keyPrefix = regexp.MustCompile(`^( *)((?:- +)*)[A-Za-z0-9_]*$`)
+
+// completion proposes keys or values of enumerations at the cursor
+func (s *Server) completion(params TextDocumentPositionParams) CompletionList {
+	list := CompletionList{Items: []CompletionItem{}}
+	doc := s.document(params.TextDocument.URI)
+	if doc == nil {
+		return list
+	}
+	lines := doc.lines()
+	n := params.Position.Line
+	if n < 0 || n >= len(lines) {
+		return list
+	}
+	line := lines[n]
+	before := string([]rune(line)[:runeIndex(line, params.Position.Character)])
+
+	// value of a key, e.g. "softwareType: "
+	if k, ok := parseKey(before); ok {
+		path, ok := parentPath(lines, n, k.indent)
+		if !ok {
+			return list
+		}
+		list.Items = valueItems(append(path, k.key))
+		return list
+	}
+
+	// item of a sequence, e.g. "  - " under platforms
+	if m := itemPrefix.FindStringSubmatch(before); m != nil {
+		if path, ok := listPath(lines, n, len(m[1])); ok {
+			if items := valueItems(path); len(items) > 0 {
+				list.Items = items
+				return list
+			}
+		}
+	}
+
+	// key being typed
+	if m := keyPrefix.FindStringSubmatch(before); m != nil {
+		parent, ok := parentPath(lines, n, len(m[1])+len(m[2]))
+		if !ok {
+			return list
+		}
+		for _, d := range childKeys(parent) {
+			segments := strings.Split(d.key, "/")
+			key := segments[len(segments)-1]
+			list.Items = append(list.Items, CompletionItem{
+				Label:         key,
+				Kind:          CompletionKindProperty,
+				Documentation: &MarkupContent{Kind: "markdown", Value: keyMarkdown(d)},
+				InsertText:    key + ": ",
+			})
+		}
+	}
+	return list
+}
+
+func valueItems(path []string) []CompletionItem {
+	d, ok := findKey(path)
+	if !ok || d.values == nil {
+		return nil
+	}
+	var items []CompletionItem
+	for _, v := range d.values() {
+		items = append(items, CompletionItem{Label: v, Kind: CompletionKindValue, Detail: d.key})
+	}
+	return items
+}
@@ -0,0 +1,273 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client talks to a Server running on pipes
+type client struct {
+	t      *testing.T
+	conn   *conn
+	stdin  io.WriteCloser
+	nextID int
+	exit   chan int
+}
+
+func newClient(t *testing.T, s *Server) *client {
+	serverIn, stdin := io.Pipe()
+	stdout, serverOut := io.Pipe()
+	c := &client{t: t, conn: newConn(stdout, stdin), stdin: stdin, exit: make(chan int, 1)}
+	go func() {
+		c.exit <- s.Run(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	return c
+}
+
+func (c *client) notify(method string, params interface{}) {
+	require.NoError(c.t, c.conn.notify(method, params))
+}
+
+// call sends a request and returns the result of its response,
+// messages received in the meantime are dropped
+func (c *client) call(method string, params interface{}, result interface{}) {
+	c.nextID++
+	raw := json.RawMessage(strconv.Itoa(c.nextID))
+	require.NoError(c.t, c.conn.write(request{JSONRPC: "2.0", ID: &raw, Method: method, Params: marshal(c.t, params)}))
+	for {
+		var msg struct {
+			ID     *json.RawMessage `json:"id"`
+			Result json.RawMessage  `json:"result"`
+			Error  *responseError   `json:"error"`
+		}
+		c.read(&msg)
+		if msg.ID == nil || string(*msg.ID) != string(raw) {
+			continue
+		}
+		require.Nil(c.t, msg.Error)
+		require.NoError(c.t, json.Unmarshal(msg.Result, result))
+		return
+	}
+}
+
+// diagnostics waits for the diagnostics of uri
+func (c *client) diagnostics(uri string) PublishDiagnosticsParams {
+	for {
+		var msg struct {
+			Method string                   `json:"method"`
+			Params PublishDiagnosticsParams `json:"params"`
+		}
+		c.read(&msg)
+		if msg.Method == "textDocument/publishDiagnostics" && msg.Params.URI == uri {
+			return msg.Params
+		}
+	}
+}
+
+func (c *client) read(v interface{}) {
+	body, err := c.conn.read()
+	require.NoError(c.t, err)
+	require.NoError(c.t, json.Unmarshal(body, v))
+}
+
+func marshal(t *testing.T, v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func TestServer(t *testing.T) {
+	valid, err := ioutil.ReadFile("../tests/valid.minimal.yml")
+	require.NoError(t, err)
+	text := strings.Replace(string(valid), "license: AGPL-3.0-or-later", "license: Foo", 1)
+	lines := strings.Split(text, "\n")
+	licenseLine := 0
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  license:") {
+			licenseLine = i
+		}
+	}
+
+	c := newClient(t, &Server{DisableNetwork: true, Version: "test"})
+
+	var init InitializeResult
+	c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &init)
+	assert.True(t, init.Capabilities.HoverProvider)
+	assert.Equal(t, syncFull, init.Capabilities.TextDocumentSync.Change)
+	assert.Equal(t, "test", init.ServerInfo.Version)
+	c.notify("initialized", struct{}{})
+
+	uri := "file:///tmp/publiccode.yml"
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: text},
+	})
+	diags := c.diagnostics(uri)
+	require.NotNil(t, diags.Version)
+	assert.Equal(t, 1, *diags.Version)
+	var license *Diagnostic
+	for i, d := range diags.Diagnostics {
+		assert.Equal(t, source, d.Source)
+		if d.Code == "invalid-license" {
+			license = &diags.Diagnostics[i]
+		}
+	}
+	if assert.NotNil(t, license) {
+		assert.Equal(t, SeverityError, license.Severity)
+		assert.Equal(t, Range{
+			Start: Position{Line: licenseLine, Character: 11},
+			End:   Position{Line: licenseLine, Character: 14},
+		}, license.Range)
+		assert.Contains(t, license.CodeDescription.Href, "#key-legal-license")
+	}
+
+	// while typing, a YAML syntax error on the line it happens
+	broken := text + "foo: [\n"
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		"contentChanges": []map[string]string{{"text": broken}},
+	})
+	diags = c.diagnostics(uri)
+	assert.Equal(t, 2, *diags.Version)
+	if assert.Len(t, diags.Diagnostics, 1) {
+		assert.Equal(t, SeverityError, diags.Diagnostics[0].Severity)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		"contentChanges": []map[string]string{{"text": text + "legal:\n  \nsoftwareType: \nplatforms:\n  - \n"}},
+	})
+	c.diagnostics(uri)
+
+	var hover Hover
+	c.call("textDocument/hover", TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: licenseLine, Character: 4},
+	}, &hover)
+	assert.Contains(t, hover.Contents.Value, "**legal/license**")
+	assert.Contains(t, hover.Contents.Value, "SPDX")
+	assert.Equal(t, &Range{
+		Start: Position{Line: licenseLine, Character: 2},
+		End:   Position{Line: licenseLine, Character: 9},
+	}, hover.Range)
+
+	end := len(lines) - 1
+	labels := func(line, character int) []string {
+		var list CompletionList
+		c.call("textDocument/completion", TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: uri},
+			Position:     Position{Line: line, Character: character},
+		}, &list)
+		var labels []string
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+	// keys under legal
+	assert.Equal(t, []string{"license", "mainCopyrightOwner", "repoOwner", "authorsFile"}, labels(end+1, 2))
+	// values of softwareType
+	assert.Contains(t, labels(end+2, 14), "standalone/web")
+	// values of platforms items
+	assert.Equal(t, []string{"web", "windows", "mac", "linux", "ios", "android"}, labels(end+4, 4))
+	// license identifiers
+	assert.Contains(t, labels(licenseLine, 11), "AGPL-3.0-or-later")
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	assert.Empty(t, c.diagnostics(uri).Diagnostics)
+
+	var null interface{}
+	c.call("shutdown", nil, &null)
+	c.notify("exit", nil)
+	assert.Equal(t, 0, <-c.exit)
+}
+
+func TestServerChangeDelay(t *testing.T) {
+	c := newClient(t, &Server{DisableNetwork: true})
+	var init InitializeResult
+	c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &init)
+
+	uri := "file:///tmp/publiccode.yml"
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: "name: Medusa\n"},
+	})
+	assert.Equal(t, 1, *c.diagnostics(uri).Version)
+
+	// changes while typing are validated once, at the last one
+	for version := 2; version <= 5; version++ {
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: version},
+			"contentChanges": []map[string]string{{"text": "name: Medusa\nfoo: [" + strconv.Itoa(version) + "\n"}},
+		})
+	}
+	assert.Equal(t, 5, *c.diagnostics(uri).Version)
+
+	// closing drops the pending validation
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: 6},
+		"contentChanges": []map[string]string{{"text": "name: Medusa\n"}},
+	})
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	diags := c.diagnostics(uri)
+	assert.Nil(t, diags.Version)
+	assert.Empty(t, diags.Diagnostics)
+
+	var null interface{}
+	c.call("shutdown", nil, &null)
+	c.notify("exit", nil)
+	assert.Equal(t, 0, <-c.exit)
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	c := newClient(t, &Server{DisableNetwork: true})
+
+	raw := json.RawMessage("1")
+	require.NoError(t, c.conn.write(request{JSONRPC: "2.0", ID: &raw, Method: "textDocument/completion"}))
+	var msg errorResponse
+	c.read(&msg)
+	assert.Equal(t, codeServerNotInitialized, msg.Error.Code)
+
+	c.notify("exit", nil)
+	assert.Equal(t, 1, <-c.exit)
+}
+
+func TestKeyPath(t *testing.T) {
+	lines := strings.Split("name: x\n"+
+		"maintenance:\n"+
+		"  contacts:\n"+
+		"  - name: Foo\n"+
+		"    email: foo@example.org\n"+
+		"description:\n"+
+		"  en:\n"+
+		"    longDescription: |\n"+
+		"      key: not a key\n", "\n")
+
+	for n, want := range [][]string{
+		{"name"},
+		{"maintenance"},
+		{"maintenance", "contacts"},
+		{"maintenance", "contacts", "name"},
+		{"maintenance", "contacts", "email"},
+		{"description"},
+		{"description", "en"},
+		{"description", "en", "longDescription"},
+		nil,
+	} {
+		path, _ := keyPath(lines, n)
+		assert.Equal(t, want, path, "line %d", n)
+	}
+}
+
+func TestCharacter(t *testing.T) {
+	line := "name: \U0001F600 è"
+	assert.Equal(t, 9, character(line, 8))
+	assert.Equal(t, 8, runeIndex(line, 9))
+	assert.Equal(t, 9, runeIndex(line, 100))
+}
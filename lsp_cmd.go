@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/italia/publiccode-validator/lsp"
+	log "github.com/sirupsen/logrus"
+)
+
+// lspCommand runs `lsp`, a language server for editors speaking
+// the Language Server Protocol on stdin and stdout
+func lspCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	noNetwork := flags.Bool("no-network", false, "disable network checks (URL existence, remote files)")
+	strict := flags.Bool("strict", false, "treat warnings as errors")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: publiccode-validator lsp [flags]\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		if err == nil {
+			flags.Usage()
+		}
+		return exitUsage
+	}
+
+	// stdout carries the protocol, logs go to stderr
+	log.SetOutput(stderr)
+	log.SetLevel(log.ErrorLevel)
+
+	s := &lsp.Server{DisableNetwork: *noNetwork, Strict: *strict, Version: version}
+	return s.Run(stdin, stdout)
+}
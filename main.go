@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
 	"runtime/debug"
-	"strconv"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/ghodss/yaml"
 	"github.com/gorilla/mux"
-	publiccode "github.com/italia/publiccode-parser-go"
 	"github.com/italia/publiccode-validator/apiv1"
+	"github.com/italia/publiccode-validator/config"
+	"github.com/italia/publiccode-validator/i18n"
+	"github.com/italia/publiccode-validator/metrics"
+	"github.com/italia/publiccode-validator/outbound"
 	"github.com/italia/publiccode-validator/utils"
 )
 
@@ -36,24 +44,106 @@ func init() {
 	if date == "" {
 		date = "(latest)"
 	}
-	log.Infof("version %s compiled %s\n", version, date)
 }
 
-// main server start
+// main server start, command line validation when called as
+// `publiccode-validator validate ...` or the language server
+// when called as `publiccode-validator lsp`
 func main() {
-	app := App{}
-	app.Port = "5000"
-	app.DisableNetwork = false
+	if len(os.Args) > 1 && (os.Args[1] == "validate" || os.Args[1] == "lsp") {
+		cfg := config.Default()
+		// local tools fetch what their user asks, like internal forges
+		cfg.AllowPrivateNetworks = true
+		if err := setupOutbound(cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validateCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		os.Exit(lspCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	cfg, printConfig, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if printConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+	cfg.SetupLog()
+	utils.Configure(cfg)
+	if err := setupOutbound(cfg); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	log.Infof("version %s compiled %s\n", version, date)
+
+	app := App{Config: cfg}
 	app.initializeRouters()
 
 	// server run here because of tests
 	// https://github.com/gorilla/mux#testing-handlers
-	log.Infof("server is starting at port %s", app.Port)
-	log.Fatal(http.ListenAndServe(":"+app.Port, app.Router))
+	server := newServer(cfg, app.Router)
+	if err := setupTLS(server, cfg); err != nil {
+		log.Fatalf("invalid TLS certificate: %v", err)
+	}
+	l, err := net.Listen("tcp", cfg.ListenAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
+	log.Infof("server is starting at %s", cfg.ListenAddress)
+	if err := serve(server, l, stop, cfg.ShutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+	log.Info("server stopped")
+}
+
+// setupOutbound routes requests to remote hosts, the ones of
+// the parser included, through the transport configured by cfg,
+// refusing the URLs its policy doesn't allow
+func setupOutbound(cfg config.Config) error {
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = "publiccode-validator/" + version + " (+https://github.com/italia/publiccode-validator)"
+	}
+	t, err := outbound.New(outbound.Options{
+		Timeout:      cfg.FetchTimeout,
+		Retries:      cfg.FetchRetries,
+		MaxRedirects: cfg.FetchMaxRedirects,
+		MaxBodySize:  cfg.FetchMaxSize,
+		UserAgent:    userAgent,
+		Proxy:        cfg.Proxy,
+		Policy: &outbound.Policy{
+			AllowPrivateNetworks: cfg.AllowPrivateNetworks,
+			AllowedHosts:         cfg.AllowedHosts,
+			DeniedHosts:          cfg.DeniedHosts,
+		},
+		Observe: utils.ObserveFetch,
+	})
+	if err != nil {
+		return err
+	}
+	outbound.Install(t)
+	return nil
 }
 
 func (app *App) initializeRouters() {
 	app.Router = mux.NewRouter()
+	app.Router.Use(metrics.Middleware)
+	app.Router.Use(app.limitBody)
+
+	app.Router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	app.Router.HandleFunc("/healthz", app.healthz).Methods("GET")
+	app.Router.HandleFunc("/readyz", app.readyz).Methods("GET")
+
 	var api = app.Router.PathPrefix("/api").Subrouter()
 	var api1 = api.PathPrefix("/v1").Subrouter()
 
@@ -82,14 +172,48 @@ func (app *App) initializeRouters() {
 		HandleFunc("/validate", apiv1.Validate).
 		Methods("POST", "OPTIONS")
 
+	api1.
+		HandleFunc("/validate/batch", apiv1.ValidateBatch).
+		Methods("POST", "OPTIONS")
+
+	api1.
+		HandleFunc("/validateURL/batch", apiv1.ValidateRemoteURLBatch).
+		Methods("POST", "OPTIONS")
+
 	api1.
 		HandleFunc("/validateURL", apiv1.ValidateRemoteURL).
 		Methods("POST", "OPTIONS").
 		Queries("url", "{url}")
+
+	api1.
+		HandleFunc("/fix", apiv1.Fix).
+		Methods("POST", "OPTIONS")
+
+	api1.
+		HandleFunc("/diff", apiv1.Diff).
+		Methods("POST", "OPTIONS")
+
+	api1.
+		HandleFunc("/schema/{version}", apiv1.Schema).
+		Methods("GET", "OPTIONS")
+
+	api1.
+		HandleFunc("/version", app.versionInfo).
+		Methods("GET", "OPTIONS")
+}
+
+// limitBody caps request bodies to the configured max size
+func (app *App) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && app.Config.MaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, app.Config.MaxBodySize)
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // parse returns new parsed and validated buffer and errors if any
-func (app *App) parse(b []byte) ([]byte, error, error) {
+func (app *App) parse(b []byte, opts utils.Options) ([]byte, error, error) {
 	url, err := utils.GetURLFromYMLBuffer(b)
 	if err != nil {
 		// this error should not be blocking because it just means
@@ -97,61 +221,59 @@ func (app *App) parse(b []byte) ([]byte, error, error) {
 		// one case for that: partial validation during editing
 		log.Warnf("url not found in body (useful to get RemoteBaseURL): %s", err)
 	}
-	p := publiccode.NewParser()
-	p.DisableNetwork = app.DisableNetwork
-
-	if url != nil {
-		p.DisableNetwork = app.DisableNetwork
-		p.RemoteBaseURL = utils.GetRawURL(url)
-	}
+	p := opts.NewParser(url)
 	log.Debugf("parse() called with disableNetwork: %v, and remoteBaseUrl: %s", p.DisableNetwork, p.RemoteBaseURL)
-	errParse := p.Parse(b)
+	errParse := utils.NewValidationErrors(p.Parse(b), b)
 	pc, err := p.ToYAML()
 
-	// hack to reset global vars to default values
-	app.DisableNetwork = false
 	return pc, errParse, err
 }
 
-func (app *App) parseRemoteURL(urlString string) ([]byte, error, error) {
+func (app *App) parseRemoteURL(ctx context.Context, urlString string, opts utils.Options) ([]byte, error, error) {
 	log.Infof("called parseRemoteURL() url: %s", urlString)
-	p := publiccode.NewParser()
-	urlString, err := utils.GetRawFile(urlString)
+	if err := outbound.Check(ctx, urlString); err != nil {
+		return nil, nil, err
+	}
+	p := opts.NewParser(nil)
+	b, err := utils.FetchRawFile(ctx, urlString)
 	if err != nil {
 		return nil, nil, err
 	}
-	errParse := p.ParseRemoteFile(urlString)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	errParse := utils.NewValidationErrors(p.Parse(b), b)
 	pc, err := p.ToYAML()
 
 	return pc, errParse, err
 }
 
-func promptError(err error, w http.ResponseWriter,
+func promptError(err error, w http.ResponseWriter, r *http.Request,
 	httpStatus int, mess string) {
 
 	log.Errorf(mess+": %v", err)
 
-	message := utils.Message{
+	message := i18n.Localize(utils.Message{
 		Status:  httpStatus,
 		Message: mess,
 		Error:   err.Error(),
-	}
+	}, i18n.FromRequest(r))
 	log.Debugf("message: %v", message)
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(message.Status)
 	json.NewEncoder(w).Encode(message)
 }
 
-func promptValidationErrors(err error, w http.ResponseWriter,
+func promptValidationErrors(err error, w http.ResponseWriter, r *http.Request,
 	httpStatus int, mess string) {
 
 	log.Errorf(mess+": %v", err)
 
-	message := utils.Message{
+	message := i18n.Localize(utils.Message{
 		Status:          httpStatus,
 		Message:         mess,
 		ValidationError: utils.ErrorsToValidationErrors(err),
-	}
+	}, i18n.FromRequest(r))
 
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(message.Status)
@@ -169,23 +291,28 @@ func (app *App) validateRemoteURL(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	urlString := vars["url"]
 	if urlString == "" {
-		promptError(errors.New("Not found"), w, http.StatusNotFound, "URL error")
+		promptError(errors.New("Not found"), w, r, http.StatusNotFound, "URL error")
 		return
 	}
 
 	// parsing
-	pc, errParse, errConverting := app.parseRemoteURL(urlString)
+	pc, errParse, errConverting := app.parseRemoteURL(r.Context(), urlString, utils.OptionsFromRequest(r))
+	utils.ObserveValidation(errParse, errConverting)
 
+	if _, ok := outbound.Refused(errConverting); ok {
+		promptError(errConverting, w, r, http.StatusForbidden, "URL refused")
+		return
+	}
 	if errConverting != nil {
-		promptError(errConverting, w, http.StatusBadRequest, "Error converting")
+		promptError(errConverting, w, r, http.StatusBadRequest, "Error converting")
 		return
 	}
 	if errParse != nil {
 		if match, _ := regexp.MatchString(`404`, errParse.Error()); match {
-			promptError(errors.New("Not found"), w, http.StatusNotFound, "URL error")
+			promptError(errors.New("Not found"), w, r, http.StatusNotFound, "URL error")
 			return
 		}
-		promptValidationErrors(errParse, w, http.StatusUnprocessableEntity, "Validation Errors")
+		promptValidationErrors(errParse, w, r, http.StatusUnprocessableEntity, "Validation Errors")
 	} else {
 		// set response CT based on client accept header
 		// and return respectively content
@@ -209,17 +336,8 @@ func (app *App) validateParam(w http.ResponseWriter, r *http.Request) {
 	if (*r).Method == "OPTIONS" {
 		return
 	}
-	// Getting vars from parameters
-	vars := mux.Vars(r)
-	disableNetwork, err := strconv.ParseBool(vars["disableNetwork"])
-	app.DisableNetwork = disableNetwork
-
-	if err != nil {
-		app.DisableNetwork = false
-		log.Info("var disableNetwork not set, default to true")
-	}
 
-	app.validate(w, r)
+	app.validateWithOptions(w, r, utils.OptionsFromRequest(r))
 }
 
 // validate returns a YML or JSON onbject validated and upgraded
@@ -232,6 +350,12 @@ func (app *App) validate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.validateWithOptions(w, r, utils.OptionsFromRequest(r))
+}
+
+// validateWithOptions validates the request body using
+// request scoped options
+func (app *App) validateWithOptions(w http.ResponseWriter, r *http.Request, opts utils.Options) {
 	if r.Body == nil {
 		log.Info("empty payload")
 		return
@@ -242,7 +366,8 @@ func (app *App) validate(w http.ResponseWriter, r *http.Request) {
 	// reading request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		promptError(err, w, http.StatusBadRequest, "Error reading body")
+		status, mess := utils.ReadBodyError(err)
+		promptError(err, w, r, status, mess)
 		return
 	}
 
@@ -258,7 +383,7 @@ func (app *App) validate(w http.ResponseWriter, r *http.Request) {
 		//converting to YML
 		m, err = yaml.JSONToYAML(body)
 		if err != nil {
-			promptError(err, w, http.StatusBadRequest, "Conversion to json ko")
+			promptError(err, w, r, http.StatusBadRequest, "Conversion to json ko")
 			return
 		}
 	} else {
@@ -266,14 +391,22 @@ func (app *App) validate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// parsing
-	pc, errParse, errConverting := app.parse(m)
+	pc, errParse, errConverting := app.parse(m, opts)
+	utils.ObserveValidation(errParse, errConverting)
 
 	if errConverting != nil {
-		promptError(errConverting, w, http.StatusBadRequest, "Error converting")
+		promptError(errConverting, w, r, http.StatusBadRequest, "Error converting")
 		return
 	}
 	if errParse != nil {
 		log.Debugf("Validation Errors: %s", errParse)
+		if errs, ok := errParse.(utils.ValidationErrors); ok {
+			// positions must refer to the submitted JSON, not to its conversion
+			if r.Header.Get("Content-Type") == "application/json" {
+				errs.Locate(body)
+			}
+			errParse = utils.ValidationErrors(i18n.LocalizeErrors(errs, i18n.FromRequest(r)))
+		}
 
 		// consider switch to promptError()
 		w.Header().Set("Content-type", "application/json")
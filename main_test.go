@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,8 +13,14 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ghodss/yaml"
+	"github.com/italia/publiccode-validator/config"
 	"github.com/italia/publiccode-validator/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -34,7 +43,7 @@ func (a Es) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a Es) Less(i, j int) bool { return a[i].Key < a[j].Key }
 
 func TestMain(m *testing.M) {
-	app = App{}
+	app = App{Config: config.Default()}
 	app.initializeRouters()
 	code := m.Run()
 	os.Exit(code)
@@ -265,6 +274,150 @@ func TestValidationErrWithNetworkv1(t *testing.T) {
 	assert.Equal(t, errs, errOut)
 }
 
+func TestValidationErrWithNoNetworkv1(t *testing.T) {
+	var outMessage utils.Message
+	out, err := ioutil.ReadFile("tests/out_invalid_network_v1.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = json.Unmarshal(out, &outMessage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Sort(Msg(outMessage))
+
+	// v1
+	fileYML, err := os.Open("tests/invalid.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/api/v1/validate?disableNetwork=true", fileYML)
+	req.Header.Set("Accept", "application/json")
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	var resMessage utils.Message
+	err = json.Unmarshal(response.Body.Bytes(), &resMessage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Sort(Msg(resMessage))
+	assert.Equal(t, outMessage, resMessage)
+	for _, e := range resMessage.ValidationError {
+		assert.Equal(t, utils.CodeUnknownKey, e.Code)
+		assert.Equal(t, utils.SeverityError, e.Severity)
+		assert.Equal(t, "/"+e.Key, e.Path)
+		assert.NotNil(t, e.Value)
+	}
+
+	// v0 emits the same errors
+	fileYML, err = os.Open("tests/invalid.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, _ = http.NewRequest("POST", "/pc/validate?disableNetwork=true", fileYML)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	var errs []utils.ErrorInvalidValue
+	err = json.Unmarshal(response.Body.Bytes(), &errs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Sort(Es(errs))
+	assert.Equal(t, outMessage.ValidationError, errs)
+
+	// v1 upgrades legacy keys with strict=false, with a warning
+	fileYML, err = os.Open("tests/invalid.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, _ = http.NewRequest("POST", "/api/v1/validate?disableNetwork=true&strict=false", fileYML)
+	req.Header.Set("Accept", "application/json")
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	resMessage = utils.Message{}
+	err = json.Unmarshal(response.Body.Bytes(), &resMessage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if assert.Len(t, resMessage.ValidationError, 1) {
+		assert.Equal(t, "maintenance/contacts", resMessage.ValidationError[0].Key)
+	}
+	assert.Len(t, resMessage.Warnings, len(outMessage.ValidationError))
+	for _, w := range resMessage.Warnings {
+		assert.Equal(t, utils.CodeDeprecatedKey, w.Code)
+		assert.Equal(t, utils.SeverityWarning, w.Severity)
+	}
+}
+
+func TestValidationWarningsv1(t *testing.T) {
+	// valid, with warnings in headers
+	fileYML, err := os.Open("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := ioutil.ReadFile("tests/out_valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/api/v1/validate?disableNetwork=true", fileYML)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, string(out), response.Body.String())
+	assert.Equal(t, []string{
+		`299 - "description/en/screenshots: missing recommended key"`,
+		`299 - "logo: missing recommended key"`,
+		`299 - "roadmap: missing recommended key"`,
+	}, response.Header()["Warning"])
+
+	// with envelope the document and the warnings are in the message
+	for _, accept := range []string{"application/json", "application/x-yaml"} {
+		fileYML, err = os.Open("tests/valid.minimal.yml")
+		if err != nil {
+			log.Fatal(err)
+		}
+		req, _ = http.NewRequest("POST", "/api/v1/validate?disableNetwork=true&envelope=true", fileYML)
+		req.Header.Set("Accept", accept)
+		response = executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var envelope struct {
+			utils.Message
+			Normalized map[string]interface{} `json:"normalized"`
+		}
+		if assert.NoError(t, yaml.Unmarshal(response.Body.Bytes(), &envelope), accept) {
+			assert.Equal(t, http.StatusOK, envelope.Status)
+			assert.Len(t, envelope.Warnings, 3)
+			var normalized map[string]interface{}
+			assert.NoError(t, yaml.Unmarshal(out, &normalized))
+			assert.Equal(t, normalized, envelope.Normalized, accept)
+		}
+	}
+
+	// strict mode promotes warnings to errors
+	fileYML, err = os.Open("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, _ = http.NewRequest("POST", "/api/v1/validate?disableNetwork=true&strict=true", fileYML)
+	req.Header.Set("Accept", "application/json")
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	var message utils.Message
+	err = json.Unmarshal(response.Body.Bytes(), &message)
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert.Len(t, message.ValidationError, 3)
+	assert.Empty(t, message.Warnings)
+	for _, e := range message.ValidationError {
+		assert.Equal(t, utils.CodeMissingRecommendedKey, e.Code)
+		assert.Equal(t, utils.SeverityError, e.Severity)
+	}
+}
+
 func TestValidationWithNoNetworkv1(t *testing.T) {
 	checks := []bool{true, false}
 	for _, check := range checks {
@@ -359,6 +512,1067 @@ func TestValidationRemoteURLv1(t *testing.T) {
 	assert.Equal(t, string(out), response.Body.String())
 }
 
+func TestValidationBatchv1(t *testing.T) {
+	valid, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	invalid, err := ioutil.ReadFile("tests/invalid.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := ioutil.ReadFile("tests/out_valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	normalized := utils.Yaml2json(out)
+
+	// multi-document YAML stream, with a wrapped document and a broken one
+	stream := string(valid) + "\n---\nid: second\ndocument: |\n  " +
+		strings.Replace(string(invalid), "\n", "\n  ", -1) + "\n---\nname: [\n"
+
+	// JSON array, with a wrapped document
+	array, _ := json.Marshal([]interface{}{
+		json.RawMessage(utils.Yaml2json(valid)),
+		map[string]interface{}{"id": "second", "document": string(invalid)},
+		"name: [",
+	})
+
+	for _, body := range []string{stream, string(array)} {
+		req, _ := http.NewRequest("POST", "/api/v1/validate/batch?disableNetwork=true", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var results []utils.BatchResult
+		err = json.Unmarshal(response.Body.Bytes(), &results)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !assert.Len(t, results, 3) {
+			continue
+		}
+		for i, res := range results {
+			assert.Equal(t, i, res.Index)
+		}
+		assert.Equal(t, http.StatusOK, results[0].Status)
+		assert.JSONEq(t, string(normalized), string(results[0].Normalized))
+		assert.Equal(t, "second", results[1].ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, results[1].Status)
+		assert.NotEmpty(t, results[1].ValidationError)
+		assert.NotEqual(t, http.StatusOK, results[2].Status)
+	}
+
+	// documents are not validated once the request is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("POST", "/api/v1/validate/batch?disableNetwork=true", strings.NewReader(stream))
+	req.Header.Set("Accept", "application/json")
+	response := executeRequest(req.WithContext(ctx))
+	var canceled []utils.BatchResult
+	if assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &canceled)) && assert.Len(t, canceled, 3) {
+		assert.Contains(t, canceled[0].Error, context.Canceled.Error())
+	}
+
+	req, _ = http.NewRequest("POST", "/api/v1/validate/batch", strings.NewReader("[1, 2"))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("POST", "/api/v1/validate/batch", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestContentNegotiationv1(t *testing.T) {
+	valid, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	invalid, err := ioutil.ReadFile("tests/invalid_legal_license.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	validate := func(path string, body []byte, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path+"?disableNetwork=true", strings.NewReader(string(body)))
+		req.Header.Set("Accept", accept)
+		response := executeRequest(req)
+		assert.Equal(t, "Accept", response.Header().Get("Vary"), accept)
+		return response
+	}
+
+	response := validate("/api/v1/validate", valid, "application/json, text/plain;q=0.9")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-type"))
+	assert.True(t, json.Valid(response.Body.Bytes()))
+
+	for _, accept := range []string{"", "*/*", "application/x-yaml", "application/*"} {
+		response = validate("/api/v1/validate", valid, accept)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		assert.Equal(t, "application/x-yaml", response.Header().Get("Content-type"), accept)
+	}
+
+	response = validate("/api/v1/validate", valid, "text/yaml")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/yaml; charset=utf-8", response.Header().Get("Content-type"))
+	assert.Contains(t, response.Body.String(), "publiccodeYmlVersion")
+
+	response = validate("/api/v1/validate", invalid, "text/plain")
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-type"))
+	assert.Contains(t, response.Body.String(), "legal/license")
+
+	response = validate("/api/v1/validate", valid, "text/html, */*;q=0.8")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/html; charset=utf-8", response.Header().Get("Content-type"))
+	assert.Contains(t, response.Body.String(), ">Valid</h1>")
+
+	response = validate("/api/v1/validate", valid, "image/png")
+	checkResponseCode(t, http.StatusNotAcceptable, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-type"))
+	var message utils.Message
+	if assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &message)) {
+		assert.Equal(t, http.StatusNotAcceptable, message.Status)
+		assert.Contains(t, message.Error, "text/html")
+	}
+
+	// batches are data only
+	response = validate("/api/v1/validate/batch", valid, "text/html")
+	checkResponseCode(t, http.StatusNotAcceptable, response.Code)
+	response = validate("/api/v1/validate/batch", valid, "application/yaml")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/yaml", response.Header().Get("Content-type"))
+}
+
+func TestReportsv1(t *testing.T) {
+	invalid, err := ioutil.ReadFile("tests/invalid_legal_license.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, accept := range []string{"text/plain", "text/html"} {
+		req, _ := http.NewRequest("POST", "/api/v1/validate?disableNetwork=true", strings.NewReader(string(invalid)))
+		req.Header.Set("Accept", accept)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+		body := response.Body.String()
+		assert.Contains(t, body, "Legal", accept)
+		assert.Contains(t, body, "The license must be an SPDX expression", accept)
+		assert.Contains(t, body, "https://yml.publiccode.tools/schema.core.html#key-legal-license", accept)
+		assert.NotContains(t, body, "Maintenance", accept)
+	}
+}
+
+// newGitLabServer returns a local server detected as a GitLab
+// instance, serving the files in tests/ as raw files
+func newGitLabServer(handler func()) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+			return
+		}
+		if handler != nil {
+			handler()
+		}
+		http.ServeFile(w, r, strings.TrimPrefix(r.URL.Path, "/italia/repo/-/raw/master/"))
+	}))
+}
+
+func TestLocalization(t *testing.T) {
+	invalid, err := ioutil.ReadFile("tests/invalid_legal_license.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	request := func(path string, acceptLanguage string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(string(invalid)))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Accept-Language", acceptLanguage)
+		return executeRequest(req)
+	}
+
+	response := request("/api/v1/validate?disableNetwork=true&strict=false", "it-IT,it;q=0.9,en;q=0.8")
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Equal(t, "it", response.Header().Get("Content-Language"))
+	var message utils.Message
+	if assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &message)) {
+		assert.Equal(t, "Errori di validazione", message.Message)
+		// the reason of the parser, with the details, is in detail
+		assert.Equal(t, "licenza non valida", message.ValidationError[0].Reason)
+		assert.Contains(t, message.ValidationError[0].Detail, "AGPLicense-3.0")
+		assert.Equal(t, utils.CodeInvalidLicense, message.ValidationError[0].Code)
+	}
+
+	// the query parameter wins
+	response = request("/api/v1/validate?disableNetwork=true&strict=false&lang=en", "it")
+	assert.Equal(t, "en", response.Header().Get("Content-Language"))
+	message = utils.Message{}
+	if assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &message)) {
+		assert.Equal(t, "Validation Errors", message.Message)
+		assert.Contains(t, message.ValidationError[0].Reason, "AGPLicense-3.0")
+		assert.Empty(t, message.ValidationError[0].Detail)
+	}
+
+	response = request("/api/v1/validate?disableNetwork=true&lang=it", "")
+	assert.Contains(t, response.Body.String(), "Errori di validazione")
+
+	req, _ := http.NewRequest("POST", "/api/v1/validate?disableNetwork=true&lang=it", strings.NewReader(string(invalid)))
+	req.Header.Set("Accept", "text/plain")
+	response = executeRequest(req)
+	assert.Contains(t, response.Body.String(), "Licenza e titolari del copyright")
+	assert.Contains(t, response.Body.String(), "ERRORE legal/license")
+	// titles are underlined by letter, not by byte
+	lines := strings.Split(response.Body.String(), "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" && strings.Trim(lines[i], "=") == "" {
+			assert.Equal(t, utf8.RuneCountInString(lines[i-1]), len(lines[i]), lines[i-1])
+		}
+	}
+
+	// v0
+	response = request("/pc/validate?disableNetwork=true&strict=false", "it")
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	var errs []utils.ErrorInvalidValue
+	if assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &errs)) && assert.NotEmpty(t, errs) {
+		assert.Equal(t, "licenza non valida", errs[0].Reason)
+		assert.Contains(t, errs[0].Detail, "AGPLicense-3.0")
+	}
+}
+
+func TestFixv1(t *testing.T) {
+	valid, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	invalid, err := ioutil.ReadFile("tests/invalid_legal_license.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	type fixResult struct {
+		utils.Message
+		Fixed string
+		Fixes []struct{ Code, Key, Description string }
+		Patch []struct{ Op, Path, From string }
+	}
+	fix := func(body string) fixResult {
+		req, _ := http.NewRequest("POST", "/api/v1/fix?disableNetwork=true", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		response := executeRequest(req)
+
+		var res fixResult
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+		// the status of the response is the one of the message
+		checkResponseCode(t, res.Status, response.Code)
+		return res
+	}
+
+	res := fix(strings.Replace(string(valid), `releaseDate: "2017-04-15"`, "releaseDate: 15/04/2017", 1))
+	assert.Equal(t, http.StatusOK, res.Status)
+	assert.Contains(t, res.Fixed, "releaseDate: \"2017-04-15\"")
+	assert.Contains(t, res.Fixed, "publiccodeYmlVersion: \"0.2\"")
+	if assert.Len(t, res.Fixes, 2) {
+		assert.Equal(t, "deprecated-key", res.Fixes[0].Code)
+		assert.Equal(t, "invalid-date", res.Fixes[1].Code)
+	}
+	if assert.Len(t, res.Patch, 2) {
+		assert.Equal(t, "/releaseDate", res.Patch[1].Path)
+	}
+
+	// legacy keys are fixed, the license is left to the user
+	res = fix(string(invalid))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Status)
+	assert.NotContains(t, res.Fixed, "onlyFor")
+	assert.NotEmpty(t, res.Fixes)
+	if assert.Len(t, res.ValidationError, 1) {
+		assert.Equal(t, "legal/license", res.ValidationError[0].Key)
+	}
+	for _, w := range res.Warnings {
+		assert.NotEqual(t, utils.CodeDeprecatedKey, w.Code, w.Key)
+	}
+
+	req, _ := http.NewRequest("POST", "/api/v1/fix", strings.NewReader("- not a mapping"))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+}
+
+func TestPreservev1(t *testing.T) {
+	for _, tc := range []struct {
+		path, in, out string
+		status        int
+	}{
+		{"/api/v1/validate?disableNetwork=true&strict=false&preserve=true", "tests/valid.comments.yml", "tests/out_valid.comments.yml", http.StatusOK},
+		// mandatory keys can't be fixed
+		{"/api/v1/fix?disableNetwork=true", "tests/fixable.yml", "tests/out_fixable.yml", http.StatusUnprocessableEntity},
+	} {
+		in, err := ioutil.ReadFile(tc.in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := ioutil.ReadFile(tc.out)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fix := strings.HasPrefix(tc.path, "/api/v1/fix")
+		req, _ := http.NewRequest("POST", tc.path, strings.NewReader(string(in)))
+		if fix {
+			req.Header.Set("Accept", "application/json")
+		}
+		response := executeRequest(req)
+		checkResponseCode(t, tc.status, response.Code)
+
+		body := response.Body.String()
+		if fix {
+			var res struct{ Fixed string }
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+			body = res.Fixed
+		}
+		assert.Equal(t, string(out), body, tc.in)
+	}
+}
+
+func TestValidationRemoteURLBatchv1(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := newGitLabServer(func() {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	})
+	defer server.Close()
+
+	raw := server.URL + "/italia/repo/-/raw/master/tests/"
+	urls := []string{
+		raw + "valid.minimal.yml",
+		raw + "invalid.yml",
+		raw + "valid.minimal.yml",
+		raw + "missing.yml",
+		"not a url",
+		raw + "valid.minimal.yml",
+	}
+	body, _ := json.Marshal(urls)
+
+	req, _ := http.NewRequest("POST", "/api/v1/validateURL/batch?disableNetwork=true", strings.NewReader(string(body)))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/x-ndjson", response.Header().Get("Content-type"))
+
+	results := make(map[int]utils.BatchResult)
+	decoder := json.NewDecoder(response.Body)
+	for decoder.More() {
+		var res utils.BatchResult
+		if err := decoder.Decode(&res); err != nil {
+			log.Fatal(err)
+		}
+		results[res.Index] = res
+	}
+	if !assert.Len(t, results, len(urls)) {
+		return
+	}
+	for i, u := range urls {
+		assert.Equal(t, u, results[i].URL)
+	}
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.NotEmpty(t, results[0].Normalized)
+	assert.Equal(t, http.StatusUnprocessableEntity, results[1].Status)
+	assert.Equal(t, http.StatusBadRequest, results[3].Status)
+	assert.Equal(t, http.StatusBadRequest, results[4].Status)
+	assert.True(t, maxInFlight <= utils.Settings().BatchPerHost, "max in flight %d", maxInFlight)
+
+	// text body, one URL per line
+	req, _ = http.NewRequest("POST", "/api/v1/validateURL/batch?disableNetwork=true", strings.NewReader("# comment\n"+urls[0]+"\n\n"))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, 1, strings.Count(response.Body.String(), "\n"))
+
+	// the limit applies to concurrent batches as a whole
+	mu.Lock()
+	maxInFlight = 0
+	mu.Unlock()
+	var wg sync.WaitGroup
+	for n := 0; n < 3; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var batch []string
+			for i := 0; i < 4; i++ {
+				batch = append(batch, fmt.Sprintf("%svalid.minimal.yml?batch=%d&i=%d", raw, n, i))
+			}
+			body, _ := json.Marshal(batch)
+			req, _ := http.NewRequest("POST", "/api/v1/validateURL/batch?disableNetwork=true", strings.NewReader(string(body)))
+			executeRequest(req)
+		}(n)
+	}
+	wg.Wait()
+	assert.True(t, maxInFlight <= utils.Settings().BatchPerHost, "max in flight %d", maxInFlight)
+
+	req, _ = http.NewRequest("POST", "/api/v1/validateURL/batch", strings.NewReader("\n"))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestValidationRemoteURLCachev1(t *testing.T) {
+	var requests int32
+	server := newGitLabServer(func() { atomic.AddInt32(&requests, 1) })
+	defer server.Close()
+
+	urlString := url.QueryEscape(server.URL + "/italia/repo/-/raw/master/tests/valid.minimal.yml")
+	validate := func(query string, status int) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+urlString+query, nil)
+		response := executeRequest(req)
+		checkResponseCode(t, status, response.Code)
+		return response
+	}
+
+	first := validate("", http.StatusOK)
+	assert.Equal(t, "publiccode-validator; fwd=uri-miss; fwd-status=200; stored", first.Header().Get("Cache-Status"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	second := validate("", http.StatusOK)
+	assert.Regexp(t, `^publiccode-validator; hit; ttl=\d+$`, second.Header().Get("Cache-Status"))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, first.Header()["Warning"], second.Header()["Warning"])
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// options select results of the same entry, errors are cached too
+	strict := validate("&strict=true", http.StatusUnprocessableEntity)
+	assert.Equal(t, "publiccode-validator; fwd=vary-miss; fwd-status=200; stored", strict.Header().Get("Cache-Status"))
+	strict2 := validate("&strict=true", http.StatusUnprocessableEntity)
+	assert.Regexp(t, `; hit;`, strict2.Header().Get("Cache-Status"))
+	assert.Equal(t, strict.Body.String(), strict2.Body.String())
+	assert.Regexp(t, `; hit;`, validate("", http.StatusOK).Header().Get("Cache-Status"))
+
+	// variants stored concurrently are all kept
+	concurrent := url.QueryEscape(server.URL + "/italia/repo/-/raw/master/tests/valid.minimal.yml?concurrent")
+	queries := []string{"", "&strict=true", "&preserve=true", "&strict=false"}
+	var wg sync.WaitGroup
+	for _, query := range queries {
+		wg.Add(1)
+		go func(query string) {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+concurrent+query, nil)
+			executeRequest(req)
+		}(query)
+	}
+	wg.Wait()
+	for _, query := range queries {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+concurrent+query, nil)
+		assert.Regexp(t, `; hit;`, executeRequest(req).Header().Get("Cache-Status"), query)
+	}
+
+	// variants of files without validators are told apart by content
+	doc, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	bare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+			return
+		}
+		w.Write(doc)
+	}))
+	defer bare.Close()
+	bareURL := url.QueryEscape(bare.URL + "/italia/repo/-/raw/master/publiccode.yml")
+	for _, query := range []string{"", "&strict=true"} {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+bareURL+query, nil)
+		assert.Regexp(t, `; fwd=`, executeRequest(req).Header().Get("Cache-Status"), query)
+	}
+	for _, query := range []string{"", "&strict=true"} {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+bareURL+query, nil)
+		assert.Regexp(t, `; hit;`, executeRequest(req).Header().Get("Cache-Status"), query)
+	}
+
+	// the remoteBaseURL of clients is not cached
+	base := validate("&remoteBaseURL="+url.QueryEscape("https://raw.githubusercontent.com/italia/developers.italia.it/master/"), http.StatusOK)
+	assert.Equal(t, "publiccode-validator; fwd=bypass", base.Header().Get("Cache-Status"))
+
+	// expired, revalidated with If-Modified-Since
+	settings := utils.Settings()
+	defer utils.Configure(settings)
+	expired := settings
+	expired.CacheTTL = 0
+	utils.Configure(expired)
+	third := validate("", http.StatusOK)
+	assert.Equal(t, "publiccode-validator; fwd=stale; fwd-status=304; stored", third.Header().Get("Cache-Status"))
+	assert.Equal(t, first.Body.String(), third.Body.String())
+	assert.Equal(t, int32(8), atomic.LoadInt32(&requests))
+}
+
+func TestValidationRemoteURLRefv1(t *testing.T) {
+	doc, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var apiRequests int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v4/") {
+			atomic.AddInt32(&apiRequests, 1)
+		}
+		switch r.URL.EscapedPath() {
+		case "/api":
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+		case "/api/v4/projects/italia%2Frepo":
+			w.Write([]byte(`{"default_branch": "main"}`))
+		case "/api/v4/projects/italia%2Frepo/repository/commits/main":
+			w.Write([]byte(`{"id": "1111111111111111111111111111111111111111"}`))
+		case "/api/v4/projects/italia%2Frepo/repository/commits/v1.0":
+			w.Write([]byte(`{"id": "2222222222222222222222222222222222222222"}`))
+		case "/italia/repo/-/raw/main/publiccode.yml", "/italia/repo/-/raw/v1.0/publiccode.yml":
+			w.Write([]byte(strings.Replace(string(doc), "https://github.com/italia/developers.italia.it.git", server.URL+"/italia/repo", 1)))
+		case "/italia/repo":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	validate := func(query string, status int) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+url.QueryEscape(server.URL+"/italia/repo")+query, nil)
+		response := executeRequest(req)
+		checkResponseCode(t, status, response.Code)
+		return response
+	}
+
+	// default branch
+	response := validate("", http.StatusOK)
+	assert.Equal(t, "main", response.Header().Get("Repository-Ref"))
+	assert.Equal(t, "1111111111111111111111111111111111111111", response.Header().Get("Repository-Commit"))
+
+	// fresh results don't ask the API again
+	requests := atomic.LoadInt32(&apiRequests)
+	response = validate("", http.StatusOK)
+	assert.Regexp(t, `; hit;`, response.Header().Get("Cache-Status"))
+	assert.Equal(t, "1111111111111111111111111111111111111111", response.Header().Get("Repository-Commit"))
+	assert.Equal(t, requests, atomic.LoadInt32(&apiRequests))
+
+	response = validate("&ref=v1.0", http.StatusOK)
+	assert.Equal(t, "v1.0", response.Header().Get("Repository-Ref"))
+	assert.Equal(t, "2222222222222222222222222222222222222222", response.Header().Get("Repository-Commit"))
+
+	// branch is an alias of ref
+	response = validate("&branch=v1.0", http.StatusOK)
+	assert.Equal(t, "v1.0", response.Header().Get("Repository-Ref"))
+
+	response = validate("&ref=v2.0", http.StatusBadRequest)
+	assert.Contains(t, response.Body.String(), "ref v2.0 not found")
+	assert.Empty(t, response.Header().Get("Repository-Ref"))
+
+	response = validate("&ref=..", http.StatusBadRequest)
+	assert.Contains(t, response.Body.String(), "Invalid ref")
+
+	// body, relative paths are resolved at ref
+	body := strings.Replace(string(doc), "https://github.com/italia/developers.italia.it.git", server.URL+"/italia/repo", 1)
+	req, _ := http.NewRequest("POST", "/api/v1/validate?ref=v1.0", strings.NewReader(body))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "v1.0", response.Header().Get("Repository-Ref"))
+	assert.Equal(t, "2222222222222222222222222222222222222222", response.Header().Get("Repository-Commit"))
+
+	// no discovery without network
+	req, _ = http.NewRequest("POST", "/api/v1/validate?disableNetwork=true", strings.NewReader(body))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get("Repository-Ref"))
+}
+
+func TestValidationRemoteURLCredentialsv1(t *testing.T) {
+	doc, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var authorized int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api":
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+			return
+		case "/italia/private":
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&authorized, 1)
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/italia%2Fprivate":
+			w.Write([]byte(`{"default_branch": "main"}`))
+		case "/api/v4/projects/italia%2Fprivate/repository/commits/main":
+			w.Write([]byte(`{"id": "1111111111111111111111111111111111111111"}`))
+		case "/italia/private/-/raw/main/publiccode.yml":
+			w.Write([]byte(strings.Replace(string(doc), "https://github.com/italia/developers.italia.it.git", server.URL+"/italia/private", 1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	validate := func(authorization string, status int) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+url.QueryEscape(server.URL+"/italia/private"), nil)
+		if authorization != "" {
+			req.Header.Set("Repository-Authorization", authorization)
+		}
+		response := executeRequest(req)
+		checkResponseCode(t, status, response.Code)
+		return response
+	}
+
+	validate("", http.StatusBadRequest)
+	validate("Bearer wrong", http.StatusBadRequest)
+	response := validate("Bearer secret", http.StatusOK)
+	assert.Equal(t, "1111111111111111111111111111111111111111", response.Header().Get("Repository-Commit"))
+
+	// results of private repositories are not shared with other clients
+	validate("", http.StatusBadRequest)
+	response = validate("Bearer secret", http.StatusOK)
+	assert.Contains(t, response.Header().Get("Cache-Status"), "hit")
+
+	// the credential of the server is used only for the repositories listed
+	settings := utils.Settings()
+	defer utils.Configure(settings)
+	cfg := settings
+	cfg.Credentials = []config.Credential{{Host: strings.TrimPrefix(server.URL, "http://"), Repositories: []string{"italia/other"}, Token: "secret"}}
+	utils.Configure(cfg)
+	validate("", http.StatusBadRequest)
+
+	// and its results are never cached
+	cfg.Credentials[0].Repositories = []string{"italia/*"}
+	utils.Configure(cfg)
+	for i := 0; i < 2; i++ {
+		response = validate("", http.StatusOK)
+		assert.Equal(t, "publiccode-validator; fwd=bypass", response.Header().Get("Cache-Status"))
+	}
+
+	// but not for the url of submitted documents, chosen by the client
+	atomic.StoreInt32(&authorized, 0)
+	body := strings.Replace(string(doc), "https://github.com/italia/developers.italia.it.git", server.URL+"/italia/private", 1)
+	for _, path := range []string{"/api/v1/validate", "/api/v1/validate/batch", "/api/v1/fix"} {
+		req, _ := http.NewRequest("POST", path+"?ref=main", strings.NewReader(body))
+		response = executeRequest(req)
+		assert.Empty(t, response.Header().Get("Repository-Commit"), path)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&authorized))
+}
+
+func TestValidationPrivateRepov1(t *testing.T) {
+	doc, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var defaultBranchCalls int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api":
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+			return
+		case "/italia/private":
+			return
+		case "/api/v4/projects/italia%2Fprivate":
+			atomic.AddInt32(&defaultBranchCalls, 1)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/italia%2Fprivate":
+			w.Write([]byte(`{"default_branch": "main"}`))
+		case "/api/v4/projects/italia%2Fprivate/repository/commits/main":
+			w.Write([]byte(`{"id": "1111111111111111111111111111111111111111"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	body := strings.Replace(string(doc), "https://github.com/italia/developers.italia.it.git", server.URL+"/italia/private", 1)
+
+	// the default branch of the private repository is asked with the credential
+	req, _ := http.NewRequest("POST", "/api/v1/validate", strings.NewReader(body))
+	req.Header.Set("Repository-Authorization", "Bearer secret")
+	response := executeRequest(req)
+	assert.Equal(t, "main", response.Header().Get("Repository-Ref"))
+	assert.Equal(t, "1111111111111111111111111111111111111111", response.Header().Get("Repository-Commit"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&defaultBranchCalls))
+
+	// without, the repository is resolved once to HEAD
+	atomic.StoreInt32(&defaultBranchCalls, 0)
+	req, _ = http.NewRequest("POST", "/api/v1/validate", strings.NewReader(body))
+	response = executeRequest(req)
+	assert.Equal(t, "HEAD", response.Header().Get("Repository-Ref"))
+	assert.Empty(t, response.Header().Get("Repository-Commit"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&defaultBranchCalls))
+}
+
+// TestValidationOptionsConcurrency checks that validation options
+// are request scoped: concurrent requests with different disableNetwork
+// values must never see each other's settings.
+// Run it with -race to also catch shared state.
+func TestValidationOptionsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	doc, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	endpoints := []string{"/pc/validate", "/api/v1/validate"}
+	const requests = 10
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		for _, endpoint := range endpoints {
+			wg.Add(1)
+			go func(i int, endpoint string) {
+				defer wg.Done()
+				repo := fmt.Sprintf("%s/repo-%d%s", server.URL, i, endpoint)
+				body := strings.Replace(string(doc), "https://github.com/italia/developers.italia.it.git", repo, 1)
+				disableNetwork := i%2 == 0
+
+				req, _ := http.NewRequest("POST", endpoint+"?disableNetwork="+strconv.FormatBool(disableNetwork), strings.NewReader(body))
+				response := executeRequest(req)
+				checkResponseCode(t, http.StatusOK, response.Code)
+			}(i, endpoint)
+		}
+	}
+	wg.Wait()
+
+	for i := 0; i < requests; i++ {
+		for _, endpoint := range endpoints {
+			path := fmt.Sprintf("/repo-%d%s", i, endpoint)
+			if i%2 == 0 {
+				assert.Zero(t, hits[path], "network used with disableNetwork=true: %s", path)
+			} else {
+				assert.NotZero(t, hits[path], "network not used with disableNetwork=false: %s", path)
+			}
+		}
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	level := log.GetLevel()
+	defer log.SetLevel(level)
+
+	var stdout, stderr strings.Builder
+	code := validateCommand([]string{"--no-network", "tests/valid.minimal.yml"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitValid, code)
+	assert.Equal(t, "tests/valid.minimal.yml: valid\n"+
+		"tests/valid.minimal.yml:24:3: warning: description/en/screenshots: missing recommended key\n"+
+		"tests/valid.minimal.yml:1:1: warning: logo: missing recommended key\n"+
+		"tests/valid.minimal.yml:1:1: warning: roadmap: missing recommended key\n", stdout.String())
+
+	// warnings are errors in strict mode
+	stdout.Reset()
+	code = validateCommand([]string{"--no-network", "--strict", "tests/valid.minimal.yml"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitInvalid, code)
+	assert.Contains(t, stdout.String(), "tests/valid.minimal.yml:1:1: roadmap: missing recommended key\n")
+
+	// flags after inputs and same body of /api/v1/validate
+	out, err := ioutil.ReadFile("tests/out_valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	stdout.Reset()
+	code = validateCommand([]string{"tests/valid.minimal.yml", "--no-network", "--output", "yaml"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitValid, code)
+	assert.Equal(t, string(out), stdout.String())
+
+	// stdin
+	fileYML, err := os.Open("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fileYML.Close()
+	stdout.Reset()
+	code = validateCommand([]string{"--no-network", "-"}, fileYML, &stdout, &stderr)
+	assert.Equal(t, exitValid, code)
+
+	// invalid
+	stdout.Reset()
+	code = validateCommand([]string{"--no-network", "--output", "json", "tests/invalid.yml"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitInvalid, code)
+	var message utils.Message
+	err = json.Unmarshal([]byte(stdout.String()), &message)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, message.Status)
+	assert.NotEmpty(t, message.ValidationError)
+
+	// many files, IO errors win over invalid ones
+	stdout.Reset()
+	code = validateCommand([]string{"--no-network", "--output", "json", "tests/valid.minimal.yml", "tests/invalid.yml", "tests/missing.yml"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitIOError, code)
+	var results []validateResult
+	err = json.Unmarshal([]byte(stdout.String()), &results)
+	assert.Nil(t, err)
+	assert.Len(t, results, 3)
+	assert.True(t, results[0].Valid)
+	assert.False(t, results[1].Valid)
+	assert.False(t, results[2].Valid)
+
+	// inputs after -- are never flags
+	stdout.Reset()
+	code = validateCommand([]string{"tests/valid.minimal.yml", "--no-network", "--", "-odd-name.yml", "--strict"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitIOError, code)
+	assert.Contains(t, stdout.String(), "tests/valid.minimal.yml: valid\n")
+	assert.Contains(t, stdout.String(), "-odd-name.yml: Error reading input: ")
+	assert.Contains(t, stdout.String(), "--strict: Error reading input: ")
+
+	// usage
+	code = validateCommand([]string{"--output", "xml", "tests/valid.minimal.yml"}, nil, &stdout, &stderr)
+	assert.Equal(t, exitUsage, code)
+	code = validateCommand(nil, nil, &stdout, &stderr)
+	assert.Equal(t, exitUsage, code)
+}
+
+func TestMetrics(t *testing.T) {
+	server := newGitLabServer(nil)
+	defer server.Close()
+	// hosts are labeled only for known forges
+	host := strings.TrimPrefix(server.URL, "http://")
+	settings := utils.Settings()
+	defer utils.Configure(settings)
+	cfg := settings
+	cfg.Forges = []config.Forge{{Host: host, Type: config.ForgeGitLab}}
+	utils.Configure(cfg)
+	// requests are observed by the outbound transport
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+	cfg.AllowPrivateNetworks = true
+	assert.Nil(t, setupOutbound(cfg))
+
+	fileYML, err := os.Open("tests/invalid_legal_license.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/api/v1/validate?disableNetwork=true", fileYML)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	req, _ = http.NewRequest("POST", "/api/v1/validateURL?disableNetwork=true&url="+
+		url.QueryEscape(server.URL+"/italia/repo/-/raw/master/tests/valid.minimal.yml"), nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	for _, metric := range []string{
+		`publiccode_validator_http_requests_total{code="422",method="POST",route="/api/v1/validate"}`,
+		`publiccode_validator_http_request_duration_seconds_count{code="200",method="POST",route="/api/v1/validateURL"}`,
+		`publiccode_validator_http_requests_in_flight 1`,
+		`publiccode_validator_validations_total{outcome="invalid"}`,
+		`publiccode_validator_validations_total{outcome="valid"}`,
+		`publiccode_validator_validation_errors_total{key="legal/license"}`,
+		`publiccode_validator_remote_fetch_duration_seconds_count{host="` + host + `"} 1`,
+	} {
+		assert.Contains(t, response.Body.String(), metric)
+	}
+	assert.NotContains(t, response.Body.String(), `remote_fetch_failures_total{host="`+host+`"}`)
+}
+
+func TestHealth(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, response.Body.String())
+
+	defer func(lookup func(context.Context, string) ([]string, error)) { lookupHost = lookup }(lookupHost)
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"127.0.0.1"}, nil
+	}
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{"parser":"ok","network":"ok"}}`, response.Body.String())
+
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusServiceUnavailable, response.Code)
+	assert.JSONEq(t, `{"status":"unavailable","checks":{"parser":"ok","network":"lookup raw.githubusercontent.com: no such host"}}`, response.Body.String())
+
+	app.Config.DisableNetwork = true
+	defer func() { app.Config.DisableNetwork = false }()
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{"parser":"ok","network":"disabled"}}`, response.Body.String())
+
+	// the parser has to validate a valid document
+	defer func(b []byte) { readinessDocument = b }(readinessDocument)
+	readinessDocument = []byte("name: Medusa\n")
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusServiceUnavailable, response.Code)
+	assert.Contains(t, response.Body.String(), `"status":"unavailable"`)
+	assert.NotContains(t, response.Body.String(), `"parser":"ok"`)
+}
+
+func TestVersionv1(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/v1/version", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var v Version
+	if err := json.Unmarshal(response.Body.Bytes(), &v); err != nil {
+		log.Fatal(err)
+	}
+	assert.Equal(t, version, v.Version)
+	assert.Equal(t, date, v.Date)
+	assert.Equal(t, "v1.2.2", v.ParserVersion)
+	assert.Equal(t, []string{"0.1", "0.2"}, v.PubliccodeYmlVersions)
+	assert.Equal(t, "0.2", v.PubliccodeYmlVersion)
+}
+
+func TestDiffv1(t *testing.T) {
+	valid, err := ioutil.ReadFile("tests/valid.minimal.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("POST", "/api/v1/diff?disableNetwork=true", strings.NewReader(string(valid)))
+	req.Header.Set("Accept", "application/json")
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var res struct {
+		utils.Message
+		Normalized string `json:"normalized"`
+		Changes    []struct {
+			Type, Key, From string
+			Old, New        interface{}
+		}
+		Unified string
+	}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+	assert.Equal(t, http.StatusOK, res.Status)
+	assert.Contains(t, res.Normalized, `publiccodeYmlVersion: "0.2"`)
+	assert.Contains(t, res.Unified, "--- submitted\n+++ normalized\n")
+	assert.Contains(t, res.Unified, "-publiccodeYmlVersion: \"0.1\"\n")
+	changes := map[string]string{}
+	for _, c := range res.Changes {
+		changes[c.Key] = c.Type
+	}
+	assert.Equal(t, "changed", changes["publiccodeYmlVersion"])
+	assert.Equal(t, "changed", changes["softwareType"])
+	assert.Equal(t, "added", changes["it"])
+
+	req, _ = http.NewRequest("POST", "/api/v1/diff?disableNetwork=true", strings.NewReader(string(valid)))
+	req.Header.Set("Accept", "text/x-diff")
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/x-diff; charset=utf-8", response.Header().Get("Content-type"))
+	assert.Equal(t, res.Unified, response.Body.String())
+
+	req, _ = http.NewRequest("POST", "/api/v1/diff", strings.NewReader("- a list"))
+	req.Header.Set("Accept", "text/x-diff")
+	response = executeRequest(req)
+	assert.NotEqual(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-type"))
+}
+
+func TestSchemav1(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/v1/schema/0.2", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/schema+json", response.Header().Get("Content-type"))
+
+	var s map[string]interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &s); err != nil {
+		log.Fatal(err)
+	}
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", s["$schema"])
+	assert.Contains(t, s["definitions"], "ExtensionIT")
+
+	req, _ = http.NewRequest("GET", "/api/v1/schema/0.3?lang=it", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+	assert.Contains(t, response.Body.String(), "Versione non supportata")
+}
+
+func TestSetupOutbound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer server.Close()
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+
+	// local servers are refused by default
+	assert.Nil(t, setupOutbound(config.Default()))
+	_, err := utils.FetchConditional(context.Background(), server.URL, "", "", nil)
+	assert.NotNil(t, err)
+
+	cfg := config.Default()
+	cfg.AllowPrivateNetworks = true
+	assert.Nil(t, setupOutbound(cfg))
+	file, err := utils.FetchConditional(context.Background(), server.URL, "", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "publiccode-validator/"+version+" (+https://github.com/italia/publiccode-validator)", string(file.Body))
+
+	cfg.UserAgent = "crawler"
+	cfg.FetchMaxSize = 4
+	assert.Nil(t, setupOutbound(cfg))
+	_, err = utils.FetchConditional(context.Background(), server.URL, "", "", nil)
+	assert.NotNil(t, err)
+
+	cfg.Proxy = "::"
+	assert.NotNil(t, setupOutbound(cfg))
+}
+
+func TestRefusedURL(t *testing.T) {
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+	assert.Nil(t, setupOutbound(config.Default()))
+
+	for _, u := range []string{"http://127.0.0.1:8080/publiccode.yml", "http://192.168.1.1/publiccode.yml"} {
+		req, _ := http.NewRequest("POST", "/pc/validateURL?url="+url.QueryEscape(u), nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusForbidden, response.Code)
+		assert.Contains(t, response.Body.String(), "URL refused", u)
+	}
+}
+
+func TestRefusedURLv1(t *testing.T) {
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+	cfg := config.Default()
+	cfg.DeniedHosts = []string{"*.internal"}
+	assert.Nil(t, setupOutbound(cfg))
+
+	for _, u := range []string{"http://127.0.0.1:8080/publiccode.yml", "http://169.254.169.254/latest/meta-data", "http://[::1]/publiccode.yml", "https://git.internal/publiccode.yml", "file:///etc/passwd"} {
+		req, _ := http.NewRequest("POST", "/api/v1/validateURL?lang=it&url="+url.QueryEscape(u), nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusForbidden, response.Code)
+		assert.Contains(t, response.Body.String(), "URL rifiutato", u)
+	}
+
+	req, _ := http.NewRequest("POST", "/api/v1/validateURL/batch", strings.NewReader("http://10.0.0.1/publiccode.yml\n"))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var res utils.BatchResult
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &res))
+	assert.Equal(t, http.StatusForbidden, res.Status)
+	assert.Equal(t, "URL refused", res.Message.Message)
+}
+
 // Utility functions to make mock request and check response
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
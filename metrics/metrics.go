@@ -0,0 +1,142 @@
+// Package metrics collects the Prometheus metrics exposed on /metrics
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "publiccode_validator"
+
+// Outcomes of a validation
+const (
+	OutcomeValid   = "valid"
+	OutcomeInvalid = "invalid"
+	OutcomeError   = "error"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+
+	validations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validations_total",
+		Help:      "Validated documents by outcome: valid, invalid or error.",
+	}, []string{"outcome"})
+
+	validationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_errors_total",
+		Help:      "Validation errors by key, languages and indexes are replaced by *.",
+	}, []string{"key"})
+
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "remote_fetch_duration_seconds",
+		Help:      "Latency of outbound requests by forge.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host"})
+
+	fetchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "remote_fetch_failures_total",
+		Help:      "Failed outbound requests, errors and 4xx or 5xx responses, by forge.",
+	}, []string{"host"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		requests, requestDuration, inFlight,
+		validations, validationErrors,
+		fetchDuration, fetchFailures,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and their latency by route template,
+// method and status code
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		code := strconv.Itoa(rec.status)
+		requests.WithLabelValues(route, r.Method, code).Inc()
+		requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder keeps the status code written by handlers
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streamed responses working
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ObserveValidation counts a validated document and its error keys
+func ObserveValidation(outcome string, keys []string) {
+	validations.WithLabelValues(outcome).Inc()
+	for _, key := range keys {
+		validationErrors.WithLabelValues(key).Inc()
+	}
+}
+
+// ObserveFetch records an outbound request started at start
+func ObserveFetch(host string, start time.Time, err error) {
+	fetchDuration.WithLabelValues(host).Observe(time.Since(start).Seconds())
+	if err != nil {
+		fetchFailures.WithLabelValues(host).Inc()
+	}
+}
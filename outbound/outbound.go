@@ -0,0 +1,342 @@
+// Package outbound is the HTTP client of the requests of the validator
+// to remote hosts: raw files, APIs of hosting platforms and the checks
+// of the parser
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultBackoff is the wait before the first retry when Options.Backoff is 0
+const DefaultBackoff = 500 * time.Millisecond
+
+// Options of outbound requests
+type Options struct {
+	// Timeout is the time limit of every attempt of a request,
+	// reading the body included. 0 for none
+	Timeout time.Duration
+	// Retries is how many times GET and HEAD requests are retried
+	// after network errors, 429 and 5xx responses other than 501
+	Retries int
+	// Backoff is the wait before the first retry, doubled at every
+	// following one
+	Backoff time.Duration
+	// MaxRedirects is the number of redirects followed
+	MaxRedirects int
+	// MaxBodySize is the size limit in bytes of response bodies,
+	// 0 for none
+	MaxBodySize int64
+	// UserAgent is set on requests without one
+	UserAgent string
+	// Proxy is the URL of the proxy, if empty it's read from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	Proxy string
+	// Policy tells which URLs can be fetched, any if nil
+	Policy *Policy
+	// Observe is called at the end of every request, retries and
+	// redirects included, with the host of its URL, when it started
+	// and its error or the one of a 4xx or 5xx response. Optional
+	Observe func(host string, start time.Time, err error)
+}
+
+// Transport is the http.RoundTripper of outbound requests. Unlike
+// http.Transport it follows redirects itself, so that the limit and
+// the Policy apply to clients it doesn't build, like the one of the parser
+type Transport struct {
+	Options
+	// Base does the requests
+	Base http.RoundTripper
+	// sleep waits before retries, replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns the Transport with opts, doing requests through the
+// proxy of opts with the settings of http.DefaultTransport
+func New(opts Options) (*Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", opts.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &Transport{
+		Options: opts,
+		Base: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dialPinned(dialer),
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}, nil
+}
+
+// dialPinned returns a DialContext connecting to the addresses
+// checked by the Policy, if any, instead of resolving them again
+func dialPinned(dialer *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		ips, ok := pinned(ctx, addr)
+		if !ok {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// client is the client of outbound requests, its transport is
+// http.DefaultTransport, see Install
+var client = &http.Client{}
+
+// Install makes t the transport of every outbound request: the ones
+// of Client and of http.DefaultTransport, used by the parser and by
+// vcsurl. It must be called before doing requests
+func Install(t *Transport) {
+	http.DefaultTransport = t
+}
+
+// installed returns the Transport set by Install
+func installed() (*Transport, bool) {
+	t, ok := http.DefaultTransport.(*Transport)
+	return t, ok
+}
+
+// Client returns the client of outbound requests
+func Client() *http.Client {
+	return client
+}
+
+// RoundTrip does req with retries, following redirects
+func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if t.Observe != nil {
+		defer func(host string, start time.Time) {
+			failure := err
+			if failure == nil && resp.StatusCode >= 400 {
+				failure = fmt.Errorf("%s %s returned %s", req.Method, req.URL, resp.Status)
+			}
+			t.Observe(host, start, failure)
+		}(req.URL.Host, time.Now())
+	}
+
+	for redirects := 0; ; redirects++ {
+		resp, err = t.retry(req)
+		if err != nil {
+			return nil, err
+		}
+		next := redirect(req, resp)
+		if next == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if redirects >= t.MaxRedirects {
+			return nil, fmt.Errorf("%s %s: stopped after %d redirects", req.Method, req.URL, t.MaxRedirects)
+		}
+		req = next
+	}
+}
+
+// retry does req, again after failures of idempotent requests
+func (t *Transport) retry(req *http.Request) (*http.Response, error) {
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = wait
+	}
+	for n := 0; ; n++ {
+		resp, err := t.do(req)
+		if n >= t.Retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), t.Backoff<<uint(n)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// do is a single attempt of req
+func (t *Transport) do(req *http.Request) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+	}
+	if t.Policy != nil {
+		ips, err := t.Policy.check(ctx, req.URL)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, pinKey{}, pin{addr: hostPort(req.URL), ips: ips})
+	}
+	r := req.WithContext(ctx)
+	r.Header = cloneHeader(req.Header)
+	if r.Header.Get("User-Agent") == "" && t.UserAgent != "" {
+		r.Header.Set("User-Agent", t.UserAgent)
+	}
+
+	resp, err := t.Base.RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if t.MaxBodySize > 0 && resp.ContentLength > t.MaxBodySize {
+		resp.Body.Close()
+		cancel()
+		return nil, tooLarge(req, t.MaxBodySize)
+	}
+	resp.Body = &body{ReadCloser: resp.Body, req: req, left: t.MaxBodySize, max: t.MaxBodySize, cancel: cancel}
+	return resp, nil
+}
+
+// retryable tells whether the outcome of req is a failure that can go
+// away, for requests that can be repeated
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+	if _, ok := err.(*RefusedError); ok {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
+
+// wait sleeps for d, or until ctx is done
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// redirect returns the request following the redirect resp,
+// nil if resp is not a redirect that can be followed
+func redirect(req *http.Request, resp *http.Response) *http.Request {
+	method := req.Method
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != "GET" && method != "HEAD" {
+			method = "GET"
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if req.Body != nil && req.GetBody == nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil
+	}
+	u, err := req.URL.Parse(location)
+	if err != nil {
+		return nil
+	}
+
+	next := req.WithContext(req.Context())
+	next.Method = method
+	next.URL = u
+	next.Host = ""
+	next.Header = cloneHeader(req.Header)
+	if method != req.Method {
+		next.Body, next.GetBody, next.ContentLength = nil, nil, 0
+		next.Header.Del("Content-Type")
+	} else if req.GetBody != nil {
+		next.Body, _ = req.GetBody()
+	}
+	if !sameHost(req.URL, u) {
+		// credentials are for the host they were sent to
+		next.Header.Del("Authorization")
+		next.Header.Del("Cookie")
+	}
+	return next
+}
+
+// sameHost tells whether a and b are on the same host and port
+func sameHost(a *url.URL, b *url.URL) bool {
+	return a.Scheme == b.Scheme && a.Host == b.Host
+}
+
+// cloneHeader returns a copy of h
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// tooLarge is the error of bodies over max
+func tooLarge(req *http.Request, max int64) error {
+	return fmt.Errorf("%s %s: response body larger than %d bytes", req.Method, req.URL, max)
+}
+
+// body is a response body limited to max bytes, if positive.
+// Closing it releases the timeout of the request
+type body struct {
+	io.ReadCloser
+	req    *http.Request
+	left   int64
+	max    int64
+	cancel context.CancelFunc
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.max <= 0 {
+		return b.ReadCloser.Read(p)
+	}
+	if b.left < 0 {
+		return 0, tooLarge(b.req, b.max)
+	}
+	// read one byte over the limit to tell a body of max bytes
+	// from a larger one
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n + int(b.left), tooLarge(b.req, b.max)
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
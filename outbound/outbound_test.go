@@ -0,0 +1,220 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTransport returns a Transport with opts, recording
+// the waits before retries instead of sleeping
+func newTransport(t *testing.T, opts Options) (*Transport, *[]time.Duration) {
+	tr, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waits []time.Duration
+	tr.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return tr, &waits
+}
+
+func get(t *testing.T, tr *Transport, url string, header http.Header) (*http.Response, string, error) {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	return resp, string(b), err
+}
+
+func TestUserAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer server.Close()
+	tr, _ := newTransport(t, Options{UserAgent: "publiccode-validator/test"})
+
+	_, body, err := get(t, tr, server.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "publiccode-validator/test", body)
+
+	_, body, err = get(t, tr, server.URL, http.Header{"User-Agent": {"other"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "other", body)
+}
+
+func TestRetries(t *testing.T) {
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	tr, waits := newTransport(t, Options{Retries: 2, Backoff: time.Second})
+
+	resp, body, err := get(t, tr, server.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *waits)
+
+	// the last failure is returned
+	failures = 3
+	resp, _, err = get(t, tr, server.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// POST is not retried
+	failures = 1
+	resp, err = (&http.Client{Transport: tr}).Post(server.URL, "text/plain", strings.NewReader("x"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other " + r.Header.Get("Authorization")))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/file", http.StatusMovedPermanently)
+		case "/away":
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		case "/file":
+			w.Write([]byte("file " + r.Header.Get("Authorization")))
+		}
+	}))
+	defer server.Close()
+	tr, _ := newTransport(t, Options{MaxRedirects: 3})
+	auth := http.Header{"Authorization": {"Bearer secret"}}
+
+	resp, body, err := get(t, tr, server.URL+"/moved", auth)
+	assert.NoError(t, err)
+	assert.Equal(t, "file Bearer secret", body)
+	assert.Equal(t, server.URL+"/file", resp.Request.URL.String())
+
+	// credentials are not sent to other hosts
+	_, body, err = get(t, tr, server.URL+"/away", auth)
+	assert.NoError(t, err)
+	assert.Equal(t, "other ", body)
+
+	_, _, err = get(t, tr, server.URL+"/loop", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "stopped after 3 redirects")
+}
+
+func TestObserve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/file", http.StatusFound)
+		case "/file":
+			w.Write([]byte("file"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	var observed []string
+	tr, _ := newTransport(t, Options{MaxRedirects: 1, Retries: 1, Observe: func(host string, start time.Time, err error) {
+		assert.False(t, start.IsZero())
+		observed = append(observed, host+" "+strings.Replace(fmt.Sprint(err), server.URL, "", -1))
+	}})
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// once per request, redirects included
+	_, _, err := get(t, tr, server.URL+"/moved", nil)
+	assert.NoError(t, err)
+	_, _, err = get(t, tr, server.URL+"/missing", nil)
+	assert.NoError(t, err)
+	_, _, err = get(t, tr, "http://127.0.0.1:1/file", nil)
+	assert.Error(t, err)
+	if assert.Len(t, observed, 3) {
+		assert.Equal(t, host+" <nil>", observed[0])
+		assert.Equal(t, host+" GET /missing returned 404 Not Found", observed[1])
+		assert.Contains(t, observed[2], "127.0.0.1:1 ")
+		assert.NotContains(t, observed[2], "<nil>")
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(strings.Repeat("x", 10)))
+	}))
+	defer server.Close()
+
+	tr, _ := newTransport(t, Options{MaxBodySize: 10})
+	_, body, err := get(t, tr, server.URL+"/chunked", nil)
+	assert.NoError(t, err)
+	assert.Len(t, body, 10)
+
+	tr, _ = newTransport(t, Options{MaxBodySize: 9})
+	_, _, err = get(t, tr, server.URL, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than 9 bytes")
+
+	_, body, err = get(t, tr, server.URL+"/chunked", nil)
+	assert.Error(t, err)
+	assert.Len(t, body, 9)
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	tr, waits := newTransport(t, Options{Timeout: 50 * time.Millisecond, Retries: 1})
+	start := time.Now()
+	_, _, err := get(t, tr, server.URL, nil)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Len(t, *waits, 1)
+}
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	tr, _ := newTransport(t, Options{Proxy: proxy.URL})
+	_, body, err := get(t, tr, "http://repo.example.org/publiccode.yml", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "proxied http://repo.example.org/publiccode.yml", body)
+
+	_, err = New(Options{Proxy: "proxy.example.org"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,190 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// privateNetworks are the ranges refused unless AllowPrivateNetworks
+// is set: loopback, private, link-local, shared and unspecified
+// addresses, multicast, the IPv6 equivalents and the NAT64 prefix,
+// which maps IPv4 addresses into IPv6
+var privateNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = n
+	}
+	return networks
+}
+
+// RefusedError is returned for URLs the Policy doesn't allow to fetch
+type RefusedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *RefusedError) Error() string {
+	return fmt.Sprintf("URL %s refused: %s", e.URL, e.Reason)
+}
+
+// Refused returns the RefusedError of err, a request error
+func Refused(err error) (*RefusedError, bool) {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	e, ok := err.(*RefusedError)
+	return e, ok
+}
+
+// Policy tells which URLs can be fetched. Hosts are checked after DNS
+// resolution, and connections go to the addresses checked
+type Policy struct {
+	// AllowPrivateNetworks allows hosts resolving to loopback,
+	// private and link-local addresses
+	AllowPrivateNetworks bool
+	// AllowedHosts are fetched even if they match DeniedHosts or
+	// resolve to private addresses. *.example.org matches the
+	// subdomains of example.org, * every host
+	AllowedHosts []string
+	// DeniedHosts are never fetched, with the same patterns
+	DeniedHosts []string
+}
+
+// matchHost tells whether host matches one of patterns
+func matchHost(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		switch {
+		case p == "*":
+			return true
+		case strings.HasPrefix(p, "*."):
+			if strings.HasSuffix(host, p[1:]) {
+				return true
+			}
+		case p == host:
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the addresses u can be fetched from, a RefusedError
+// if not allowed. No addresses are returned for AllowedHosts, which
+// are resolved when connecting
+func (p *Policy) check(ctx context.Context, u *url.URL) ([]net.IP, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, &RefusedError{URL: u.String(), Reason: fmt.Sprintf("scheme %q is not http or https", u.Scheme)}
+	}
+	host := u.Hostname()
+	if host == "" {
+		return nil, &RefusedError{URL: u.String(), Reason: "missing host"}
+	}
+	if matchHost(host, p.AllowedHosts) {
+		return nil, nil
+	}
+	if matchHost(host, p.DeniedHosts) {
+		return nil, &RefusedError{URL: u.String(), Reason: fmt.Sprintf("host %s is denied", host)}
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+		if !p.AllowPrivateNetworks && private(addr.IP) {
+			return nil, &RefusedError{URL: u.String(), Reason: fmt.Sprintf("host %s resolves to the private address %s", host, addr.IP)}
+		}
+	}
+	return ips, nil
+}
+
+// private tells whether ip is in one of privateNetworks
+func private(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a RefusedError if the Policy of the installed Transport
+// doesn't allow to fetch urlString, for URLs checked before fetching.
+// The Transport checks every request anyway, redirects included
+func Check(ctx context.Context, urlString string) error {
+	t, ok := installed()
+	if !ok || t.Policy == nil {
+		return nil
+	}
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return err
+	}
+	_, err = t.Policy.check(ctx, u)
+	return err
+}
+
+// pinKey is the context key of the addresses checked by the
+// Policy for a request, the ones the connection goes to
+type pinKey struct{}
+
+// pin is the host and port of a request with the addresses checked
+type pin struct {
+	addr string
+	ips  []net.IP
+}
+
+// pinned returns the checked addresses of addr, the host and port
+// dialed, in ctx. None when dialing a proxy
+func pinned(ctx context.Context, addr string) ([]net.IP, bool) {
+	p, ok := ctx.Value(pinKey{}).(pin)
+	if !ok || p.addr != addr || len(p.ips) == 0 {
+		return nil, false
+	}
+	return p.ips, true
+}
+
+// hostPort returns the host and port dialed for u
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,86 @@
+package outbound
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchHost(t *testing.T) {
+	assert.True(t, matchHost("github.com", []string{"gitlab.com", "GitHub.com"}))
+	assert.True(t, matchHost("git.comune.example.it", []string{"*.example.it"}))
+	assert.True(t, matchHost("anything", []string{"*"}))
+	assert.False(t, matchHost("example.it", []string{"*.example.it"}))
+	assert.False(t, matchHost("notexample.it", []string{"*.example.it"}))
+	assert.False(t, matchHost("github.com", nil))
+}
+
+func TestPrivate(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.20.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "0.1.2.3", "100.64.0.1", "100.127.255.254", "198.18.0.1", "198.19.255.254", "::1", "64:ff9b::7f00:1", "64:ff9b::a9fe:a9fe", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+		assert.True(t, private(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "151.101.1.1", "100.128.0.1", "198.20.0.1", "2001:4860:4860::8888", "64:ff9b:1::1"} {
+		assert.False(t, private(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			http.Redirect(w, r, "http://"+r.Host+"/file", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+
+	tr, _ := newTransport(t, Options{Policy: &Policy{}, Retries: 2})
+	_, _, err := get(t, tr, server.URL, nil)
+	refused, ok := Refused(err)
+	assert.True(t, ok)
+	assert.Equal(t, server.URL, refused.URL)
+	assert.Contains(t, err.Error(), "private address 127.0.0.1")
+
+	_, _, err = get(t, tr, "ftp://example.org/publiccode.yml", nil)
+	_, ok = Refused(err)
+	assert.True(t, ok)
+
+	// allowed hosts are trusted, connections go to the checked addresses
+	tr, _ = newTransport(t, Options{Policy: &Policy{AllowedHosts: []string{"localhost"}}, MaxRedirects: 1})
+	_, body, err := get(t, tr, "http://localhost:"+port+"/file", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", body)
+
+	tr, _ = newTransport(t, Options{Policy: &Policy{AllowPrivateNetworks: true}})
+	_, body, err = get(t, tr, "http://localhost:"+port+"/file", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", body)
+
+	// redirects are checked
+	tr, _ = newTransport(t, Options{Policy: &Policy{AllowedHosts: []string{"localhost"}}, MaxRedirects: 1})
+	_, _, err = get(t, tr, server.URL, nil)
+	_, ok = Refused(err)
+	assert.True(t, ok)
+	_, _, err = get(t, tr, "http://localhost:"+port+"/internal", nil)
+	assert.NoError(t, err)
+
+	tr, _ = newTransport(t, Options{Policy: &Policy{AllowPrivateNetworks: true, DeniedHosts: []string{"localhost"}}})
+	_, _, err = get(t, tr, "http://localhost:"+port+"/file", nil)
+	assert.Contains(t, err.Error(), "host localhost is denied")
+
+	// Check uses the installed Transport
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+	assert.NoError(t, Check(context.Background(), server.URL))
+	tr, _ = newTransport(t, Options{Policy: &Policy{DeniedHosts: []string{"*.internal"}}})
+	Install(tr)
+	err = Check(context.Background(), "https://git.internal/repo")
+	_, ok = Refused(err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,158 @@
+package schema
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alranel/go-spdx/spdx"
+	"github.com/italia/publiccode-parser-go"
+)
+
+// patterns of the values checked by the parser with regular
+// expressions, in the common subset of Go and ECMA 262 syntax
+const (
+	emailPattern    = `^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`
+	mimePattern     = `^ *([A-Za-z0-9][A-Za-z0-9!#$&^_-]{0,126})/([A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}) *$`
+	countryPattern  = `^[A-Za-z]{2}$`
+	languagePattern = `^[A-Za-z]{2,3}([-_][A-Za-z0-9]{1,8})*$`
+	logoPattern     = `\.([Ss][Vv][Gg][Zz]?|[Pp][Nn][Gg])$`
+	imagePattern    = `\.([Jj][Pp][Gg]|[Pp][Nn][Gg])$`
+)
+
+// required are the mandatory properties of the
+// objects at key, the same of the parser
+var required = map[string][]string{
+	"": {"publiccodeYmlVersion", "name", "url", "releaseDate", "platforms", "categories",
+		"developmentStatus", "softwareType", "description", "legal", "maintenance", "localisation"},
+	"legal":        {"license"},
+	"maintenance":  {"type"},
+	"localisation": {"localisationReady", "availableLanguages"},
+	"Desc":         {"genericName", "shortDescription"},
+	"Contractor":   {"name", "until"},
+	"Contact":      {"name"},
+	"Dependency":   {"name"},
+}
+
+// rule adds a constraint to a schema
+type rule func(s *Schema)
+
+// rules are the constraints of values at key. Keys are paths from the
+// root or from named types (e.g. Desc/genericName), with * for items
+// of lists and values of maps
+var rules = map[string][]rule{
+	"url":                          {format("uri")},
+	"landingURL":                   {format("uri")},
+	"isBasedOn":                    {orString},
+	"releaseDate":                  {format("date")},
+	"logo":                         {pattern(logoPattern)},
+	"monochromeLogo":               {pattern(logoPattern)},
+	"inputTypes/*":                 {pattern(mimePattern)},
+	"outputTypes/*":                {pattern(mimePattern)},
+	"platforms":                    {orString},
+	"roadmap":                      {format("uri")},
+	"developmentStatus":            {enum("concept", "development", "beta", "stable", "obsolete")},
+	"intendedAudience/countries/*": {pattern(countryPattern)},
+	"intendedAudience/unsupportedCountries/*": {pattern(countryPattern)},
+	"description":                       {minProperties(1), propertyNames(languagePattern)},
+	"legal/license":                     {licensePattern},
+	"maintenance":                       {maintainers},
+	"localisation/availableLanguages/*": {pattern(languagePattern)},
+
+	// standalone is upgraded to standalone/other
+	"softwareType": {enum("standalone/mobile", "standalone/iot", "standalone/desktop", "standalone/web",
+		"standalone/backend", "standalone/other", "addon", "library", "configurationFiles", "standalone")},
+	"maintenance/type": {enum("internal", "contract", "community", "none")},
+
+	// the parser ignores unknown keys of descriptions
+	"Desc":                  {additionalProperties},
+	"Desc/genericName":      {length(1, 35)},
+	"Desc/shortDescription": {length(0, 150)},
+	"Desc/longDescription":  {length(500, 10000)},
+	"Desc/documentation":    {format("uri")},
+	"Desc/apiDocumentation": {format("uri")},
+	"Desc/features/*":       {length(0, 100)},
+	"Desc/screenshots/*":    {pattern(imagePattern)},
+	"Desc/videos/*":         {format("uri")},
+
+	"Contractor/email":   {pattern(emailPattern)},
+	"Contractor/website": {format("uri")},
+	"Contractor/until":   {format("date")},
+	"Contact/email":      {pattern(emailPattern)},
+	// phone numbers are converted to strings
+	"Contact/phone": {types("string", "number")},
+
+	"ExtensionIT/countryExtensionVersion": {enum(publiccode.ExtensionITSupportedVersions...)},
+}
+
+// apply adds the rules of key to s
+func apply(key string, s *Schema) {
+	for _, r := range rules[key] {
+		r(s)
+	}
+}
+
+func format(f string) rule {
+	return func(s *Schema) { s.Format = f }
+}
+
+func pattern(p string) rule {
+	return func(s *Schema) { s.Pattern = p }
+}
+
+func enum(values ...string) rule {
+	return func(s *Schema) { s.Enum = values }
+}
+
+func types(t ...string) rule {
+	return func(s *Schema) { s.Type = t }
+}
+
+func length(min int, max int) rule {
+	return func(s *Schema) { s.MinLength, s.MaxLength = min, max }
+}
+
+func minProperties(n int) rule {
+	return func(s *Schema) { s.MinProperties = n }
+}
+
+func propertyNames(p string) rule {
+	return func(s *Schema) { s.PropertyNames = &Schema{Pattern: p} }
+}
+
+// orString accepts a single string in place of a list
+func orString(s *Schema) {
+	s.Type = []string{"array", "string"}
+}
+
+func additionalProperties(s *Schema) {
+	s.AdditionalProperties = true
+}
+
+// maintainers requires contractors for contract maintenance,
+// contacts for internal and community maintenance
+func maintainers(s *Schema) {
+	s.AllOf = []*Schema{
+		{
+			If:   &Schema{Properties: map[string]*Schema{"type": {Const: "contract"}}, Required: []string{"type"}},
+			Then: &Schema{Required: []string{"contractors"}},
+		},
+		{
+			If:   &Schema{Properties: map[string]*Schema{"type": {Enum: []string{"internal", "community"}}}, Required: []string{"type"}},
+			Then: &Schema{Required: []string{"contacts"}},
+		},
+	}
+}
+
+// licensePattern matches the SPDX expressions accepted by the parser:
+// license identifiers, optionally followed by +, joined by AND or OR.
+// Balance of parentheses isn't checked
+func licensePattern(s *Schema) {
+	var ids []string
+	for _, l := range spdx.List() {
+		ids = append(ids, regexp.QuoteMeta(l.ID))
+	}
+	sort.Strings(ids)
+	license := `[( ]*(` + strings.Join(ids, "|") + `)\+*[ )]*`
+	s.Pattern = `^` + license + `( (AND|OR) ` + license + `)*$`
+}
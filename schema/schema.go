@@ -0,0 +1,204 @@
+// Package schema generates the JSON Schema of publiccode.yml documents
+// from the structs of the parser, with the constraints the validator
+// enforces without network checks
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/utils"
+)
+
+// Draft is the JSON Schema version of the generated schemas
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema, limited to the keywords used here
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	// Type is a string or a list of strings
+	Type      interface{} `json:"type,omitempty"`
+	Const     interface{} `json:"const,omitempty"`
+	Enum      []string    `json:"enum,omitempty"`
+	Format    string      `json:"format,omitempty"`
+	Pattern   string      `json:"pattern,omitempty"`
+	MinLength int         `json:"minLength,omitempty"`
+	MaxLength int         `json:"maxLength,omitempty"`
+	Items     *Schema     `json:"items,omitempty"`
+
+	Properties    map[string]*Schema `json:"properties,omitempty"`
+	PropertyNames *Schema            `json:"propertyNames,omitempty"`
+	// AdditionalProperties is a bool or a *Schema
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	MinProperties        int         `json:"minProperties,omitempty"`
+	Required             []string    `json:"required,omitempty"`
+
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	AllOf []*Schema `json:"allOf,omitempty"`
+	If    *Schema   `json:"if,omitempty"`
+	Then  *Schema   `json:"then,omitempty"`
+
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// Generate returns the schema of documents with version as
+// publiccodeYmlVersion, one of publiccode.SupportedVersions
+func Generate(version string) (*Schema, error) {
+	if !supported(version) {
+		return nil, fmt.Errorf("unsupported publiccodeYmlVersion %s, supported: %s",
+			version, strings.Join(publiccode.SupportedVersions, ", "))
+	}
+
+	g := generator{definitions: map[string]*Schema{}}
+	root := g.object("", reflect.TypeOf(publiccode.PublicCode{}))
+	root.Schema = Draft
+	root.Title = "publiccode.yml " + version
+	root.Description = "Metadata of public software, see https://github.com/publiccodenet/publiccode.yml"
+	root.Definitions = g.definitions
+	root.Properties["publiccodeYmlVersion"].Const = version
+
+	// older versions don't require categories
+	if version == "0.1" {
+		root.Required = without(root.Required, "categories")
+	}
+	g.deprecated(root)
+	return root, nil
+}
+
+func supported(version string) bool {
+	for _, v := range publiccode.SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// generator builds schemas of parser types, named
+// structs are added once to definitions
+type generator struct {
+	definitions map[string]*Schema
+}
+
+// object returns the schema of struct t. Rules and required properties
+// are looked up by key, the path of t from the root or from a named type
+func (g *generator) object(key string, t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		s.Properties[name] = g.value(join(key, name), t.Field(i).Type)
+	}
+	s.Required = required[key]
+	apply(key, s)
+	return s
+}
+
+// value returns the schema of values of type t at key.
+// Items of lists and values of maps are under key/*
+func (g *generator) value(key string, t reflect.Type) *Schema {
+	if t.Kind() == reflect.Struct {
+		if t.Name() == "" {
+			return g.object(key, t)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			g.definitions[t.Name()] = g.object(t.Name(), t)
+		}
+		return &Schema{Ref: "#/definitions/" + t.Name()}
+	}
+
+	var s *Schema
+	switch t.Kind() {
+	case reflect.String:
+		s = &Schema{Type: "string"}
+	case reflect.Bool:
+		s = &Schema{Type: "boolean"}
+	case reflect.Slice:
+		s = &Schema{Type: "array", Items: g.value(key+"/*", t.Elem())}
+	case reflect.Map:
+		s = &Schema{Type: "object", AdditionalProperties: g.value(key+"/*", t.Elem())}
+	default:
+		s = &Schema{}
+	}
+	apply(key, s)
+	return s
+}
+
+// deprecated adds the keys of older versions, accepted
+// with a warning, to the properties of root
+func (g *generator) deprecated(root *Schema) {
+	for _, key := range utils.DeprecatedKeys() {
+		segments := strings.Split(key, "/")
+		parent := root
+		for _, segment := range segments[:len(segments)-1] {
+			parent = g.child(parent, segment)
+		}
+
+		s := &Schema{Description: "Deprecated, removed from the specification."}
+		if newKey, _ := utils.RenamedKey(key); newKey != "" {
+			newSegments := strings.Split(newKey, "/")
+			newParent := root
+			for _, segment := range newSegments[:len(newSegments)-1] {
+				newParent = g.child(newParent, segment)
+			}
+			*s = *newParent.Properties[newSegments[len(newSegments)-1]]
+			s.Description = "Deprecated, renamed to " + newKey + "."
+		}
+		s.Deprecated = true
+		parent.Properties[segments[len(segments)-1]] = s
+	}
+
+	// publiccode-yaml-version is accepted in place of publiccodeYmlVersion
+	root.Required = without(root.Required, "publiccodeYmlVersion")
+	root.AnyOf = []*Schema{
+		{Required: []string{"publiccodeYmlVersion"}},
+		{Required: []string{"publiccode-yaml-version"}},
+	}
+}
+
+// child returns the schema of name in s, * for the values of
+// maps. Missing objects are added as deprecated ones
+func (g *generator) child(s *Schema, name string) *Schema {
+	s = g.resolve(s)
+	if name == "*" {
+		return g.resolve(s.AdditionalProperties.(*Schema))
+	}
+	if _, ok := s.Properties[name]; !ok {
+		s.Properties[name] = &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false, Deprecated: true}
+	}
+	return g.resolve(s.Properties[name])
+}
+
+// resolve returns the definition referenced by s, s itself if none
+func (g *generator) resolve(s *Schema) *Schema {
+	if s.Ref == "" {
+		return s
+	}
+	return g.definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+}
+
+func join(key string, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "/" + name
+}
+
+// without returns a copy of list without s
+func without(list []string, s string) []string {
+	var res []string
+	for _, item := range list {
+		if item != s {
+			res = append(res, item)
+		}
+	}
+	return res
+}
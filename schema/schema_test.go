@@ -0,0 +1,96 @@
+package schema_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/apiv1"
+	"github.com/italia/publiccode-validator/schema"
+	"github.com/italia/publiccode-validator/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// TestConsistency checks that the documents in tests/ are valid
+// for the schema of their version if and only if the parser,
+// without network checks, finds them valid
+func TestConsistency(t *testing.T) {
+	schemas := map[string]*gojsonschema.Schema{}
+	for _, version := range publiccode.SupportedVersions {
+		s, err := schema.Generate(version)
+		if !assert.NoError(t, err, version) {
+			return
+		}
+		b, _ := json.Marshal(s)
+		if schemas[version], err = gojsonschema.NewSchema(gojsonschema.NewBytesLoader(b)); !assert.NoError(t, err, version) {
+			return
+		}
+	}
+
+	files, _ := filepath.Glob("../tests/*")
+	var checked int
+	for _, file := range files {
+		doc, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var document map[string]interface{}
+		if yaml.Unmarshal(doc, &document) != nil {
+			continue
+		}
+		// responses of the API are in tests/ too
+		version, ok := document["publiccodeYmlVersion"].(string)
+		if !ok {
+			if version, ok = document["publiccode-yaml-version"].(string); !ok {
+				continue
+			}
+		}
+		checked++
+
+		jsonDoc, err := yaml.YAMLToJSON(doc)
+		if !assert.NoError(t, err, file) {
+			continue
+		}
+		result, err := schemas[version].Validate(gojsonschema.NewBytesLoader(jsonDoc))
+		if !assert.NoError(t, err, file) {
+			continue
+		}
+		// keys of older versions are valid in their schema
+		_, _, errParse, _ := apiv1.Parse(context.Background(), doc, utils.Options{DisableNetwork: true, Lenient: true, LocalBasePath: ".."})
+		assert.Equal(t, errParse == nil, result.Valid(), "%s: parser: %v, schema: %v", file, errParse, result.Errors())
+	}
+	assert.NotZero(t, checked)
+}
+
+func TestGenerate(t *testing.T) {
+	s, err := schema.Generate("0.2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, schema.Draft, s.Schema)
+	assert.Equal(t, "0.2", s.Properties["publiccodeYmlVersion"].Const)
+	assert.Contains(t, s.Required, "categories")
+	assert.Equal(t, "#/definitions/ExtensionIT", s.Properties["it"].Ref)
+	assert.Equal(t, "#/definitions/Desc", s.Properties["description"].AdditionalProperties.(*schema.Schema).Ref)
+
+	it := s.Definitions["ExtensionIT"]
+	assert.Equal(t, []string{"0.2"}, it.Properties["countryExtensionVersion"].Enum)
+	assert.Equal(t, "boolean", it.Properties["piattaforme"].Properties["spid"].Type)
+	assert.True(t, it.Properties["spid"].Deprecated)
+	assert.Equal(t, "boolean", it.Properties["spid"].Type)
+	assert.True(t, it.Properties["designKit"].Properties["ui"].Deprecated)
+	assert.True(t, s.Definitions["Desc"].Properties["featureList"].Deprecated)
+
+	s, err = schema.Generate("0.1")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, s.Required, "categories")
+	}
+
+	_, err = schema.Generate("1.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// newServer returns the HTTP server of handler, with the timeouts
+// of cfg so that slow clients can't hold connections forever.
+// Streaming handlers replace the write deadline, see
+// utils.SetWriteDeadline
+func newServer(cfg config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         cfg.ListenAddress,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		ConnContext:  utils.WithConn,
+	}
+}
+
+// setupTLS makes server serve HTTPS with the certificate
+// and key files of cfg, if set
+func setupTLS(server *http.Server, cfg config.Config) error {
+	if cfg.TLSCert == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	return nil
+}
+
+// serve serves l, with TLS when the server has a TLSConfig, until
+// a signal is received on stop, then stops accepting connections and
+// waits up to timeout for in-flight requests. It returns nil once
+// they are drained
+func serve(server *http.Server, l net.Listener, stop <-chan os.Signal, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			errs <- server.ServeTLS(l, "", "")
+			return
+		}
+		errs <- server.Serve(l)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		log.Infof("%v received, waiting up to %v for in-flight requests", sig, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return err
+	}
+	if err := <-errs; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/italia/publiccode-validator/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyTooLarge(t *testing.T) {
+	body := strings.Repeat("a", int(app.Config.MaxBodySize)+1)
+	for _, path := range []string{
+		"/pc/validate",
+		"/api/v1/validate",
+		"/api/v1/validate/batch",
+		"/api/v1/validateURL/batch",
+	} {
+		req, _ := http.NewRequest("POST", path+"?disableNetwork=true", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, response.Code)
+
+		var message utils.Message
+		if assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &message), path) {
+			assert.Equal(t, utils.Message{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: "Request body too large",
+				Error:   "http: request body too large",
+			}, message, path)
+		}
+	}
+
+	// at the limit
+	req, _ := http.NewRequest("POST", "/api/v1/validate?disableNetwork=true", strings.NewReader(body[1:]))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	server := newServer(config.Default(), handler)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(server, l, stop, 5*time.Second)
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		responses <- string(b)
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+	// in-flight requests are completed
+	assert.Equal(t, "done", <-responses)
+	assert.NoError(t, <-served)
+
+	// new ones are refused
+	_, err = http.Get("http://" + l.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestTLS(t *testing.T) {
+	// the certificate of httptest, trusted by its client
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	cert := ts.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := config.Default()
+	cfg.TLSCert = filepath.Join(dir, "cert.pem")
+	cfg.TLSKey = filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(cfg.TLSCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	ioutil.WriteFile(cfg.TLSKey, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600)
+
+	server := newServer(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	assert.NoError(t, setupTLS(server, cfg))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(server, l, stop, 5*time.Second)
+	}()
+
+	resp, err := ts.Client().Get("https://" + l.Addr().String())
+	if assert.NoError(t, err) {
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "secure", string(b))
+	}
+	stop <- syscall.SIGTERM
+	assert.NoError(t, <-served)
+
+	cfg.TLSKey = cfg.TLSCert
+	assert.Error(t, setupTLS(newServer(cfg, nil), cfg))
+}
+
+func TestBatchStream(t *testing.T) {
+	var requests int32
+	upstream := newGitLabServer(func() {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+	})
+	defer upstream.Close()
+	var urls []string
+	for i := 0; i < 8; i++ {
+		urls = append(urls, fmt.Sprintf("%s/italia/repo/-/raw/master/tests/valid.minimal.yml?stream=%d", upstream.URL, i))
+	}
+
+	saved := utils.Settings()
+	defer utils.Configure(saved)
+	cfg := saved
+	cfg.WriteTimeout = 150 * time.Millisecond
+	cfg.BatchWorkers = 1
+	utils.Configure(cfg)
+
+	server := newServer(cfg, app.Router)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	defer server.Close()
+	batch := func() *http.Response {
+		resp, err := http.Post("http://"+l.Addr().String()+"/api/v1/validateURL/batch?disableNetwork=true", "text/plain", strings.NewReader(strings.Join(urls, "\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// the write timeout applies to every result, not to the stream
+	resp := batch()
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, len(urls), strings.Count(string(b), "\n"))
+
+	// workers stop when the client goes away
+	for i := range urls {
+		urls[i] += "&gone=true"
+	}
+	atomic.StoreInt32(&requests, 0)
+	resp = batch()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Contains(t, line, `"index":0`)
+	resp.Body.Close()
+	time.Sleep(500 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&requests) < int32(len(urls)), "%d requests", atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// connKey is the context key of the connection of a request
+type connKey struct{}
+
+// WithConn returns ctx carrying c, the connection its requests are
+// read from. It's the ConnContext of the server
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// SetWriteDeadline replaces the write deadline the server sets on
+// the connection of r, for responses written over a longer time.
+// The zero time means no deadline. It returns false if the connection
+// is unknown
+func SetWriteDeadline(r *http.Request, t time.Time) bool {
+	c, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return false
+	}
+	return c.SetWriteDeadline(t) == nil
+}
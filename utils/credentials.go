@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/config"
+)
+
+// AuthorizationHeader carries the credential of the repository
+// validated by a request, see CredentialFromHeader
+const AuthorizationHeader = "Repository-Authorization"
+
+// hostAliases are hosts serving the same repositories, a credential
+// of one of them is sent to the others
+var hostAliases = [][]string{
+	{"github.com", "raw.githubusercontent.com", "api.github.com"},
+	{"bitbucket.org", "api.bitbucket.org"},
+}
+
+// aliases returns host and the hosts serving its repositories
+func aliases(host string) []string {
+	host = strings.ToLower(host)
+	for _, hosts := range hostAliases {
+		for _, h := range hosts {
+			if h == host {
+				return hosts
+			}
+		}
+	}
+	return []string{host}
+}
+
+// sameHost tells whether a and b serve the same repositories
+func sameHost(a string, b string) bool {
+	for _, h := range aliases(a) {
+		if strings.EqualFold(h, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// CredentialFromHeader returns the credential in value, the
+// Repository-Authorization header: Basic with username and token
+// or Bearer (or token) with the token alone. The credential is not
+// bound to any host, see Options.BindCredential
+func CredentialFromHeader(value string) (*config.Credential, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), " ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil, errors.New("credential must be Basic, Bearer or token")
+	}
+	token := strings.TrimSpace(parts[1])
+	switch strings.ToLower(parts[0]) {
+	case "bearer", "token":
+		return &config.Credential{Token: token}, nil
+	case "basic":
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, errors.New("invalid Basic credential")
+		}
+		userToken := strings.SplitN(string(b), ":", 2)
+		if len(userToken) != 2 || userToken[0] == "" || userToken[1] == "" {
+			return nil, errors.New("invalid Basic credential")
+		}
+		return &config.Credential{Username: userToken[0], Token: userToken[1]}, nil
+	}
+	return nil, errors.New("credential must be Basic, Bearer or token")
+}
+
+// BindCredential restricts the credential of the request, if any, to
+// the host of urlString, the repository validated. Credentials bound
+// to a host are left as they are. The ones of the server are never
+// used: urlString may come from a submitted document, see
+// BindRemoteCredential
+func (o *Options) BindCredential(urlString string) {
+	if o.Credential == nil || o.Credential.Host != "" {
+		return
+	}
+	u, err := url.Parse(urlString)
+	if err != nil || u.Host == "" {
+		o.Credential = nil
+		return
+	}
+	c := *o.Credential
+	c.Host = u.Host
+	o.Credential = &c
+}
+
+// BindRemoteCredential is BindCredential for urlString, the repository
+// the client asks to fetch. Without a credential of the request the
+// one of the server is used, if it lists the repository
+func (o *Options) BindRemoteCredential(urlString string) {
+	if o.Credential == nil {
+		o.Credential = serverCredential(urlString)
+		o.ServerCredential = o.Credential != nil
+		return
+	}
+	o.BindCredential(urlString)
+}
+
+// serverCredential returns the credential of the configuration listing
+// the repository of urlString, nil if none
+func serverCredential(urlString string) *config.Credential {
+	if len(settings.Credentials) == 0 {
+		return nil
+	}
+	u, err := url.Parse(urlString)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	_, repo, _, err := lookupForge(u)
+	if err != nil {
+		return nil
+	}
+	for i, cred := range settings.Credentials {
+		if sameHost(cred.Host, repo.Host) && cred.Covers(repoPath(repo)) {
+			return &settings.Credentials[i]
+		}
+	}
+	return nil
+}
+
+// hostWide tells whether c can be sent to any repository of its host:
+// credentials of requests and the ones of the server listing *
+func hostWide(c *config.Credential) bool {
+	return len(c.Repositories) == 0 || c.Covers("*")
+}
+
+// credentialFor returns c if bound to host, nil otherwise
+func credentialFor(host string, c *config.Credential) *config.Credential {
+	if c != nil && c.Host != "" && sameHost(c.Host, host) {
+		return c
+	}
+	return nil
+}
+
+// authorize sets the Authorization header of req
+// to the credential of its host, if any
+func authorize(req *http.Request, c *config.Credential) {
+	if cred := credentialFor(req.URL.Host, c); cred != nil {
+		req.Header.Set("Authorization", cred.Authorization())
+	}
+}
+
+// parserDomain returns the settings making the parser send the credential
+// of the host of rawRoot with its requests, to check relative paths of
+// private repositories. The parser only sends HTTP Basic credentials,
+// to every URL of the host, so never the ones of the server restricted
+// to some repositories
+func parserDomain(rawRoot string, c *config.Credential) publiccode.Domain {
+	u, err := url.Parse(rawRoot)
+	if err != nil || u.Host == "" {
+		return publiccode.Domain{}
+	}
+	cred := credentialFor(u.Host, c)
+	if cred == nil || cred.Username == "" || !hostWide(cred) {
+		return publiccode.Domain{}
+	}
+	return publiccode.Domain{
+		Host:        u.Host,
+		UseTokenFor: append([]string{u.Host}, aliases(cred.Host)...),
+		BasicAuth:   []string{cred.Username + ":" + cred.Token},
+	}
+}
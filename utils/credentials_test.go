@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialFromHeader(t *testing.T) {
+	c, err := CredentialFromHeader("Bearer glpat-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Credential{Token: "glpat-secret"}, c)
+
+	c, err = CredentialFromHeader("token ghp_secret")
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Credential{Token: "ghp_secret"}, c)
+
+	c, err = CredentialFromHeader("Basic Ym90OnNlY3JldA==")
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Credential{Username: "bot", Token: "secret"}, c)
+
+	for _, value := range []string{"", "secret", "Bearer ", "Digest x", "Basic !!", "Basic Ym90"} {
+		_, err = CredentialFromHeader(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestBindCredential(t *testing.T) {
+	opts := Options{Credential: &config.Credential{Token: "secret"}}
+	opts.BindCredential("https://github.com/italia/repo")
+	assert.Equal(t, "github.com", opts.Credential.Host)
+
+	// bound credentials don't move to other hosts
+	opts.BindCredential("https://gitlab.com/italia/repo")
+	assert.Equal(t, "github.com", opts.Credential.Host)
+
+	assert.Equal(t, opts.Credential, credentialFor("raw.githubusercontent.com", opts.Credential))
+	assert.Nil(t, credentialFor("gitlab.com", opts.Credential))
+
+	opts = Options{Credential: &config.Credential{Token: "secret"}}
+	opts.BindCredential("not an URL")
+	assert.Nil(t, opts.Credential)
+}
+
+func TestCredentials(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.RequestURI() {
+		case "/api/v1/repos/pa/private":
+			w.Write([]byte(`{"default_branch": "main"}`))
+		case "/api/v1/repos/pa/private/commits?sha=main&limit=1&stat=false":
+			w.Write([]byte(`[{"sha": "1111111111111111111111111111111111111111"}]`))
+		case "/pa/private/raw/main/publiccode.yml":
+			w.Write([]byte("name: Medusa\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer withForge(server, config.ForgeGitea, "")()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// no credential
+	_, _, err := ResolveRemoteFile(context.Background(), server.URL+"/pa/private", "main", nil)
+	assert.Error(t, err)
+
+	// credential of the request
+	authorizations = nil
+	credential := &config.Credential{Host: host, Token: "secret"}
+	rawURL, checkout, err := ResolveRemoteFile(context.Background(), server.URL+"/pa/private", "", credential)
+	assert.NoError(t, err)
+	assert.Equal(t, "1111111111111111111111111111111111111111", checkout.Commit)
+	file, err := FetchConditional(context.Background(), rawURL, "", "", credential)
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Medusa\n", string(file.Body))
+	assert.Equal(t, []string{"Bearer secret", "Bearer secret", "Bearer secret"}, authorizations)
+
+	// credential of the request bound to another host
+	authorizations = nil
+	_, err = FetchConditional(context.Background(), rawURL, "", "", &config.Credential{Host: "github.com", Token: "secret"})
+	assert.Error(t, err)
+	assert.Equal(t, []string{""}, authorizations)
+
+	// credential of the configuration, only for the repositories listed
+	saved := Settings()
+	cfg := saved
+	cfg.Credentials = []config.Credential{{Host: host, Repositories: []string{"pa/public"}, Username: "bot", Token: "secret"}}
+	Configure(cfg)
+	opts := Options{}
+	opts.BindRemoteCredential(server.URL + "/pa/private")
+	assert.Nil(t, opts.Credential)
+	assert.False(t, opts.ServerCredential)
+
+	cfg.Credentials = []config.Credential{{Host: host, Repositories: []string{"pa/*"}, Username: "bot", Token: "secret"}}
+	Configure(cfg)
+	opts.BindRemoteCredential(server.URL + "/pa/private")
+	assert.True(t, opts.ServerCredential)
+	// not for repositories of submitted documents
+	body := Options{}
+	body.BindCredential(server.URL + "/pa/private")
+	assert.Nil(t, body.Credential)
+	assert.False(t, body.ServerCredential)
+	authorizations = nil
+	_, err = FetchConditional(context.Background(), rawURL, "", "", opts.Credential)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Basic Ym90OnNlY3JldA=="}, authorizations)
+
+	// credentials of requests take precedence
+	opts = Options{Credential: &config.Credential{Token: "other"}}
+	opts.BindRemoteCredential(server.URL + "/pa/private")
+	assert.False(t, opts.ServerCredential)
+	assert.Equal(t, "other", opts.Credential.Token)
+
+	// the parser sends Basic credentials for relative paths to the whole
+	// host, only the ones of the server for all of its repositories
+	u, _ := url.Parse(server.URL + "/pa/private")
+	opts = Options{RemoteBaseURL: server.URL + "/pa/private/raw/main/"}
+	opts.BindRemoteCredential(u.String())
+	assert.Empty(t, opts.NewParser(u).Domain.BasicAuth)
+
+	cfg.Credentials[0].Repositories = []string{"*"}
+	Configure(cfg)
+	opts = Options{RemoteBaseURL: server.URL + "/pa/private/raw/main/"}
+	opts.BindRemoteCredential(u.String())
+	p := opts.NewParser(u)
+	assert.Equal(t, []string{"bot:secret"}, p.Domain.BasicAuth)
+	assert.Contains(t, p.Domain.UseTokenFor, host)
+	opts.DisableNetwork = true
+	assert.Empty(t, opts.NewParser(u).Domain.BasicAuth)
+	Configure(saved)
+}
@@ -2,9 +2,69 @@ package utils
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+
+	"github.com/italia/publiccode-parser-go"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// Severity of a validation error
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
 )
 
+// Stable validation error codes, clients can rely on them
+// while Reason is meant for humans and may change
+const (
+	CodeInvalidKey           = "invalid-key"
+	CodeUnknownKey           = "unknown-key"
+	CodeMissingKey           = "missing-key"
+	CodeUnsupportedVersion   = "unsupported-version"
+	CodeInvalidType          = "invalid-type"
+	CodeInvalidValue         = "invalid-value"
+	CodeInvalidURL           = "invalid-url"
+	CodeUnreachableURL       = "unreachable-url"
+	CodeURLOutsideRepository = "url-outside-repository"
+	CodeFileNotFound         = "file-not-found"
+	CodeInvalidFileExtension = "invalid-file-extension"
+	CodeInvalidImageSize     = "invalid-image-size"
+	CodeInvalidMonochrome    = "invalid-monochrome-logo"
+	CodeTooLong              = "too-long"
+	CodeTooShort             = "too-short"
+	CodeInvalidDate          = "invalid-date"
+	CodeInvalidEmail         = "invalid-email"
+	CodeInvalidMIME          = "invalid-mime"
+	CodeInvalidLicense       = "invalid-license"
+	CodeInvalidCategory      = "invalid-category"
+	CodeInvalidScope         = "invalid-scope"
+	CodeInvalidLanguageCode  = "invalid-language-code"
+	CodeInvalidCountryCode   = "invalid-country-code"
+	CodeInvalidCodiceIPA     = "invalid-codice-ipa"
+	CodeInvalidOEmbed        = "invalid-oembed"
+
+	// warnings
+	CodeDeprecatedKey         = "deprecated-key"
+	CodeMissingRecommendedKey = "missing-recommended-key"
+	CodeInsecureURL           = "insecure-url"
+)
+
+// Codes are all the validation error codes
+var Codes = []string{
+	CodeInvalidKey, CodeUnknownKey, CodeMissingKey, CodeUnsupportedVersion,
+	CodeInvalidType, CodeInvalidValue, CodeInvalidURL, CodeUnreachableURL,
+	CodeURLOutsideRepository, CodeFileNotFound, CodeInvalidFileExtension,
+	CodeInvalidImageSize, CodeInvalidMonochrome, CodeTooLong, CodeTooShort,
+	CodeInvalidDate, CodeInvalidEmail, CodeInvalidMIME, CodeInvalidLicense,
+	CodeInvalidCategory, CodeInvalidScope, CodeInvalidLanguageCode,
+	CodeInvalidCountryCode, CodeInvalidCodiceIPA, CodeInvalidOEmbed,
+	CodeDeprecatedKey, CodeMissingRecommendedKey, CodeInsecureURL,
+}
+
+// SpecBaseURL is the base URL of the publiccode.yml specification
+const SpecBaseURL = "https://yml.publiccode.tools/"
+
 // ErrorInvalidKey represents an error caused by an invalid key.
 type ErrorInvalidKey struct {
 	Key string `json:"Key"`
@@ -14,10 +74,39 @@ func (e ErrorInvalidKey) Error() string {
 	return fmt.Sprintf("invalid key: %s", e.Key)
 }
 
+// ValidationError returns e in the validation errors schema
+func (e ErrorInvalidKey) ValidationError() ErrorInvalidValue {
+	return ErrorInvalidValue{
+		Key:      e.Key,
+		Reason:   "invalid key",
+		Code:     CodeInvalidKey,
+		Severity: SeverityError,
+		Path:     jsonPointer(e.Key),
+		SpecURL:  specURL(e.Key, CodeInvalidKey),
+	}
+}
+
 // ErrorInvalidValue represents an error caused by an invalid value.
+// Key and Reason are kept for compatibility, Code, Severity and
+// Path are always set for errors coming from the parser.
 type ErrorInvalidValue struct {
 	Key    string `json:"Key"`
 	Reason string `json:"Reason"`
+	// Detail is the English reason of the parser, with details like
+	// URLs and limits, when Reason is translated
+	Detail string `json:"detail,omitempty"`
+	// Code is a stable identifier of the kind of error
+	Code string `json:"code,omitempty"`
+	// Severity is error or warning
+	Severity string `json:"severity,omitempty"`
+	// Path is the JSON pointer of the key
+	Path string `json:"path,omitempty"`
+	// Value is the offending value, if found in the document
+	Value interface{} `json:"value,omitempty"`
+	// SpecURL links the section of the specification about the key
+	SpecURL string `json:"specURL,omitempty"`
+	// Position of the error in the submitted document
+	Position
 }
 
 func (e ErrorInvalidValue) Error() string {
@@ -38,3 +127,201 @@ func (es ErrorParseMulti) Error() string {
 	}
 	return strings.Join(ss, "\n")
 }
+
+// ValidationErrors is a list of structured validation errors
+type ValidationErrors []ErrorInvalidValue
+
+func (es ValidationErrors) Error() string {
+	var ss []string
+	for _, e := range es {
+		ss = append(ss, e.Error())
+	}
+	return strings.Join(ss, "\n")
+}
+
+// Locate sets the position of every error in doc, e.g. when the
+// document validated is a conversion of the submitted one
+func (es ValidationErrors) Locate(doc []byte) {
+	l := newLocator(doc)
+	for i := range es {
+		es[i].Position = Position{}
+		if l != nil && es[i].Key != "" {
+			es[i].Position = l.locate(es[i].Key, es[i].Code)
+		}
+	}
+}
+
+// errorCodes maps parser reasons to error codes, first match wins.
+// key is optional and restricts the rule to matching keys
+var errorCodes = []struct {
+	key    *regexp.Regexp
+	reason *regexp.Regexp
+	code   string
+}{
+	{nil, regexp.MustCompile(`^Unexpected \w+ key$`), CodeUnknownKey},
+	{nil, regexp.MustCompile(`^missing (mandatory|but mandatory)|^at least one language is required`), CodeMissingKey},
+	{nil, regexp.MustCompile(`^version .* not supported`), CodeUnsupportedVersion},
+	{nil, regexp.MustCompile(`^HTTP GET (failed|returned)`), CodeUnreachableURL},
+	{nil, regexp.MustCompile(`^Absolute URL .* is outside the repository`), CodeURLOutsideRepository},
+	{nil, regexp.MustCompile(`^(invalid repository URL|not a valid URL|missing URL scheme|failed to detect repo)`), CodeInvalidURL},
+	{nil, regexp.MustCompile(`^local file does not exist`), CodeFileNotFound},
+	{nil, regexp.MustCompile(`^invalid file extension`), CodeInvalidFileExtension},
+	{nil, regexp.MustCompile(`^invalid image size`), CodeInvalidImageSize},
+	{nil, regexp.MustCompile(`is not monochrome`), CodeInvalidMonochrome},
+	{nil, regexp.MustCompile(`^too long`), CodeTooLong},
+	{nil, regexp.MustCompile(`^too short`), CodeTooShort},
+	{nil, regexp.MustCompile(`^cannot parse date`), CodeInvalidDate},
+	{nil, regexp.MustCompile(`^invalid email`), CodeInvalidEmail},
+	{nil, regexp.MustCompile(`is not a valid MIME`), CodeInvalidMIME},
+	{nil, regexp.MustCompile(`^unknown category`), CodeInvalidCategory},
+	{nil, regexp.MustCompile(`^unknown scope`), CodeInvalidScope},
+	{nil, regexp.MustCompile(`language code`), CodeInvalidLanguageCode},
+	{nil, regexp.MustCompile(`country code`), CodeInvalidCountryCode},
+	{nil, regexp.MustCompile(`(?i)codice ?IPA`), CodeInvalidCodiceIPA},
+	{nil, regexp.MustCompile(`^invalid oembed`), CodeInvalidOEmbed},
+	{nil, regexp.MustCompile(`^(array element \d+ not a string|invalid type)`), CodeInvalidType},
+	{regexp.MustCompile(`^legal/license$`), regexp.MustCompile(`^invalid value`), CodeInvalidLicense},
+}
+
+// errorCode returns the stable code of a parser error
+func errorCode(key string, reason string) string {
+	for _, c := range errorCodes {
+		if c.key != nil && !c.key.MatchString(key) {
+			continue
+		}
+		if c.reason.MatchString(reason) {
+			return c.code
+		}
+	}
+	return CodeInvalidValue
+}
+
+// NewValidationErrors converts errors returned by the parser into
+// ValidationErrors. doc is the validated document, used to report
+// offending values and positions, it can be nil.
+// Errors not coming from validation (e.g. YAML syntax errors) are
+// returned unchanged.
+func NewValidationErrors(err error, doc []byte) error {
+	var errs []error
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case ValidationErrors:
+		return e
+	case publiccode.ErrorParseMulti:
+		errs = e
+	case publiccode.ErrorInvalidValue, publiccode.ErrorInvalidKey:
+		errs = []error{e}
+	default:
+		return err
+	}
+
+	var document interface{}
+	if doc != nil {
+		yamlv2.Unmarshal(doc, &document)
+	}
+
+	out := make(ValidationErrors, 0, len(errs))
+	for _, e := range errs {
+		switch e := e.(type) {
+		case publiccode.ErrorInvalidKey:
+			out = append(out, ErrorInvalidKey{Key: e.Key}.ValidationError())
+		case publiccode.ErrorInvalidValue:
+			code := errorCode(e.Key, e.Reason)
+			v := ErrorInvalidValue{
+				Key:      e.Key,
+				Reason:   e.Reason,
+				Code:     code,
+				Severity: SeverityError,
+				Path:     jsonPointer(e.Key),
+				SpecURL:  specURL(e.Key, code),
+			}
+			if code != CodeMissingKey {
+				v.Value = lookup(document, e.Key)
+			}
+			out = append(out, v)
+		default:
+			out = append(out, ErrorInvalidValue{
+				Reason:   e.Error(),
+				Code:     CodeInvalidValue,
+				Severity: SeverityError,
+			})
+		}
+	}
+	out.Locate(doc)
+	return out
+}
+
+// jsonPointer returns the RFC 6901 pointer of a parser key,
+// wildcards (e.g. description/*/features) point to their parent
+func jsonPointer(key string) string {
+	var pointer string
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "*" || segment == "" {
+			break
+		}
+		segment = strings.Replace(segment, "~", "~0", -1)
+		segment = strings.Replace(segment, "/", "~1", -1)
+		pointer += "/" + segment
+	}
+	return pointer
+}
+
+// KeySpecURL returns the link to the section of the specification
+// about key, e.g. legal/license or description/*/features
+func KeySpecURL(key string) string {
+	return specURL(key, "")
+}
+
+// specURL returns the link to the section of the specification about key
+func specURL(key string, code string) string {
+	segments := strings.Split(key, "/")
+	page := "schema.core.html"
+	if segments[0] == "it" {
+		page = "country.italy.html"
+	}
+	// unknown and deprecated keys have no section
+	if code == CodeUnknownKey || code == CodeInvalidKey || code == CodeDeprecatedKey {
+		return SpecBaseURL + page
+	}
+	if segments[0] == "description" && len(segments) > 1 {
+		segments[1] = "lang"
+	}
+	return SpecBaseURL + page + "#key-" + strings.ToLower(strings.Join(segments, "-"))
+}
+
+// lookup returns the value of key in a YAML decoded document,
+// converted to JSON compatible types. nil if not found
+func lookup(document interface{}, key string) interface{} {
+	v := document
+	for _, segment := range strings.Split(key, "/") {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		if v, ok = m[segment]; !ok {
+			return nil
+		}
+	}
+	return jsonCompatible(v)
+}
+
+// jsonCompatible converts YAML maps with interface{} keys
+// into maps with string keys, recursively
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprintf("%v", k)] = jsonCompatible(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[i] = jsonCompatible(item)
+		}
+		return l
+	}
+	return v
+}
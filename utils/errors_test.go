@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/italia/publiccode-parser-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewValidationErrors(t *testing.T) {
+	doc := []byte("legal:\n  license: Foo\nreleaseDate: 2020/01/01\nit:\n  spid: true\n")
+	err := NewValidationErrors(publiccode.ErrorParseMulti{
+		publiccode.ErrorInvalidValue{Key: "legal/license", Reason: "invalid value Foo: unknown license"},
+		publiccode.ErrorInvalidValue{Key: "releaseDate", Reason: "cannot parse date: bad"},
+		publiccode.ErrorInvalidValue{Key: "it/spid", Reason: "Unexpected boolean key"},
+		publiccode.ErrorInvalidValue{Key: "description/*/features", Reason: "missing mandatory key"},
+		publiccode.ErrorInvalidKey{Key: "1"},
+	}, doc)
+
+	es, ok := err.(ValidationErrors)
+	if !assert.True(t, ok) || !assert.Len(t, es, 5) {
+		return
+	}
+
+	assert.Equal(t, ErrorInvalidValue{
+		Key:      "legal/license",
+		Reason:   "invalid value Foo: unknown license",
+		Code:     CodeInvalidLicense,
+		Severity: SeverityError,
+		Path:     "/legal/license",
+		Value:    "Foo",
+		SpecURL:  SpecBaseURL + "schema.core.html#key-legal-license",
+		Position: Position{Line: 2, Column: 12, EndLine: 2, EndColumn: 15},
+	}, es[0])
+	assert.Equal(t, CodeInvalidDate, es[1].Code)
+	assert.Equal(t, "2020/01/01", es[1].Value)
+	assert.Equal(t, CodeUnknownKey, es[2].Code)
+	assert.Equal(t, true, es[2].Value)
+	assert.Equal(t, SpecBaseURL+"country.italy.html", es[2].SpecURL)
+	assert.Equal(t, CodeMissingKey, es[3].Code)
+	assert.Equal(t, "/description", es[3].Path)
+	assert.Equal(t, SpecBaseURL+"schema.core.html#key-description-lang-features", es[3].SpecURL)
+	assert.Nil(t, es[3].Value)
+	assert.Equal(t, CodeInvalidKey, es[4].Code)
+
+	// errors not coming from validation are left untouched
+	assert.Nil(t, NewValidationErrors(nil, doc))
+	syntax := publiccode.ParseError{Reason: "Invalid UTF-8"}
+	assert.Equal(t, syntax, NewValidationErrors(syntax, doc))
+	assert.Nil(t, ErrorsToValidationErrors(syntax))
+}
+
+func TestLocate(t *testing.T) {
+	errs := ValidationErrors{
+		{Key: "legal/license", Code: CodeInvalidLicense},
+		{Key: "it/spid", Code: CodeUnknownKey},
+		{Key: "maintenance/contacts", Code: CodeMissingKey},
+		{Key: "description/en/longDescription", Code: CodeTooShort},
+		{Key: "name", Code: CodeMissingKey},
+	}
+
+	yml := []byte("legal:\n  license: 'Foo'  # comment\nmaintenance:\n  type: community\n" +
+		"description:\n  en:\n    longDescription: |\n      short\n      text\n\nit:\n  spid: yes\n")
+	errs.Locate(yml)
+	assert.Equal(t, Position{Line: 2, Column: 12, EndLine: 2, EndColumn: 17}, errs[0].Position)
+	assert.Equal(t, Position{Line: 12, Column: 3, EndLine: 12, EndColumn: 7}, errs[1].Position)
+	assert.Equal(t, Position{Line: 3, Column: 1, EndLine: 3, EndColumn: 12}, errs[2].Position)
+	assert.Equal(t, Position{Line: 7, Column: 22, EndLine: 9, EndColumn: 11}, errs[3].Position)
+	assert.Equal(t, Position{Line: 1, Column: 1, EndLine: 1, EndColumn: 7}, errs[4].Position)
+
+	json := []byte(`{"legal": {"license": "Foo"},` + "\n" + ` "it": {"spid": true}}`)
+	errs.Locate(json)
+	assert.Equal(t, Position{Line: 1, Column: 23, EndLine: 1, EndColumn: 28}, errs[0].Position)
+	assert.Equal(t, Position{Line: 2, Column: 9, EndLine: 2, EndColumn: 15}, errs[1].Position)
+
+	// keys of the parser have no index: with more contacts
+	// the whole list, the only one otherwise
+	contacts := []byte("maintenance:\n  contacts:\n    - name: Francesco Rossi\n" +
+		"    - name: Mario Bianchi\n      email: not-an-email\n")
+	errs = ValidationErrors{
+		{Key: "maintenance/contacts/name", Code: CodeInvalidValue},
+		{Key: "maintenance/contacts/email", Code: CodeInvalidEmail},
+	}
+	errs.Locate(contacts)
+	assert.Equal(t, Position{Line: 3, Column: 5, EndLine: 5, EndColumn: 26}, errs[0].Position)
+	assert.Equal(t, Position{Line: 5, Column: 14, EndLine: 5, EndColumn: 26}, errs[1].Position)
+
+	// positions are reset when the document can't be read
+	errs.Locate([]byte("{"))
+	assert.Equal(t, Position{}, errs[0].Position)
+}
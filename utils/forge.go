@@ -0,0 +1,420 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	vcsurl "github.com/alranel/go-vcsurl"
+	"github.com/italia/publiccode-validator/config"
+)
+
+// APIs of the hosting platforms, variables to be replaced in tests
+var (
+	githubAPI    = "https://api.github.com"
+	bitbucketAPI = "https://api.bitbucket.org/2.0"
+)
+
+// Default templates of raw file URLs of self-hosted forges,
+// see config.Forge
+const (
+	gitlabRawURL          = "{scheme}://{host}/{repo}/-/raw/{ref}/{file}"
+	giteaRawURL           = "{scheme}://{host}/{repo}/raw/{ref}/{file}"
+	bitbucketServerRawURL = "{scheme}://{host}/{repo}/raw/{file}?at={ref}"
+)
+
+// forge is the API and the raw URLs of a code hosting platform.
+// API requests send the credential of the request, if bound to the
+// host of the API, or the one of the configuration
+type forge interface {
+	// rawFile returns the raw URL of file in repo at ref
+	rawFile(repo *url.URL, ref string, file string) string
+	// rawRoot returns the raw root of repo at ref, empty if the
+	// parser can't tell the repository from it
+	rawRoot(repo *url.URL, ref string) string
+	// apiHost returns the host of the API of repo
+	apiHost(repo *url.URL) string
+	// defaultBranch returns the default branch of repo
+	defaultBranch(ctx context.Context, repo *url.URL, credential *config.Credential) (string, error)
+	// commit returns the hash of the commit ref points to
+	commit(ctx context.Context, repo *url.URL, ref string, credential *config.Credential) (string, error)
+}
+
+// selfHosted is a forge of the registry, whose URLs vcsurl doesn't know
+type selfHosted interface {
+	forge
+	// split returns the repository of u, a repository, file or raw
+	// file URL, and for files their ref and path in the repository.
+	// repo is nil if u is not an URL of the forge
+	split(u *url.URL) (repo *url.URL, ref string, file string)
+}
+
+// registered returns the forge of host in the registry
+// set by Configure, nil if host is not self-hosted
+func registered(host string) selfHosted {
+	for _, f := range settings.Forges {
+		if !strings.EqualFold(f.Host, host) {
+			continue
+		}
+		switch f.Type {
+		case config.ForgeGitLab:
+			return gitlab{template: f.RawURL}
+		case config.ForgeGitea:
+			return gitea{template: f.RawURL}
+		case config.ForgeBitbucketServer:
+			return bitbucketServer{template: f.RawURL}
+		}
+	}
+	return nil
+}
+
+// lookupForge returns the forge of u, a repository, file or raw file URL,
+// its repository and, for files, their path in the repository
+func lookupForge(u *url.URL) (forge, *url.URL, string, error) {
+	if f := registered(u.Host); f != nil {
+		repo, _, file := f.split(u)
+		if repo == nil {
+			return nil, nil, "", fmt.Errorf("%s", "URL is not valid")
+		}
+		return f, repo, file, nil
+	}
+
+	v, restore, ok := vcsURL(u)
+	if !ok {
+		return nil, nil, "", fmt.Errorf("hosting platform of %s not supported", u)
+	}
+	repo := restore(vcsurl.GetRepo(copyURL(v)))
+	if repo == nil {
+		return nil, nil, "", fmt.Errorf("%s is not a repository", u)
+	}
+	var file string
+	if vcsurl.IsFile(v) || vcsurl.IsRawFile(v) {
+		rawFile := restore(vcsurl.GetRawFile(copyURL(v)))
+		rawRoot := restore(vcsurl.GetRawRoot(copyURL(v)))
+		if rawFile == nil || rawRoot == nil || !strings.HasPrefix(rawFile.String(), rawRoot.String()) {
+			return nil, nil, "", fmt.Errorf("%s", "URL is not valid")
+		}
+		file = strings.TrimPrefix(rawFile.String(), rawRoot.String())
+	}
+
+	switch {
+	case vcsurl.IsGitHub(repo):
+		return github{api: githubAPI}, repo, file, nil
+	case vcsurl.IsBitBucket(repo):
+		return bitbucket{api: bitbucketAPI}, repo, file, nil
+	case isGitLab(repo.Scheme, repo.Host):
+		return gitlab{}, repo, file, nil
+	}
+	return nil, nil, "", fmt.Errorf("hosting platform of %s not supported", repo)
+}
+
+// copyURL returns a copy of u, vcsurl functions modify their argument
+func copyURL(u *url.URL) *url.URL {
+	c := *u
+	return &c
+}
+
+// repoPath returns the path of repo without leading and trailing slashes
+func repoPath(repo *url.URL) string {
+	return strings.Trim(repo.Path, "/")
+}
+
+// hostOf returns the host of rawURL, empty if it's not valid
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// repoURL returns the repository at p on the host of u
+func repoURL(u *url.URL, p string) *url.URL {
+	return &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + strings.TrimSuffix(strings.Trim(p, "/"), ".git")}
+}
+
+// expandRawURL returns the raw URL of file in repo at ref
+// using template, see config.Forge
+func expandRawURL(template string, repo *url.URL, ref string, file string) string {
+	return strings.NewReplacer(
+		"{scheme}", repo.Scheme,
+		"{host}", repo.Host,
+		"{repo}", repoPath(repo),
+		"{ref}", ref,
+		"{file}", file,
+	).Replace(template)
+}
+
+// github is github.com, with the REST API v3
+type github struct {
+	api string
+}
+
+func (g github) rawFile(repo *url.URL, ref string, file string) string {
+	return g.rawRoot(repo, ref) + file
+}
+
+func (g github) rawRoot(repo *url.URL, ref string) string {
+	return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/", repoPath(repo), ref)
+}
+
+func (g github) apiHost(repo *url.URL) string {
+	return hostOf(g.api)
+}
+
+func (g github) defaultBranch(ctx context.Context, repo *url.URL, credential *config.Credential) (string, error) {
+	var res struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := getJSON(ctx, fmt.Sprintf("%s/repos/%s", g.api, repoPath(repo)), &res, credential)
+	return res.DefaultBranch, err
+}
+
+func (g github) commit(ctx context.Context, repo *url.URL, ref string, credential *config.Credential) (string, error) {
+	var res struct {
+		SHA string `json:"sha"`
+	}
+	err := getJSON(ctx, fmt.Sprintf("%s/repos/%s/commits/%s", g.api, repoPath(repo), url.PathEscape(ref)), &res, credential)
+	return res.SHA, err
+}
+
+// bitbucket is bitbucket.org, with the REST API 2.0
+type bitbucket struct {
+	api string
+}
+
+func (b bitbucket) rawFile(repo *url.URL, ref string, file string) string {
+	return b.rawRoot(repo, ref) + file
+}
+
+func (b bitbucket) rawRoot(repo *url.URL, ref string) string {
+	return fmt.Sprintf("https://bitbucket.org/%s/raw/%s/", repoPath(repo), ref)
+}
+
+func (b bitbucket) apiHost(repo *url.URL) string {
+	return hostOf(b.api)
+}
+
+func (b bitbucket) defaultBranch(ctx context.Context, repo *url.URL, credential *config.Credential) (string, error) {
+	var res struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	err := getJSON(ctx, fmt.Sprintf("%s/repositories/%s", b.api, repoPath(repo)), &res, credential)
+	return res.MainBranch.Name, err
+}
+
+func (b bitbucket) commit(ctx context.Context, repo *url.URL, ref string, credential *config.Credential) (string, error) {
+	var res struct {
+		Hash string `json:"hash"`
+	}
+	err := getJSON(ctx, fmt.Sprintf("%s/repositories/%s/commit/%s", b.api, repoPath(repo), url.PathEscape(ref)), &res, credential)
+	return res.Hash, err
+}
+
+// gitlab is gitlab.com or a self-hosted instance, with the REST API v4
+type gitlab struct {
+	// template of raw URLs, gitlabRawURL if empty
+	template string
+}
+
+var (
+	gitlabFile       = regexp.MustCompile(`^/(.+?)/-/(?:blob|raw)/([^/]+)/(.+)$`)
+	gitlabLegacyFile = regexp.MustCompile(`^/(.+?)/(?:blob|raw)/([^/]+)/(.+)$`)
+)
+
+func (g gitlab) split(u *url.URL) (*url.URL, string, string) {
+	m := gitlabFile.FindStringSubmatch(u.Path)
+	if m == nil {
+		m = gitlabLegacyFile.FindStringSubmatch(u.Path)
+	}
+	if m != nil {
+		return repoURL(u, m[1]), m[2], m[3]
+	}
+	// projects are in a group or a namespace, subgroups are allowed
+	if p := strings.Trim(u.Path, "/"); strings.Contains(p, "/") {
+		return repoURL(u, p), "", ""
+	}
+	return nil, "", ""
+}
+
+func (g gitlab) rawFile(repo *url.URL, ref string, file string) string {
+	if g.template == "" {
+		return expandRawURL(gitlabRawURL, repo, ref, file)
+	}
+	return expandRawURL(g.template, repo, ref, file)
+}
+
+func (g gitlab) rawRoot(repo *url.URL, ref string) string {
+	// the parser only knows the default raw URLs
+	if g.template != "" && g.template != gitlabRawURL {
+		return ""
+	}
+	return expandRawURL(gitlabRawURL, repo, ref, "")
+}
+
+func (g gitlab) apiHost(repo *url.URL) string {
+	return repo.Host
+}
+
+// project returns the API URL of the project of repo
+func (g gitlab) project(repo *url.URL) string {
+	return fmt.Sprintf("%s://%s/api/v4/projects/%s", repo.Scheme, repo.Host, url.PathEscape(repoPath(repo)))
+}
+
+func (g gitlab) defaultBranch(ctx context.Context, repo *url.URL, credential *config.Credential) (string, error) {
+	var res struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := getJSON(ctx, g.project(repo), &res, credential)
+	return res.DefaultBranch, err
+}
+
+func (g gitlab) commit(ctx context.Context, repo *url.URL, ref string, credential *config.Credential) (string, error) {
+	var res struct {
+		ID string `json:"id"`
+	}
+	err := getJSON(ctx, fmt.Sprintf("%s/repository/commits/%s", g.project(repo), url.PathEscape(ref)), &res, credential)
+	return res.ID, err
+}
+
+// gitea is a Gitea or Forgejo instance, with the REST API v1
+type gitea struct {
+	// template of raw URLs, giteaRawURL if empty
+	template string
+}
+
+var giteaFile = regexp.MustCompile(`^/([^/]+/[^/]+)/(?:src|raw)/(?:(?:branch|tag|commit)/)?([^/]+)/(.+)$`)
+
+func (g gitea) split(u *url.URL) (*url.URL, string, string) {
+	if m := giteaFile.FindStringSubmatch(u.Path); m != nil {
+		return repoURL(u, m[1]), m[2], m[3]
+	}
+	if p := strings.Trim(u.Path, "/"); strings.Count(p, "/") == 1 {
+		return repoURL(u, p), "", ""
+	}
+	return nil, "", ""
+}
+
+func (g gitea) rawFile(repo *url.URL, ref string, file string) string {
+	if g.template == "" {
+		return expandRawURL(giteaRawURL, repo, ref, file)
+	}
+	return expandRawURL(g.template, repo, ref, file)
+}
+
+// rawRoot is empty, vcsurl doesn't know the raw URLs of Gitea
+func (g gitea) rawRoot(repo *url.URL, ref string) string {
+	return ""
+}
+
+func (g gitea) apiHost(repo *url.URL) string {
+	return repo.Host
+}
+
+// api returns the API URL of repo
+func (g gitea) api(repo *url.URL) string {
+	return fmt.Sprintf("%s://%s/api/v1/repos/%s", repo.Scheme, repo.Host, repoPath(repo))
+}
+
+func (g gitea) defaultBranch(ctx context.Context, repo *url.URL, credential *config.Credential) (string, error) {
+	var res struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := getJSON(ctx, g.api(repo), &res, credential)
+	return res.DefaultBranch, err
+}
+
+func (g gitea) commit(ctx context.Context, repo *url.URL, ref string, credential *config.Credential) (string, error) {
+	var res []struct {
+		SHA string `json:"sha"`
+	}
+	// sha is a branch, a tag or a commit
+	err := getJSON(ctx, fmt.Sprintf("%s/commits?sha=%s&limit=1&stat=false", g.api(repo), url.QueryEscape(ref)), &res, credential)
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 0 {
+		return "", errNotFound
+	}
+	return res[0].SHA, nil
+}
+
+// bitbucketServer is a Bitbucket Server or Data Center
+// instance, with the REST API 1.0
+type bitbucketServer struct {
+	// template of raw URLs, bitbucketServerRawURL if empty
+	template string
+}
+
+var (
+	bitbucketServerRepo  = regexp.MustCompile(`^/((?:projects|users)/[^/]+/repos/[^/]+)(?:/(?:browse|raw)(?:/(.*))?)?$`)
+	bitbucketServerClone = regexp.MustCompile(`^/scm/([^/]+)/([^/]+)$`)
+)
+
+func (b bitbucketServer) split(u *url.URL) (*url.URL, string, string) {
+	p := strings.TrimSuffix(u.Path, "/")
+	if m := bitbucketServerClone.FindStringSubmatch(p); m != nil {
+		// personal repositories have ~user as project key
+		if strings.HasPrefix(m[1], "~") {
+			return repoURL(u, path.Join("users", m[1][1:], "repos", m[2])), "", ""
+		}
+		return repoURL(u, path.Join("projects", m[1], "repos", m[2])), "", ""
+	}
+	m := bitbucketServerRepo.FindStringSubmatch(p)
+	if m == nil {
+		return nil, "", ""
+	}
+	if m[2] == "" {
+		return repoURL(u, m[1]), "", ""
+	}
+	ref := u.Query().Get("at")
+	ref = strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/")
+	return repoURL(u, m[1]), ref, m[2]
+}
+
+func (b bitbucketServer) rawFile(repo *url.URL, ref string, file string) string {
+	template := b.template
+	if template == "" {
+		template = bitbucketServerRawURL
+		if ref == "" {
+			// default branch
+			template = strings.TrimSuffix(template, "?at={ref}")
+		}
+	}
+	return expandRawURL(template, repo, ref, file)
+}
+
+// rawRoot is empty, vcsurl doesn't know the raw URLs of Bitbucket Server
+func (b bitbucketServer) rawRoot(repo *url.URL, ref string) string {
+	return ""
+}
+
+func (b bitbucketServer) apiHost(repo *url.URL) string {
+	return repo.Host
+}
+
+// api returns the API URL of repo
+func (b bitbucketServer) api(repo *url.URL) string {
+	return fmt.Sprintf("%s://%s/rest/api/1.0/%s", repo.Scheme, repo.Host, repoPath(repo))
+}
+
+func (b bitbucketServer) defaultBranch(ctx context.Context, repo *url.URL, credential *config.Credential) (string, error) {
+	var res struct {
+		DisplayID string `json:"displayId"`
+	}
+	err := getJSON(ctx, b.api(repo)+"/default-branch", &res, credential)
+	return res.DisplayID, err
+}
+
+func (b bitbucketServer) commit(ctx context.Context, repo *url.URL, ref string, credential *config.Credential) (string, error) {
+	var res struct {
+		ID string `json:"id"`
+	}
+	err := getJSON(ctx, fmt.Sprintf("%s/commits/%s", b.api(repo), url.PathEscape(ref)), &res, credential)
+	return res.ID, err
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// withForge adds the forge of server to the registry
+// and returns the function restoring the settings
+func withForge(server *httptest.Server, forgeType string, rawURL string) func() {
+	saved := Settings()
+	cfg := saved
+	cfg.Forges = []config.Forge{{Host: strings.TrimPrefix(server.URL, "http://"), Type: forgeType, RawURL: rawURL}}
+	Configure(cfg)
+	return func() { Configure(saved) }
+}
+
+func TestForgeGitLab(t *testing.T) {
+	server := newAPIServer(map[string]string{
+		"/api/v4/projects/pa%2Fsub%2Frepo":                         `{"default_branch": "main"}`,
+		"/api/v4/projects/pa%2Fsub%2Frepo/repository/commits/main": `{"id": "1111111111111111111111111111111111111111"}`,
+		"/pa/sub/repo/-/raw/main/publiccode.yml":                   "name: Medusa\n",
+	})
+	defer server.Close()
+	defer withForge(server, config.ForgeGitLab, "")()
+
+	rawURL, err := ResolveRawFile(server.URL + "/pa/sub/repo/-/blob/v1.0/docs/publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/v1.0/docs/publiccode.yml", rawURL)
+
+	rawURL, err = ResolveRawFile(server.URL + "/pa/sub/repo/blob/v1.0/publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/v1.0/publiccode.yml", rawURL)
+
+	_, err = ResolveRawFile(server.URL + "/pa/sub/repo")
+	assert.Error(t, err)
+
+	// repositories are at HEAD, the default branch is resolved by ResolveRef
+	u, _ := url.Parse(server.URL + "/pa/sub/repo.git")
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/HEAD/", GetRawURL(u))
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/v1.0/", GetRawURLAtRef(u, "v1.0"))
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/HEAD/", Options{}.NewParser(u).RemoteBaseURL)
+	c, err := ResolveRef(context.Background(), u, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/main/", c.RawRoot)
+
+	rawURL, checkout, err := ResolveRemoteFile(context.Background(), server.URL+"/pa/sub/repo", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/sub/repo/-/raw/main/publiccode.yml", rawURL)
+	assert.Equal(t, &Checkout{
+		Repository: server.URL + "/pa/sub/repo",
+		Ref:        "main",
+		Commit:     "1111111111111111111111111111111111111111",
+		RawRoot:    server.URL + "/pa/sub/repo/-/raw/main/",
+	}, checkout)
+
+	file, err := FetchConditional(context.Background(), rawURL, "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Medusa\n", string(file.Body))
+
+	// requests of canceled contexts are not sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = ResolveRemoteFile(ctx, server.URL+"/pa/sub/repo", "", nil)
+	assert.Error(t, err)
+	_, err = FetchConditional(ctx, rawURL, "", "", nil)
+	assert.Error(t, err)
+}
+
+func TestForgeGitea(t *testing.T) {
+	server := newAPIServer(map[string]string{
+		"/api/v1/repos/pa/repo": `{"default_branch": "develop"}`,
+		"/api/v1/repos/pa/repo/commits?sha=develop&limit=1&stat=false": `[{"sha": "2222222222222222222222222222222222222222"}]`,
+		"/api/v1/repos/pa/repo/commits?sha=v1.0&limit=1&stat=false":    `[{"sha": "3333333333333333333333333333333333333333"}]`,
+		"/pa/repo/raw/develop/publiccode.yml":                          "name: Medusa\n",
+	})
+	defer server.Close()
+	defer withForge(server, config.ForgeGitea, "")()
+
+	for _, fileURL := range []string{
+		server.URL + "/pa/repo/src/branch/v1.0/docs/publiccode.yml",
+		server.URL + "/pa/repo/raw/tag/v1.0/docs/publiccode.yml",
+		server.URL + "/pa/repo/src/v1.0/docs/publiccode.yml",
+	} {
+		rawURL, err := ResolveRawFile(fileURL)
+		assert.NoError(t, err)
+		assert.Equal(t, server.URL+"/pa/repo/raw/v1.0/docs/publiccode.yml", rawURL, fileURL)
+	}
+
+	// the parser doesn't know Gitea raw URLs
+	u, _ := url.Parse(server.URL + "/pa/repo")
+	assert.Empty(t, GetRawURL(u))
+
+	rawURL, checkout, err := ResolveRemoteFile(context.Background(), server.URL+"/pa/repo.git", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/repo/raw/develop/publiccode.yml", rawURL)
+	assert.Equal(t, "develop", checkout.Ref)
+	assert.Equal(t, "2222222222222222222222222222222222222222", checkout.Commit)
+	assert.Empty(t, checkout.RawRoot)
+
+	file, err := FetchConditional(context.Background(), rawURL, "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Medusa\n", string(file.Body))
+
+	rawURL, checkout, err = ResolveRemoteFile(context.Background(), server.URL+"/pa/repo/src/branch/develop/docs/publiccode.yml", "v1.0", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/repo/raw/v1.0/docs/publiccode.yml", rawURL)
+	assert.Equal(t, "3333333333333333333333333333333333333333", checkout.Commit)
+
+	_, _, err = ResolveRemoteFile(context.Background(), server.URL+"/pa/repo", "missing", nil)
+	assert.IsType(t, RefNotFoundError{}, err)
+
+	// custom raw URLs
+	restore := withForge(server, config.ForgeGitea, "{scheme}://{host}/{repo}/raw/branch/{ref}/{file}")
+	defer restore()
+	rawURL, err = ResolveRawFile(server.URL + "/pa/repo/src/branch/main/publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/repo/raw/branch/main/publiccode.yml", rawURL)
+}
+
+func TestForgeBitbucketServer(t *testing.T) {
+	server := newAPIServer(map[string]string{
+		"/rest/api/1.0/projects/PA/repos/repo/default-branch": `{"id": "refs/heads/main", "displayId": "main"}`,
+		"/rest/api/1.0/projects/PA/repos/repo/commits/main":   `{"id": "4444444444444444444444444444444444444444"}`,
+		"/projects/PA/repos/repo/raw/publiccode.yml?at=main":  "name: Medusa\n",
+	})
+	defer server.Close()
+	defer withForge(server, config.ForgeBitbucketServer, "")()
+
+	rawURL, err := ResolveRawFile(server.URL + "/projects/PA/repos/repo/browse/docs/publiccode.yml?at=refs%2Fheads%2Fv1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/projects/PA/repos/repo/raw/docs/publiccode.yml?at=v1.0", rawURL)
+
+	// default branch
+	rawURL, err = ResolveRawFile(server.URL + "/users/jdoe/repos/repo/browse/publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/users/jdoe/repos/repo/raw/publiccode.yml", rawURL)
+
+	for _, repoURL := range []string{
+		server.URL + "/projects/PA/repos/repo",
+		server.URL + "/projects/PA/repos/repo/browse",
+		server.URL + "/scm/PA/repo.git",
+	} {
+		rawURL, checkout, err := ResolveRemoteFile(context.Background(), repoURL, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, server.URL+"/projects/PA/repos/repo/raw/publiccode.yml?at=main", rawURL, repoURL)
+		if assert.NotNil(t, checkout) {
+			assert.Equal(t, server.URL+"/projects/PA/repos/repo", checkout.Repository)
+			assert.Equal(t, "4444444444444444444444444444444444444444", checkout.Commit)
+		}
+	}
+
+	u, _ := url.Parse(server.URL + "/scm/~jdoe/repo.git")
+	c, err := ResolveRef(context.Background(), u, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/users/jdoe/repos/repo", c.Repository)
+	assert.Equal(t, "HEAD", c.Ref)
+
+	file, err := FetchConditional(context.Background(), server.URL+"/projects/PA/repos/repo/raw/publiccode.yml?at=main", "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Medusa\n", string(file.Body))
+
+	_, err = ResolveRawFile(server.URL + "/plugins/servlet/x")
+	assert.Error(t, err)
+}
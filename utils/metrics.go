@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/italia/publiccode-validator/metrics"
+)
+
+// ObserveValidation records the outcome of a validation
+// and its error keys in the metrics
+func ObserveValidation(errParse error, errConverting error) {
+	switch {
+	case errConverting != nil:
+		metrics.ObserveValidation(metrics.OutcomeError, nil)
+	case errParse != nil:
+		var keys []string
+		for _, e := range ErrorsToValidationErrors(errParse) {
+			keys = append(keys, metricKey(e))
+		}
+		metrics.ObserveValidation(metrics.OutcomeInvalid, keys)
+	default:
+		metrics.ObserveValidation(metrics.OutcomeValid, nil)
+	}
+}
+
+// ObserveFetch records an outbound request to host started at start,
+// labeled by metricHost. It's the Observe of the outbound Transport
+func ObserveFetch(host string, start time.Time, err error) {
+	metrics.ObserveFetch(metricHost(host), start, err)
+}
+
+// metricKey returns the key of e with a bounded set of values:
+// languages and indexes become * and unknown keys are grouped
+func metricKey(e ErrorInvalidValue) string {
+	if e.Code == CodeUnknownKey || e.Code == CodeInvalidKey {
+		return "(unknown)"
+	}
+	segments := strings.Split(e.Key, "/")
+	for i, s := range segments {
+		if _, err := strconv.Atoi(s); err == nil || (i == 1 && segments[0] == "description") {
+			segments[i] = "*"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// forgeNames label the hosts of major code hosting platforms
+var forgeNames = map[string]string{
+	"github.com":                "github",
+	"raw.githubusercontent.com": "github",
+	"api.github.com":            "github",
+	"gitlab.com":                "gitlab",
+	"bitbucket.org":             "bitbucket",
+	"api.bitbucket.org":         "bitbucket",
+}
+
+// metricHost returns the label of host with a bounded set of values:
+// the name of major code hosting platforms, the host of self-hosted
+// forges of the configuration and other for the rest
+func metricHost(host string) string {
+	host = strings.ToLower(host)
+	if name, ok := forgeNames[host]; ok {
+		return name
+	}
+	if registered(host) != nil {
+		return host
+	}
+	return "other"
+}
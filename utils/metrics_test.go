@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricKey(t *testing.T) {
+	assert.Equal(t, "legal/license", metricKey(ErrorInvalidValue{Key: "legal/license", Code: CodeInvalidLicense}))
+	assert.Equal(t, "description/*/screenshots/*", metricKey(ErrorInvalidValue{Key: "description/eng/screenshots/0"}))
+	assert.Equal(t, "(unknown)", metricKey(ErrorInvalidValue{Key: "it/foo", Code: CodeUnknownKey}))
+}
+
+func TestMetricHost(t *testing.T) {
+	assert.Equal(t, "github", metricHost("raw.githubusercontent.com"))
+	assert.Equal(t, "github", metricHost("API.github.com"))
+	assert.Equal(t, "gitlab", metricHost("gitlab.com"))
+	assert.Equal(t, "bitbucket", metricHost("bitbucket.org"))
+	assert.Equal(t, "other", metricHost("random.example.org"))
+
+	saved := Settings()
+	defer Configure(saved)
+	cfg := saved
+	cfg.Forges = []config.Forge{{Host: "git.comune.example.it", Type: config.ForgeGitLab}}
+	Configure(cfg)
+	assert.Equal(t, "git.comune.example.it", metricHost("git.comune.example.it"))
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is an item of an Accept header, e.g. text/* ;q=0.5
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept returns the media ranges of an Accept header,
+// ranges with an invalid syntax or weight are ignored
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, item := range strings.Split(accept, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(item)
+		if err != nil {
+			continue
+		}
+		slash := strings.Index(mediaType, "/")
+		if slash < 0 {
+			continue
+		}
+		r := mediaRange{typ: mediaType[:slash], subtype: mediaType[slash+1:], q: 1}
+		if r.typ == "*" && r.subtype != "*" {
+			continue
+		}
+		if v, ok := params["q"]; ok {
+			q, err := strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+			r.q = q
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// Negotiate returns the media type of offers preferred by an Accept
+// header, following RFC 7231 section 5.3.2: the weight of every offer
+// is the one of the most specific range matching it, ties are broken
+// by the order of offers. ok is false when no offer is acceptable.
+// An empty header accepts anything, so the first offer is returned
+func Negotiate(accept string, offers []string) (mediaType string, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return "", false
+		}
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		slash := strings.Index(offer, "/")
+		typ, subtype := offer[:slash], offer[slash+1:]
+
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/x-yaml", "application/yaml", "text/yaml", "application/json", "text/plain", "text/html"}
+
+	for accept, want := range map[string]string{
+		"":                                    "application/x-yaml",
+		"*/*":                                 "application/x-yaml",
+		"application/json":                    "application/json",
+		"application/json, text/plain;q=0.9":  "application/json",
+		"text/plain;q=0.9, application/json":  "application/json",
+		"text/*":                              "text/yaml",
+		"text/*;q=0.5, text/html":             "text/html",
+		"text/html;level=1, */*;q=0.1":        "text/html",
+		"application/*;q=0.2, text/plain;q=1": "text/plain",
+		"*/*, application/x-yaml;q=0":         "application/yaml",
+		"APPLICATION/JSON":                    "application/json",
+		"text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8": "text/html",
+		// invalid ranges are ignored
+		"application/json;q=2, text/plain": "text/plain",
+	} {
+		got, ok := Negotiate(accept, offers)
+		assert.True(t, ok, accept)
+		assert.Equal(t, want, got, accept)
+	}
+
+	for _, accept := range []string{"image/png", "application/json;q=0", "text/csv, application/*;q=0", "nonsense"} {
+		_, ok := Negotiate(accept, offers)
+		assert.False(t, ok, accept)
+	}
+}
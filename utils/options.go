@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Options request scoped settings used to validate a single document.
+// Every handler builds its own copy, so concurrent requests never
+// share them.
+type Options struct {
+	// DisableNetwork disables URL existence and remote files checks
+	DisableNetwork bool
+	// RemoteBaseURL is the raw repository root used to resolve relative
+	// paths. If empty it is computed from the url key of the document
+	RemoteBaseURL string
+	// Strict promotes warnings to errors
+	Strict bool
+	// Lenient makes the parser upgrade legacy keys instead of
+	// refusing them, reporting them as warnings. Set by strict=false
+	Lenient bool
+	// Ref is the branch, tag or commit of the repository used to
+	// compute RemoteBaseURL and to fetch remote files, default
+	// branch of the hosting platform if empty
+	Ref string
+	// LocalBasePath is the directory containing the document, used
+	// to check relative paths on filesystem. Never set from requests
+	LocalBasePath string
+	// Preserve returns the submitted document with only the edits
+	// needed to normalize it, instead of the one of the parser
+	Preserve bool
+	// Envelope returns valid documents in the message, with the
+	// warnings, instead of the normalized document alone
+	Envelope bool
+	// Credential authenticates requests to the repository validated,
+	// from the Repository-Authorization header. It's sent only to the
+	// host it's bound to, and never logged
+	Credential *config.Credential
+	// ServerCredential is true when Credential is the one of the
+	// server, see BindRemoteCredential. Its results are never cached
+	ServerCredential bool
+}
+
+// DefaultOptions returns the settings used when the client doesn't
+// override any of them
+func DefaultOptions() Options {
+	return Options{
+		DisableNetwork: settings.DisableNetwork,
+	}
+}
+
+// OptionsFromRequest returns the validation options read from
+// query parameters, starting from defaults
+func OptionsFromRequest(r *http.Request) Options {
+	opts := DefaultOptions()
+	query := r.URL.Query()
+
+	if v := query.Get("disableNetwork"); v != "" {
+		disableNetwork, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Infof("invalid disableNetwork value %q, default to %v", v, opts.DisableNetwork)
+		} else {
+			opts.DisableNetwork = disableNetwork
+		}
+	}
+	if v := query.Get("strict"); v != "" {
+		strict, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Infof("invalid strict value %q, default to %v", v, opts.Strict)
+		} else {
+			opts.Strict = strict
+			opts.Lenient = !strict
+		}
+	}
+	if v := query.Get("preserve"); v != "" {
+		preserve, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Infof("invalid preserve value %q, default to %v", v, opts.Preserve)
+		} else {
+			opts.Preserve = preserve
+		}
+	}
+	if v := query.Get("envelope"); v != "" {
+		envelope, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Infof("invalid envelope value %q, default to %v", v, opts.Envelope)
+		} else {
+			opts.Envelope = envelope
+		}
+	}
+	opts.RemoteBaseURL = query.Get("remoteBaseURL")
+	opts.Ref = query.Get("ref")
+	if opts.Ref == "" {
+		// branch is the name of ref before tags and commits
+		opts.Ref = query.Get("branch")
+	}
+	if v := r.Header.Get(AuthorizationHeader); v != "" {
+		credential, err := CredentialFromHeader(v)
+		if err != nil {
+			// never log the value, it's a secret
+			log.Infof("invalid %s header, ignored: %v", AuthorizationHeader, err)
+		} else {
+			opts.Credential = credential
+		}
+	}
+
+	return opts
+}
+
+// NewParser returns a new publiccode parser configured
+// with these options. url is the repository url found in the
+// document, if any, and it's used only when RemoteBaseURL is empty
+func (o Options) NewParser(url *url.URL) *publiccode.Parser {
+	p := publiccode.NewParser()
+	p.DisableNetwork = o.DisableNetwork
+	p.Strict = !o.Lenient
+	p.RemoteBaseURL = o.RemoteBaseURL
+	p.LocalBasePath = o.LocalBasePath
+
+	if p.RemoteBaseURL == "" && url != nil {
+		p.RemoteBaseURL = rawURLAtRef(url, o.Ref)
+	}
+	if !p.DisableNetwork {
+		p.Domain = parserDomain(p.RemoteBaseURL, o.Credential)
+	}
+	return p
+}
+
+// GetRawURLAtRef returns the raw root repository like GetRawURL,
+// pointing to ref instead of the default branch, if not empty
+func GetRawURLAtRef(url *url.URL, ref string) string {
+	return rawURLAtRef(url, ref)
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Position is a range in the submitted document. Lines and columns
+// are 1-based, the end is exclusive
+type Position struct {
+	Line      int `json:"line,omitempty"`
+	Column    int `json:"column,omitempty"`
+	EndLine   int `json:"endLine,omitempty"`
+	EndColumn int `json:"endColumn,omitempty"`
+}
+
+// locator finds the position of parser keys in a YAML or JSON document
+type locator struct {
+	root  *yamlv3.Node
+	lines [][]rune
+}
+
+// newLocator returns a locator for doc, nil if doc is not valid YAML
+func newLocator(doc []byte) *locator {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal(doc, &document); err != nil || len(document.Content) == 0 {
+		return nil
+	}
+	l := &locator{root: document.Content[0]}
+	for _, line := range strings.Split(string(doc), "\n") {
+		l.lines = append(l.lines, []rune(strings.TrimSuffix(line, "\r")))
+	}
+	return l
+}
+
+// locate returns the position of the error about key: the key itself
+// for unknown and deprecated keys, the nearest existing parent for missing ones and
+// the value otherwise
+func (l *locator) locate(key string, code string) Position {
+	keyNode, valueNode, flow, found := l.find(key)
+
+	switch {
+	case !found && keyNode == nil:
+		// missing at root level, the first line
+		return l.lineRange(l.root.Line)
+	case keyNode == nil:
+		// in more than one item of a sequence, the whole sequence
+		return l.rangeOf(valueNode, flow)
+	case !found, code == CodeUnknownKey, code == CodeInvalidKey, code == CodeDeprecatedKey:
+		return l.rangeOf(keyNode, flow)
+	}
+	return l.rangeOf(valueNode, flow)
+}
+
+// find walks the document following the segments of key and returns the
+// deepest key and value nodes found, if any ancestor is a flow collection,
+// and whether the whole key exists. keyNode is nil for keys found in
+// more than one item of a sequence, valueNode is the sequence then
+func (l *locator) find(key string) (keyNode *yamlv3.Node, valueNode *yamlv3.Node, flow bool, found bool) {
+	valueNode = l.root
+	for _, segment := range strings.Split(key, "/") {
+		if valueNode.Style&yamlv3.FlowStyle != 0 {
+			flow = true
+		}
+		k, v := child(valueNode, segment)
+		if v == nil {
+			return keyNode, valueNode, flow, false
+		}
+		if k == nil {
+			return nil, v, flow, true
+		}
+		keyNode, valueNode = k, v
+	}
+	return keyNode, valueNode, flow, true
+}
+
+// child returns key and value nodes of segment in a mapping. In a
+// sequence it returns the ones of the only item having segment: keys
+// of the parser have no index, with more items it returns no key and
+// the sequence itself
+func child(n *yamlv3.Node, segment string) (*yamlv3.Node, *yamlv3.Node) {
+	if n.Kind == yamlv3.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == segment {
+				return n.Content[i], n.Content[i+1]
+			}
+		}
+	case yamlv3.SequenceNode:
+		var keyNode, valueNode *yamlv3.Node
+		for _, item := range n.Content {
+			k, v := child(item, segment)
+			if v == nil {
+				continue
+			}
+			if valueNode != nil {
+				return nil, n
+			}
+			keyNode, valueNode = k, v
+		}
+		return keyNode, valueNode
+	}
+	return nil, nil
+}
+
+func (l *locator) rangeOf(n *yamlv3.Node, flow bool) Position {
+	endLine, endColumn := l.end(n, flow)
+	return Position{Line: n.Line, Column: n.Column, EndLine: endLine, EndColumn: endColumn}
+}
+
+// lineRange returns the range of a whole line
+func (l *locator) lineRange(line int) Position {
+	return Position{Line: line, Column: 1, EndLine: line, EndColumn: len(l.line(line)) + 1}
+}
+
+func (l *locator) line(line int) []rune {
+	if line < 1 || line > len(l.lines) {
+		return nil
+	}
+	return l.lines[line-1]
+}
+
+// end returns the exclusive end of a node, including its children
+func (l *locator) end(n *yamlv3.Node, flow bool) (int, int) {
+	if n.Kind == yamlv3.MappingNode || n.Kind == yamlv3.SequenceNode {
+		if n.Style&yamlv3.FlowStyle != 0 {
+			return l.flowEnd(n.Line, n.Column)
+		}
+		if len(n.Content) == 0 {
+			return n.Line, n.Column
+		}
+		return l.end(n.Content[len(n.Content)-1], flow)
+	}
+	if n.Kind == yamlv3.AliasNode {
+		return n.Line, n.Column + len([]rune(n.Value)) + 1
+	}
+
+	switch {
+	case n.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0:
+		return l.blockEnd(n.Line)
+	case n.Style&yamlv3.DoubleQuotedStyle != 0:
+		return l.quotedEnd(n.Line, n.Column, '"')
+	case n.Style&yamlv3.SingleQuotedStyle != 0:
+		return l.quotedEnd(n.Line, n.Column, '\'')
+	}
+	// single line plain scalars, e.g. keys, end with their text
+	if value := []rune(n.Value); strings.HasPrefix(string(l.from(n.Line, n.Column)), n.Value) {
+		return n.Line, n.Column + len(value)
+	}
+	return l.plainEnd(n.Line, n.Column, flow)
+}
+
+// from returns the runes of line starting at column
+func (l *locator) from(line int, column int) []rune {
+	runes := l.line(line)
+	if column < 1 || column > len(runes) {
+		return nil
+	}
+	return runes[column-1:]
+}
+
+// plainEnd returns the end of a plain scalar: the end of the line,
+// a comment or, in flow collections, an indicator
+func (l *locator) plainEnd(line int, column int, flow bool) (int, int) {
+	runes := l.line(line)
+	end := column - 1
+	for i := column - 1; i < len(runes); i++ {
+		r := runes[i]
+		if r == '#' && i > 0 && (runes[i-1] == ' ' || runes[i-1] == '\t') {
+			break
+		}
+		if flow && (r == ',' || r == ']' || r == '}') {
+			break
+		}
+		if r != ' ' && r != '\t' {
+			end = i + 1
+		}
+	}
+	return line, end + 1
+}
+
+// quotedEnd returns the position after the closing quote
+func (l *locator) quotedEnd(line int, column int, quote rune) (int, int) {
+	start := column
+	for ; line <= len(l.lines); line++ {
+		runes := l.line(line)
+		for i := start; i < len(runes); i++ {
+			switch {
+			case quote == '"' && runes[i] == '\\':
+				i++
+			case quote == '\'' && runes[i] == '\'' && i+1 < len(runes) && runes[i+1] == '\'':
+				i++
+			case runes[i] == quote:
+				return line, i + 2
+			}
+		}
+		start = 0
+	}
+	return len(l.lines), len(l.line(len(l.lines))) + 1
+}
+
+// blockEnd returns the end of the last line of a literal or folded
+// block scalar whose indicator is on line
+func (l *locator) blockEnd(line int) (int, int) {
+	indent := indentation(l.line(line))
+	last := line
+	for next := line + 1; next <= len(l.lines); next++ {
+		runes := l.line(next)
+		if strings.TrimSpace(string(runes)) == "" {
+			continue
+		}
+		if indentation(runes) <= indent {
+			break
+		}
+		last = next
+	}
+	return last, len(l.line(last)) + 1
+}
+
+// flowEnd returns the position after the bracket closing the
+// flow collection opened at line and column
+func (l *locator) flowEnd(line int, column int) (int, int) {
+	depth := 0
+	var quote rune
+	start := column - 1
+	for ; line <= len(l.lines); line++ {
+		runes := l.line(line)
+		for i := start; i < len(runes); i++ {
+			r := runes[i]
+			switch {
+			case quote != 0:
+				if quote == '"' && r == '\\' {
+					i++
+				} else if r == quote {
+					quote = 0
+				}
+			case r == '"' || r == '\'':
+				quote = r
+			case r == '[' || r == '{':
+				depth++
+			case r == ']' || r == '}':
+				depth--
+				if depth == 0 {
+					return line, i + 2
+				}
+			}
+		}
+		start = 0
+	}
+	return len(l.lines), len(l.line(len(l.lines))) + 1
+}
+
+func indentation(runes []rune) int {
+	n := 0
+	for n < len(runes) && runes[n] == ' ' {
+		n++
+	}
+	// sequence items, e.g. "- key: |", are indented up to the key
+	if n+1 < len(runes) && runes[n] == '-' && runes[n+1] == ' ' {
+		n += 2
+		for n < len(runes) && runes[n] == ' ' {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/italia/publiccode-validator/outbound"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultPublicCodeFile is the file validated when the URL is a repository
+const defaultPublicCodeFile = "publiccode.yml"
+
+// RefNotFoundError is returned when the hosting platform doesn't know a ref
+type RefNotFoundError struct {
+	Repository string
+	Ref        string
+}
+
+func (e RefNotFoundError) Error() string {
+	return fmt.Sprintf("ref %s not found in %s", e.Ref, e.Repository)
+}
+
+// errNotFound is a 404 from the API of a hosting platform
+var errNotFound = errors.New("not found")
+
+// validRef matches branch, tag and commit names, a subset of the
+// ones allowed by git check-ref-format safe to put in URLs
+var validRef = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/-]*$`)
+
+// ValidRef tells whether ref is a valid branch, tag or commit name
+func ValidRef(ref string) bool {
+	return validRef.MatchString(ref) &&
+		!strings.Contains(ref, "..") &&
+		!strings.Contains(ref, "//") &&
+		!strings.HasSuffix(ref, "/") &&
+		!strings.HasSuffix(ref, ".lock")
+}
+
+// Checkout is a repository at a branch, tag or commit
+type Checkout struct {
+	// Repository is the URL of the repository
+	Repository string `json:"repository"`
+	// Ref is the requested branch, tag or commit,
+	// the default branch if none was requested
+	Ref string `json:"ref"`
+	// Commit is the hash of the commit Ref points to,
+	// empty if the hosting platform didn't tell
+	Commit string `json:"commit,omitempty"`
+	// RawRoot is the raw root of the repository at Ref, used as
+	// RemoteBaseURL. Empty when the parser can't tell the repository
+	// from raw URLs of the platform
+	RawRoot string `json:"-"`
+}
+
+// ResolveRef returns the repository of u, a repository or file URL,
+// at ref. When ref is empty the default branch is asked to the hosting
+// platform, HEAD is used if it can't tell. Failures of the API other
+// than unknown requested refs are not errors, Commit is empty then,
+// unless ctx is done. credential is the one of the request, nil if none
+func ResolveRef(ctx context.Context, u *url.URL, ref string, credential *config.Credential) (Checkout, error) {
+	f, repo, _, err := lookupForge(u)
+	if err != nil {
+		return Checkout{}, err
+	}
+	return resolve(ctx, f, repo, ref, credential)
+}
+
+// resolve returns repo at ref, see ResolveRef
+func resolve(ctx context.Context, f forge, repo *url.URL, ref string, credential *config.Credential) (Checkout, error) {
+	if ref != "" && !ValidRef(ref) {
+		return Checkout{}, fmt.Errorf("invalid ref %q", ref)
+	}
+
+	c := Checkout{Repository: repo.String(), Ref: ref}
+	if c.Ref == "" {
+		branch, err := f.defaultBranch(ctx, repo, credential)
+		if err == nil && branch == "" {
+			err = errors.New("empty default branch")
+		}
+		if ctx.Err() != nil {
+			return Checkout{}, ctx.Err()
+		}
+		if err != nil {
+			log.Warnf("default branch of %s not found, using HEAD: %v", repo, err)
+			branch = "HEAD"
+		}
+		c.Ref = branch
+	}
+
+	commit, err := f.commit(ctx, repo, c.Ref, credential)
+	if ctx.Err() != nil {
+		return Checkout{}, ctx.Err()
+	}
+	if err == errNotFound && ref != "" {
+		return Checkout{}, RefNotFoundError{Repository: c.Repository, Ref: c.Ref}
+	}
+	if err != nil {
+		log.Warnf("commit of %s in %s not found: %v", c.Ref, repo, err)
+	}
+	c.Commit = commit
+	c.RawRoot = f.rawRoot(repo, c.Ref)
+
+	return c, nil
+}
+
+// ResolveRemoteFile returns the raw publiccode.yml of urlString. A file
+// URL is used as it is, unless ref is set: then the same file at ref
+// is returned. For repository URLs it's the publiccode.yml in the root
+// of the default branch or of ref. The checkout is nil for file URLs
+// without ref, which are not resolved with the API of the platform
+func ResolveRemoteFile(ctx context.Context, urlString string, ref string, credential *config.Credential) (string, *Checkout, error) {
+	if ref == "" {
+		if rawURL, err := ResolveRawFile(urlString); err == nil {
+			return rawURL, nil, nil
+		}
+	}
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return "", nil, err
+	}
+	f, repo, file, err := lookupForge(u)
+	if err != nil {
+		return "", nil, err
+	}
+	if file == "" {
+		file = defaultPublicCodeFile
+	}
+
+	c, err := resolve(ctx, f, repo, ref, credential)
+	if err != nil {
+		return "", nil, err
+	}
+	return f.rawFile(repo, c.Ref, file), &c, nil
+}
+
+// RemoteHosts returns the hosts ResolveRemoteFile and the fetch of
+// the file of urlString send requests to, the ones of the API and of
+// the raw files of its forge, sorted. The host of urlString if the
+// forge is unknown
+func RemoteHosts(urlString string) []string {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return nil
+	}
+	f, repo, _, err := lookupForge(u)
+	if err != nil {
+		return []string{strings.ToLower(u.Host)}
+	}
+	hosts := []string{strings.ToLower(f.apiHost(repo))}
+	if raw := strings.ToLower(hostOf(f.rawFile(repo, "HEAD", defaultPublicCodeFile))); raw != hosts[0] {
+		hosts = append(hosts, raw)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// getJSON decodes the JSON response of apiURL into v
+func getJSON(ctx context.Context, apiURL string, v interface{}, credential *config.Credential) error {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	authorize(req, credential)
+	resp, err := outbound.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("GET %s returned %s", apiURL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
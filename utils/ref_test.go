@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/italia/publiccode-validator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAPIServer returns a local server answering the paths, with
+// the query if any, of routes with their body, 404 otherwise
+func newAPIServer(routes map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			// detected as GitLab by vcsurl
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+			return
+		}
+		body, ok := routes[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+}
+
+func TestValidRef(t *testing.T) {
+	for _, ref := range []string{"main", "v1.0.0", "release/2.x", "0a1b2c3", "HEAD"} {
+		assert.True(t, ValidRef(ref), ref)
+	}
+	for _, ref := range []string{"", "-x", "/main", "main/", "a..b", "a//b", "a b", "main?x=1", "a#b", "x.lock"} {
+		assert.False(t, ValidRef(ref), ref)
+	}
+}
+
+func TestResolveRefGitHub(t *testing.T) {
+	server := newAPIServer(map[string]string{
+		"/repos/italia/repo":                 `{"default_branch": "main"}`,
+		"/repos/italia/repo/commits/main":    `{"sha": "1111111111111111111111111111111111111111"}`,
+		"/repos/italia/repo/commits/v1.0":    `{"sha": "2222222222222222222222222222222222222222"}`,
+		"/repos/italia/other/commits/HEAD":   `{"sha": "3333333333333333333333333333333333333333"}`,
+		"/repos/italia/repo/commits/rel%2F1": `{"sha": "4444444444444444444444444444444444444444"}`,
+	})
+	defer server.Close()
+	api := githubAPI
+	defer func() { githubAPI = api }()
+	githubAPI = server.URL
+
+	u, _ := url.Parse("https://github.com/italia/repo.git")
+	c, err := ResolveRef(context.Background(), u, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Checkout{
+		Repository: "https://github.com/italia/repo",
+		Ref:        "main",
+		Commit:     "1111111111111111111111111111111111111111",
+		RawRoot:    "https://raw.githubusercontent.com/italia/repo/main/",
+	}, c)
+
+	c, err = ResolveRef(context.Background(), u, "v1.0", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2222222222222222222222222222222222222222", c.Commit)
+	assert.Equal(t, "https://raw.githubusercontent.com/italia/repo/v1.0/", c.RawRoot)
+
+	c, err = ResolveRef(context.Background(), u, "rel/1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "4444444444444444444444444444444444444444", c.Commit)
+	assert.Equal(t, "https://raw.githubusercontent.com/italia/repo/rel/1/", c.RawRoot)
+
+	_, err = ResolveRef(context.Background(), u, "missing", nil)
+	assert.Equal(t, RefNotFoundError{Repository: "https://github.com/italia/repo", Ref: "missing"}, err)
+
+	_, err = ResolveRef(context.Background(), u, "a..b", nil)
+	assert.Error(t, err)
+
+	// no default branch from the API
+	u, _ = url.Parse("https://github.com/italia/other")
+	c, err = ResolveRef(context.Background(), u, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "HEAD", c.Ref)
+	assert.Equal(t, "3333333333333333333333333333333333333333", c.Commit)
+
+	// file URLs at a ref
+	rawURL, checkout, err := ResolveRemoteFile(context.Background(), "https://github.com/italia/repo/blob/master/docs/publiccode.yml", "v1.0", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://raw.githubusercontent.com/italia/repo/v1.0/docs/publiccode.yml", rawURL)
+	assert.Equal(t, "v1.0", checkout.Ref)
+
+	rawURL, checkout, err = ResolveRemoteFile(context.Background(), "https://github.com/italia/repo/blob/master/publiccode.yml", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://raw.githubusercontent.com/italia/repo/master/publiccode.yml", rawURL)
+	assert.Nil(t, checkout)
+
+	rawURL, checkout, err = ResolveRemoteFile(context.Background(), "https://github.com/italia/repo", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://raw.githubusercontent.com/italia/repo/main/publiccode.yml", rawURL)
+	assert.Equal(t, "1111111111111111111111111111111111111111", checkout.Commit)
+}
+
+func TestResolveRefGitLab(t *testing.T) {
+	server := newAPIServer(map[string]string{
+		"/api/v4/projects/italia%2Fgroup%2Frepo":                            `{"default_branch": "develop"}`,
+		"/api/v4/projects/italia%2Fgroup%2Frepo/repository/commits/develop": `{"id": "5555555555555555555555555555555555555555"}`,
+	})
+	defer server.Close()
+
+	rawURL, checkout, err := ResolveRemoteFile(context.Background(), server.URL+"/italia/group/repo", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/italia/group/repo/-/raw/develop/publiccode.yml", rawURL)
+	assert.Equal(t, &Checkout{
+		Repository: server.URL + "/italia/group/repo",
+		Ref:        "develop",
+		Commit:     "5555555555555555555555555555555555555555",
+		RawRoot:    server.URL + "/italia/group/repo/-/raw/develop/",
+	}, checkout)
+
+	_, _, err = ResolveRemoteFile(context.Background(), server.URL+"/italia/group/repo/-/blob/develop/publiccode.yml", "v2", nil)
+	assert.IsType(t, RefNotFoundError{}, err)
+}
+
+func TestResolveRefBitbucket(t *testing.T) {
+	server := newAPIServer(map[string]string{
+		"/repositories/comune/repo":             `{"mainbranch": {"name": "main"}}`,
+		"/repositories/comune/repo/commit/main": `{"hash": "6666666666666666666666666666666666666666"}`,
+	})
+	defer server.Close()
+	api := bitbucketAPI
+	defer func() { bitbucketAPI = api }()
+	bitbucketAPI = server.URL
+
+	u, _ := url.Parse("https://bitbucket.org/comune/repo/src/master/publiccode.yml")
+	c, err := ResolveRef(context.Background(), u, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Checkout{
+		Repository: "https://bitbucket.org/comune/repo",
+		Ref:        "main",
+		Commit:     "6666666666666666666666666666666666666666",
+		RawRoot:    "https://bitbucket.org/comune/repo/raw/main/",
+	}, c)
+}
+
+func TestRemoteHosts(t *testing.T) {
+	assert.Equal(t, []string{"api.github.com", "raw.githubusercontent.com"}, RemoteHosts("https://github.com/italia/repo"))
+	assert.Equal(t, []string{"api.github.com", "raw.githubusercontent.com"}, RemoteHosts("https://raw.githubusercontent.com/italia/repo/master/publiccode.yml"))
+	assert.Equal(t, []string{"api.bitbucket.org", "bitbucket.org"}, RemoteHosts("https://bitbucket.org/comune/repo"))
+	assert.Equal(t, []string{"gitlab.com"}, RemoteHosts("https://gitlab.com/pa/repo"))
+	assert.Equal(t, []string{"example.invalid"}, RemoteHosts("https://example.invalid/publiccode.yml"))
+}
+
+func TestFetchRawFile(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Write([]byte("name: Medusa\n"))
+	}))
+	defer server.Close()
+	defer withForge(server, config.ForgeGitea, "")()
+
+	// the raw file is fetched once
+	b, err := FetchRawFile(context.Background(), server.URL+"/pa/repo/src/branch/main/publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Medusa\n", string(b))
+	assert.Equal(t, []string{"GET /pa/repo/raw/main/publiccode.yml"}, requests)
+}
@@ -2,35 +2,104 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	vcsurl "github.com/alranel/go-vcsurl"
 	"github.com/ghodss/yaml"
 	"github.com/gorilla/mux"
 	"github.com/italia/publiccode-parser-go"
+	"github.com/italia/publiccode-validator/config"
+	"github.com/italia/publiccode-validator/outbound"
 	log "github.com/sirupsen/logrus"
 	yamlv2 "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
-//Message json type mapping, for test purpose
+// Message json type mapping, for test purpose
 type Message struct {
 	Status          int                    `json:"status"`
 	Message         string                 `json:"message"`
 	Publiccode      *publiccode.PublicCode `json:"pc,omitempty"`
 	Error           string                 `json:"error,omitempty"`
 	ValidationError []ErrorInvalidValue    `json:"validationErrors,omitempty"`
+	Warnings        []ErrorInvalidValue    `json:"warnings,omitempty"`
+	// Normalized is the normalized document, when valid
+	Normalized json.RawMessage `json:"normalized,omitempty"`
+}
+
+// YAMLWithNormalized returns m in YAML with normalized, the normalized
+// document in YAML. The document is added to m as a YAML node, keeping
+// its comments and key order
+func (m Message) YAMLWithNormalized(normalized []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(normalized, &doc); err != nil {
+		return nil, err
+	}
+	m.Normalized = nil
+	o, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(o, &root); err != nil {
+		return nil, err
+	}
+
+	message := root.Content[0]
+	key := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: "normalized"}
+	if len(doc.Content) > 0 {
+		value := doc.Content[0]
+		if doc.HeadComment != "" {
+			// the comment at the top of the document
+			value.HeadComment = strings.TrimSpace(doc.HeadComment + "\n" + value.HeadComment)
+		}
+		message.Content = append(message.Content, key, value)
+	}
+
+	var b bytes.Buffer
+	encoder := yamlv3.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), encoder.Close()
+}
+
+// BatchResult is the outcome of a single document of a batch
+type BatchResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	URL   string `json:"url,omitempty"`
+	// Checkout is the repository validated by ref,
+	// if resolved with the hosting platform
+	*Checkout
+	Message
 }
 
 // App application main settings and export for tests
 type App struct {
-	Router         *mux.Router
-	Port           string
-	Debug          bool
-	DisableNetwork bool
+	Router *mux.Router
+	Config config.Config
+}
+
+// settings server wide defaults, see Configure
+var settings = config.Default()
+
+// Configure sets server wide defaults (CORS origins, network mode)
+// used by handlers. It must be called before serving requests
+func Configure(cfg config.Config) {
+	settings = cfg
+}
+
+// Settings returns server wide defaults set by Configure
+func Settings() config.Config {
+	return settings
 }
 
 // GetURLFromYMLBuffer returns a valid URL string based on input object
@@ -48,41 +117,148 @@ func GetURLFromYMLBuffer(in []byte) (*url.URL, error) {
 }
 
 // GetRawURL returns a valid raw root repository based on
-// major code hosting platforms
+// major code hosting platforms and the self-hosted forges of
+// the configuration, without network requests. Repositories of
+// self-hosted forges are at HEAD, see ResolveRef for their default branch
 func GetRawURL(url *url.URL) string {
-	rawURL := vcsurl.GetRawRoot(url)
-	if rawURL != nil {
-		return rawURL.String()
+	return rawURLAtRef(url, "")
+}
+
+// rawURLAtRef returns the raw root of the repository of url at ref,
+// see GetRawURLAtRef
+func rawURLAtRef(url *url.URL, ref string) string {
+	if f := registered(url.Host); f != nil {
+		repo, _, _ := f.split(url)
+		if repo == nil || f.rawRoot(repo, "HEAD") == "" {
+			// the parser can't use raw roots of the forge
+			return ""
+		}
+		if ref == "" {
+			ref = "HEAD"
+		}
+		return f.rawRoot(repo, ref)
 	}
-	return ""
+	v, restore, ok := vcsURL(url)
+	if !ok {
+		return ""
+	}
+	rawURL := restore(vcsurl.GetRawRoot(v))
+	if rawURL == nil {
+		return ""
+	}
+	// vcsurl resolves repository roots to master
+	if ref != "" && strings.HasSuffix(rawURL.String(), "/master/") {
+		return strings.TrimSuffix(rawURL.String(), "master/") + ref + "/"
+	}
+	return rawURL.String()
 }
 
-// GetRawFile returns a valid raw file for
-// major code hosting platforms
-func GetRawFile(urlString string) (string, error) {
+// ResolveRawFile returns the raw file URL of urlString for major
+// code hosting platforms and the self-hosted forges of the
+// configuration, without fetching it
+func ResolveRawFile(urlString string) (string, error) {
 	url, err := url.Parse(urlString)
 	if err != nil {
 		return "", err
 	}
-	rawURL := vcsurl.GetRawFile(url)
-	if rawURL == nil {
+	if f := registered(url.Host); f != nil {
+		repo, ref, file := f.split(url)
+		if repo == nil || file == "" {
+			return "", fmt.Errorf("%s", "URL is not valid")
+		}
+		return f.rawFile(repo, ref, file), nil
+	}
+	v, restore, ok := vcsURL(url)
+	if !ok {
 		return "", fmt.Errorf("%s", "URL is not valid")
 	}
-	resp, err := http.Get(rawURL.String())
+	// GetRawFile returns other URLs of GitHub as they are
+	isFile := vcsurl.IsFile(v) || vcsurl.IsRawFile(v)
+	rawURL := restore(vcsurl.GetRawFile(v))
+	if !isFile || rawURL == nil {
+		return "", fmt.Errorf("%s", "URL is not valid")
+	}
+	return rawURL.String(), nil
+}
+
+// FetchRawFile resolves urlString to its raw file without fetching it,
+// like ResolveRemoteFile, and returns its content with a single request.
+// Requests stop when ctx is done
+func FetchRawFile(ctx context.Context, urlString string) ([]byte, error) {
+	credential := serverCredential(urlString)
+	rawURL, _, err := ResolveRemoteFile(ctx, urlString, "", credential)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	file, err := FetchConditional(ctx, rawURL, "", "", credential)
+	return file.Body, err
+}
+
+// RemoteFile is a fetched file with the validators
+// used for conditional requests
+type RemoteFile struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	// NotModified is true when the file didn't change since
+	// etag or lastModified, Body is empty then
+	NotModified bool
+}
+
+// FetchConditional returns the content of rawURL, or NotModified if
+// it matches etag or lastModified. credential is the one of the
+// request, nil if none. The request stops when ctx is done
+func FetchConditional(ctx context.Context, rawURL string, etag string, lastModified string, credential *config.Credential) (RemoteFile, error) {
+	var file RemoteFile
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return file, err
+	}
+	req = req.WithContext(ctx)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	authorize(req, credential)
+	resp, err := outbound.Client().Do(req)
+	if err != nil {
+		return file, err
+	}
+	defer resp.Body.Close()
+
+	file.ETag = resp.Header.Get("ETag")
+	file.LastModified = resp.Header.Get("Last-Modified")
+	if resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != "") {
+		file.NotModified = true
+		return file, nil
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return rawURL.String(), nil
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return file, fmt.Errorf("GET %s returned %s", rawURL, resp.Status)
 	}
-	return "", errors.New("URL is not valid or response http code is not success either")
+	file.Body, err = ioutil.ReadAll(resp.Body)
+	return file, err
 }
 
-// ErrorsToValidationErrors converts validation errors
-func ErrorsToValidationErrors(err error) (out []ErrorInvalidValue) {
-	j, _ := json.Marshal(err)
-	_ = json.Unmarshal(j, &out)
-	return
+// ErrorsToValidationErrors converts validation errors, nil if
+// err doesn't come from validation. Prefer NewValidationErrors when
+// the document is available, to also report offending values
+func ErrorsToValidationErrors(err error) []ErrorInvalidValue {
+	if es, ok := NewValidationErrors(err, nil).(ValidationErrors); ok {
+		return es
+	}
+	return nil
+}
+
+// ReadBodyError returns the status and message of an error reading a
+// request body: 413 when over the limit set by http.MaxBytesReader
+func ReadBodyError(err error) (int, string) {
+	// the error has no type before Go 1.19
+	if err.Error() == "http: request body too large" {
+		return http.StatusRequestEntityTooLarge, "Request body too large"
+	}
+	return http.StatusBadRequest, "Error reading body"
 }
 
 // Yaml2json yaml to json conversion
@@ -97,7 +273,28 @@ func Yaml2json(y []byte) []byte {
 // SetupResponse set CORS header
 func SetupResponse(w *http.ResponseWriter, req *http.Request) {
 	// cors mode
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+	origin := allowedOrigin(req.Header.Get("Origin"))
+	if origin == "" {
+		return
+	}
+	(*w).Header().Set("Access-Control-Allow-Origin", origin)
+	if origin != "*" {
+		(*w).Header().Add("Vary", "Origin")
+	}
 	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Cache-Control, Postman-Token")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Repository-Authorization, Cache-Control, Postman-Token")
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value
+// for the request origin, empty if not allowed
+func allowedOrigin(origin string) string {
+	for _, o := range settings.CORSOrigins {
+		if o == "*" {
+			return "*"
+		}
+		if origin != "" && o == origin {
+			return origin
+		}
+	}
+	return ""
 }
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYAMLWithNormalized(t *testing.T) {
+	normalized := "# publiccode.yml\n---\nname: Medusa # the name\ndescription: |\n  first\n\n  second\nplatforms:\n  - web\n...\n"
+	message := Message{Status: 200, Message: "Ok", Warnings: []ErrorInvalidValue{{Key: "logo", Reason: "missing recommended key"}}}
+
+	o, err := message.YAMLWithNormalized([]byte(normalized))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// comments are kept
+	assert.Contains(t, string(o), "# publiccode.yml")
+	assert.Contains(t, string(o), "# the name")
+
+	var got struct {
+		Message
+		Normalized map[string]interface{} `json:"normalized"`
+	}
+	if assert.NoError(t, yaml.Unmarshal(o, &got)) {
+		assert.Equal(t, "Ok", got.Message.Message)
+		assert.Len(t, got.Warnings, 1)
+		assert.Equal(t, map[string]interface{}{
+			"name":        "Medusa",
+			"description": "first\n\nsecond\n",
+			"platforms":   []interface{}{"web"},
+		}, got.Normalized)
+	}
+
+	_, err = message.YAMLWithNormalized([]byte("name: [Medusa"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/italia/publiccode-validator/outbound"
+)
+
+// gitlabCom is the host vcsurl knows as GitLab without requests
+const gitlabCom = "gitlab.com"
+
+// Settings of the cache of GitLab detections
+const (
+	// notGitLabTTL is how long a host not detected
+	// as GitLab is not probed again
+	notGitLabTTL = time.Hour
+	// maxProbedHosts bounds the hosts not detected as GitLab kept in
+	// the cache, clients choose them
+	maxProbedHosts = 1024
+)
+
+// gitlabProbe is the detection of a host as a GitLab instance
+type gitlabProbe struct {
+	// done is closed when the detection is over
+	done   chan struct{}
+	gitlab bool
+	// expires is when to probe the host again, zero for GitLab
+	// instances which are never probed again
+	expires time.Time
+}
+
+var (
+	// gitlabMu guards gitlabProbes, never held across requests
+	gitlabMu     sync.Mutex
+	gitlabProbes = map[string]*gitlabProbe{}
+)
+
+// isGitLab tells whether host is a GitLab instance, like vcsurl by
+// the session cookie of its /api page. Concurrent detections of a
+// host share a single request, and the outcome is cached
+func isGitLab(scheme string, host string) bool {
+	if host == gitlabCom {
+		return true
+	}
+
+	gitlabMu.Lock()
+	p, ok := gitlabProbes[host]
+	if ok {
+		select {
+		case <-p.done:
+			ok = p.gitlab || time.Now().Before(p.expires)
+		default:
+			// in flight
+		}
+	}
+	if !ok {
+		p = &gitlabProbe{done: make(chan struct{})}
+		pruneGitLabProbes()
+		gitlabProbes[host] = p
+		gitlabMu.Unlock()
+
+		p.gitlab = probeGitLab(scheme, host)
+		if !p.gitlab {
+			p.expires = time.Now().Add(notGitLabTTL)
+		}
+		close(p.done)
+		return p.gitlab
+	}
+	gitlabMu.Unlock()
+
+	<-p.done
+	return p.gitlab
+}
+
+// pruneGitLabProbes drops expired hosts not detected as GitLab, all
+// of them past maxProbedHosts. gitlabMu must be held
+func pruneGitLabProbes() {
+	if len(gitlabProbes) < maxProbedHosts {
+		return
+	}
+	now := time.Now()
+	for host, p := range gitlabProbes {
+		select {
+		case <-p.done:
+		default:
+			continue
+		}
+		if !p.gitlab && now.After(p.expires) {
+			delete(gitlabProbes, host)
+		}
+	}
+	if len(gitlabProbes) < maxProbedHosts {
+		return
+	}
+	for host, p := range gitlabProbes {
+		select {
+		case <-p.done:
+			if !p.gitlab {
+				delete(gitlabProbes, host)
+			}
+		default:
+		}
+	}
+}
+
+// probeGitLab requests the /api page of host,
+// see isGitLab
+func probeGitLab(scheme string, host string) bool {
+	u := url.URL{Scheme: scheme, Host: host, Path: "/api"}
+	resp, err := outbound.Client().Get(u.String())
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "_gitlab_session" {
+			return true
+		}
+	}
+	return false
+}
+
+// rawGitHubFile matches raw files of raw.githubusercontent.com
+var rawGitHubFile = regexp.MustCompile(`^/([^/]+/[^/]+)/(.+)$`)
+
+// vcsURL returns the URL vcsurl can handle in place of u without
+// requests, and restore to set the host of u back into URLs it returns.
+// ok is false when vcsurl doesn't know the hosting platform of u.
+// vcsurl tells self-hosted GitLab instances with a request, keeping
+// them in a map not safe for concurrent use: it's only given URLs of
+// github.com, bitbucket.org and gitlab.com, the ones of GitLab
+// instances detected by isGitLab are moved to gitlab.com
+func vcsURL(u *url.URL) (v *url.URL, restore func(*url.URL) *url.URL, ok bool) {
+	keep := func(r *url.URL) *url.URL { return r }
+	switch u.Host {
+	case "github.com", "bitbucket.org", gitlabCom:
+		return copyURL(u), keep, true
+	case "raw.githubusercontent.com":
+		// vcsurl probes other hosts than github.com for repositories
+		// and non raw files, ask it for the file on github.com
+		m := rawGitHubFile.FindStringSubmatch(u.Path)
+		if m == nil {
+			return nil, nil, false
+		}
+		return &url.URL{Scheme: "https", Host: "github.com", Path: "/" + m[1] + "/blob/" + m[2]}, keep, true
+	}
+	if u.Host == "" || !isGitLab(u.Scheme, u.Host) {
+		return nil, nil, false
+	}
+	v = copyURL(u)
+	v.Host = gitlabCom
+	restore = func(r *url.URL) *url.URL {
+		if r != nil && r.Host == gitlabCom {
+			r.Host = u.Host
+		}
+		return r
+	}
+	return v, restore, true
+}
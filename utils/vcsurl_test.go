@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGitLabSingleProbe(t *testing.T) {
+	var probes int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			atomic.AddInt32(&probes, 1)
+			<-release
+			http.SetCookie(w, &http.Cookie{Name: "_gitlab_session", Value: "test"})
+		}
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ResolveRawFile(server.URL + "/pa/repo/-/blob/main/publiccode.yml")
+			assert.NoError(t, err)
+		}()
+	}
+
+	// a slow host doesn't stop the ones of other platforms
+	done := make(chan struct{})
+	go func() {
+		rawURL, err := ResolveRawFile("https://github.com/italia/repo/blob/main/publiccode.yml")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://raw.githubusercontent.com/italia/repo/main/publiccode.yml", rawURL)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("github.com waited for the detection of another host")
+	}
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&probes))
+
+	rawURL, err := ResolveRawFile(server.URL + "/pa/repo/-/blob/main/publiccode.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/pa/repo/raw/main/publiccode.yml", rawURL)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&probes))
+}
+
+func TestVcsURLRawGitHub(t *testing.T) {
+	u, _ := url.Parse("https://raw.githubusercontent.com/italia/repo/main/docs/publiccode.yml")
+	rawURL, err := ResolveRawFile(u.String())
+	assert.NoError(t, err)
+	assert.Equal(t, u.String(), rawURL)
+
+	_, repo, file, err := lookupForge(u)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/italia/repo", repo.String())
+	assert.Equal(t, "docs/publiccode.yml", file)
+}
+
+func TestIsGitLabNotGitLab(t *testing.T) {
+	var probes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			atomic.AddInt32(&probes, 1)
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/pa/repo")
+	for i := 0; i < 3; i++ {
+		_, err := ResolveRef(context.Background(), u, "", nil)
+		assert.Error(t, err)
+		assert.Empty(t, GetRawURL(u))
+	}
+	// hosts not detected as GitLab are not probed again
+	assert.Equal(t, int32(1), atomic.LoadInt32(&probes))
+}
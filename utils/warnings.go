@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// MaxRecommendedLongDescription is the length of longDescription above
+// which a warning is reported, the parser refuses more than 10000 chars
+const MaxRecommendedLongDescription = 4000
+
+// deprecatedKeys are the keys of older publiccodeYmlVersion, accepted
+// with a warning when not in strict mode. The value is the new key,
+// empty if the key was removed from the specification
+var deprecatedKeys = map[string]string{
+	"publiccode-yaml-version":    "publiccodeYmlVersion",
+	"it/conforme/accessibile":    "it/conforme/lineeGuidaDesign",
+	"it/conforme/interoperabile": "it/conforme/modelloInteroperabilita",
+	"it/conforme/sicuro":         "it/conforme/misureMinimeSicurezza",
+	"it/conforme/privacy":        "it/conforme/gdpr",
+	"it/spid":                    "it/piattaforme/spid",
+	"it/pagopa":                  "it/piattaforme/pagopa",
+	"it/cie":                     "it/piattaforme/cie",
+	"it/anpr":                    "it/piattaforme/anpr",
+	"tags":                       "",
+	"intendedAudience/onlyFor":   "",
+	"it/designKit/seo":           "",
+	"it/designKit/ui":            "",
+	"it/designKit/web":           "",
+	"it/designKit/content":       "",
+	"it/ecosistemi":              "",
+}
+
+// featureList is the old name of description/<lang>/features
+var featureList = regexp.MustCompile(`^description/[^/]+/featureList$`)
+
+// RenamedKey tells whether key is deprecated. newKey is its name
+// in the latest publiccodeYmlVersion, empty if it was removed
+func RenamedKey(key string) (newKey string, deprecated bool) {
+	if featureList.MatchString(key) {
+		return strings.TrimSuffix(key, "featureList") + "features", true
+	}
+	newKey, deprecated = deprecatedKeys[key]
+	return newKey, deprecated
+}
+
+// DeprecatedKeys returns the sorted deprecated keys, with *
+// in place of the language of description
+func DeprecatedKeys() []string {
+	keys := []string{"description/*/featureList"}
+	for key := range deprecatedKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// recommendedKeys are not mandatory, but the catalog shows
+// software without them poorly
+var recommendedKeys = []string{"logo", "roadmap"}
+
+// NewWarnings returns the non blocking issues of doc: deprecated keys,
+// missing recommended keys, non HTTPS URLs and over-long descriptions.
+// Warnings are sorted by key, nil if doc is not valid YAML
+func NewWarnings(doc []byte) ValidationErrors {
+	var document map[interface{}]interface{}
+	if err := yamlv2.Unmarshal(doc, &document); err != nil || document == nil {
+		return nil
+	}
+
+	var ws ValidationErrors
+	walk("", document, func(key string, value interface{}) {
+		if newKey, ok := RenamedKey(key); ok {
+			if newKey == "" {
+				ws = append(ws, newWarning(key, CodeDeprecatedKey, "deprecated, removed from the specification"))
+			} else {
+				ws = append(ws, newWarning(key, CodeDeprecatedKey, "deprecated, renamed to %s", newKey))
+			}
+		}
+
+		for _, s := range stringValues(value) {
+			if strings.HasPrefix(strings.ToLower(s), "http://") {
+				w := newWarning(key, CodeInsecureURL, "insecure URL %s, use https", s)
+				w.Value = s
+				ws = append(ws, w)
+			}
+		}
+	})
+
+	for _, key := range recommendedKeys {
+		if _, ok := document[key]; !ok {
+			ws = append(ws, newWarning(key, CodeMissingRecommendedKey, "missing recommended key"))
+		}
+	}
+	if description, ok := document["description"].(map[interface{}]interface{}); ok {
+		for lang, desc := range description {
+			d, ok := desc.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			prefix := fmt.Sprintf("description/%v/", lang)
+			if _, ok := d["screenshots"]; !ok {
+				ws = append(ws, newWarning(prefix+"screenshots", CodeMissingRecommendedKey, "missing recommended key"))
+			}
+			if long, ok := d["longDescription"].(string); ok {
+				if length := utf8.RuneCountInString(long); length > MaxRecommendedLongDescription {
+					ws = append(ws, newWarning(prefix+"longDescription", CodeTooLong,
+						"too long (%d), max %d chars recommended", length, MaxRecommendedLongDescription))
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(ws, func(i, j int) bool { return ws[i].Key < ws[j].Key })
+	for i := range ws {
+		if ws[i].Value == nil && ws[i].Code != CodeMissingRecommendedKey {
+			ws[i].Value = lookup(document, ws[i].Key)
+		}
+	}
+	ws.Locate(doc)
+	return ws
+}
+
+// HasCode reports whether any of es has code
+func (es ValidationErrors) HasCode(code string) bool {
+	for _, e := range es {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutCode returns es without the errors with code
+func (es ValidationErrors) WithoutCode(code string) ValidationErrors {
+	var out ValidationErrors
+	for _, e := range es {
+		if e.Code != code {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Promote returns err with ws added as errors, used in strict mode.
+// Warnings about keys that already have an error are dropped, e.g.
+// legacy keys refused by the strict parser
+func (ws ValidationErrors) Promote(err error) error {
+	var out ValidationErrors
+	switch e := err.(type) {
+	case nil:
+	case ValidationErrors:
+		out = append(out, e...)
+	default:
+		// not a validation error, e.g. invalid YAML
+		return err
+	}
+
+	keys := make(map[string]bool, len(out))
+	for _, e := range out {
+		keys[e.Key] = true
+	}
+	for _, w := range ws {
+		if keys[w.Key] {
+			continue
+		}
+		w.Severity = SeverityError
+		out = append(out, w)
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func newWarning(key string, code string, reason string, args ...interface{}) ErrorInvalidValue {
+	return ErrorInvalidValue{
+		Key:      key,
+		Reason:   fmt.Sprintf(reason, args...),
+		Code:     code,
+		Severity: SeverityWarning,
+		Path:     jsonPointer(key),
+		SpecURL:  specURL(key, code),
+	}
+}
+
+// walk calls fn for every key of m, with keys in the same format
+// used by the parser. Maps in sequences are walked with the key of
+// the sequence
+func walk(prefix string, m map[interface{}]interface{}, fn func(key string, value interface{})) {
+	keys := make([]string, 0, len(m))
+	values := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		key := fmt.Sprintf("%v", k)
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fn(key, values[key])
+		switch v := values[key].(type) {
+		case map[interface{}]interface{}:
+			walk(key, v, fn)
+		case []interface{}:
+			for _, item := range v {
+				if item, ok := item.(map[interface{}]interface{}); ok {
+					walk(key, item, fn)
+				}
+			}
+		}
+	}
+}
+
+// stringValues returns value if it's a string, or its string items
+func stringValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ss []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
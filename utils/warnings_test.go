@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWarnings(t *testing.T) {
+	doc := []byte("publiccode-yaml-version: \"0.1\"\n" +
+		"landingURL: http://example.org\n" +
+		"roadmap: https://example.org/roadmap\n" +
+		"description:\n" +
+		"  en:\n" +
+		"    featureList:\n" +
+		"      - one\n" +
+		"    longDescription: " + strings.Repeat("a", MaxRecommendedLongDescription+1) + "\n" +
+		"it:\n" +
+		"  spid: true\n" +
+		"  designKit:\n" +
+		"    ui: true\n")
+
+	ws := NewWarnings(doc)
+	var got []string
+	for _, w := range ws {
+		assert.Equal(t, SeverityWarning, w.Severity)
+		got = append(got, w.Code+" "+w.Key)
+	}
+	assert.Equal(t, []string{
+		"deprecated-key description/en/featureList",
+		"too-long description/en/longDescription",
+		"missing-recommended-key description/en/screenshots",
+		"deprecated-key it/designKit/ui",
+		"deprecated-key it/spid",
+		"insecure-url landingURL",
+		"missing-recommended-key logo",
+		"deprecated-key publiccode-yaml-version",
+	}, got)
+
+	assert.Equal(t, "deprecated, renamed to description/en/features", ws[0].Reason)
+	assert.Equal(t, "deprecated, renamed to it/piattaforme/spid", ws[4].Reason)
+	assert.Equal(t, "http://example.org", ws[5].Value)
+	assert.Equal(t, Position{Line: 2, Column: 13, EndLine: 2, EndColumn: 31}, ws[5].Position)
+	assert.Nil(t, ws[6].Value)
+
+	assert.Nil(t, NewWarnings([]byte("{")))
+}
+
+func TestPromote(t *testing.T) {
+	ws := ValidationErrors{
+		{Key: "it/spid", Code: CodeDeprecatedKey, Severity: SeverityWarning},
+		{Key: "logo", Code: CodeMissingRecommendedKey, Severity: SeverityWarning},
+	}
+	errs := ValidationErrors{{Key: "it/spid", Code: CodeUnknownKey, Severity: SeverityError}}
+
+	promoted, ok := ws.Promote(errs).(ValidationErrors)
+	if assert.True(t, ok) && assert.Len(t, promoted, 2) {
+		assert.Equal(t, CodeUnknownKey, promoted[0].Code)
+		assert.Equal(t, "logo", promoted[1].Key)
+		assert.Equal(t, SeverityError, promoted[1].Severity)
+	}
+	// warnings are not changed
+	assert.Equal(t, SeverityWarning, ws[1].Severity)
+
+	assert.Nil(t, ValidationErrors(nil).Promote(nil))
+	assert.Len(t, ws.Promote(nil), 2)
+	syntax := assert.AnError
+	assert.Equal(t, syntax, ws.Promote(syntax))
+}
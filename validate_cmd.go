@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/italia/publiccode-validator/apiv1"
+	"github.com/italia/publiccode-validator/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// exit codes of the validate command
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitIOError = 2
+	exitUsage   = 3
+)
+
+// validateResult is the outcome of the validation of a single input
+type validateResult struct {
+	Input  string          `json:"input"`
+	Valid  bool            `json:"valid"`
+	Output json.RawMessage `json:"output"`
+
+	code    int
+	message utils.Message
+	pc      []byte
+}
+
+// validateCommand runs `validate <file|url|->...` using the same
+// parse path of /api/v1/validate and returns the process exit code:
+// 0 if every input is valid, 1 if at least one is invalid or
+// couldn't be converted and 2 if at least one couldn't be read
+func validateCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	noNetwork := flags.Bool("no-network", false, "disable network checks (URL existence, remote files)")
+	strict := flags.Bool("strict", false, "treat warnings as errors")
+	output := flags.String("output", "text", "output format: yaml, json or text")
+	preserve := flags.Bool("preserve", false, "keep comments and order of keys of valid documents in yaml output")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: publiccode-validator validate [flags] <file|url|->...\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	// allow flags after inputs, e.g. validate publiccode.yml --no-network,
+	// up to the -- terminator
+	var inputs []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return exitUsage
+		}
+		if parsed := len(args) - flags.NArg(); parsed > 0 && args[parsed-1] == "--" {
+			inputs = append(inputs, flags.Args()...)
+			break
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		inputs = append(inputs, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(inputs) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *output != "yaml" && *output != "json" && *output != "text" {
+		fmt.Fprintf(stderr, "invalid output format: %s\n", *output)
+		return exitUsage
+	}
+
+	// keep stderr clean, only errors are relevant here
+	log.SetLevel(log.ErrorLevel)
+
+	code := exitValid
+	var results []validateResult
+	for _, input := range inputs {
+		opts := utils.DefaultOptions()
+		opts.DisableNetwork = *noNetwork
+		opts.Strict = *strict
+		opts.Preserve = *preserve
+
+		res := validateInput(input, stdin, opts)
+		if res.code > code {
+			code = res.code
+		}
+		results = append(results, res)
+	}
+
+	switch *output {
+	case "text":
+		printText(stdout, results)
+	case "json":
+		printJSON(stdout, results)
+	case "yaml":
+		printYAML(stdout, results)
+	}
+
+	return code
+}
+
+// validateInput reads and validates a single input, a file path,
+// an http(s) URL or - for standard input
+func validateInput(input string, stdin io.Reader, opts utils.Options) validateResult {
+	res := validateResult{Input: input}
+
+	var body []byte
+	var err error
+	if input == "-" {
+		body, err = ioutil.ReadAll(stdin)
+	} else if u, errURL := url.Parse(input); errURL == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		body, err = utils.FetchRawFile(context.Background(), input)
+	} else {
+		body, err = ioutil.ReadFile(input)
+		opts.LocalBasePath = filepath.Dir(input)
+	}
+	if err != nil {
+		res.code = exitIOError
+		res.message = utils.Message{Status: http.StatusBadRequest, Message: "Error reading input", Error: err.Error()}
+		return res
+	}
+
+	pc, warnings, errParse, errConverting := apiv1.Parse(context.Background(), body, opts)
+	if errConverting != nil {
+		// the input was read, it's the document that can't be validated
+		res.code = exitInvalid
+		res.message = utils.Message{Status: http.StatusBadRequest, Message: "Error converting", Error: errConverting.Error()}
+		return res
+	}
+	if errParse != nil {
+		res.code = exitInvalid
+		res.message = utils.Message{
+			Status:          http.StatusUnprocessableEntity,
+			Message:         "Validation Errors",
+			ValidationError: utils.ErrorsToValidationErrors(errParse),
+			Warnings:        warnings,
+		}
+		if res.message.ValidationError == nil {
+			res.message.Error = errParse.Error()
+		}
+		return res
+	}
+
+	res.Valid = true
+	res.message = utils.Message{Status: http.StatusOK, Message: "Valid", Warnings: warnings}
+	res.pc = pc
+	return res
+}
+
+func printText(w io.Writer, results []validateResult) {
+	for _, res := range results {
+		if res.Valid {
+			fmt.Fprintf(w, "%s: valid\n", res.Input)
+		}
+		if res.message.Error != "" {
+			fmt.Fprintf(w, "%s: %s: %s\n", res.Input, res.message.Message, res.message.Error)
+		}
+		for _, e := range res.message.ValidationError {
+			printTextError(w, res.Input, e, "")
+		}
+		for _, e := range res.message.Warnings {
+			printTextError(w, res.Input, e, "warning: ")
+		}
+	}
+}
+
+func printTextError(w io.Writer, input string, e utils.ErrorInvalidValue, prefix string) {
+	if e.Line > 0 {
+		fmt.Fprintf(w, "%s:%d:%d: %s%s: %s\n", input, e.Line, e.Column, prefix, e.Key, e.Reason)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s%s: %s\n", input, prefix, e.Key, e.Reason)
+}
+
+// printJSON writes the same body of /api/v1/validate for a single
+// input, a list of results otherwise
+func printJSON(w io.Writer, results []validateResult) {
+	for i := range results {
+		if results[i].Valid {
+			results[i].Output = utils.Yaml2json(results[i].pc)
+		} else {
+			results[i].Output, _ = json.Marshal(results[i].message)
+		}
+	}
+	if len(results) == 1 {
+		w.Write(results[0].Output)
+		fmt.Fprintln(w)
+		return
+	}
+	o, _ := json.Marshal(results)
+	w.Write(o)
+	fmt.Fprintln(w)
+}
+
+// printYAML writes the same body of /api/v1/validate for a single
+// input, a stream of documents otherwise
+func printYAML(w io.Writer, results []validateResult) {
+	for i, res := range results {
+		if len(results) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w, "---")
+			}
+			fmt.Fprintf(w, "# %s\n", res.Input)
+		}
+		if res.Valid {
+			w.Write(res.pc)
+			continue
+		}
+		o, _ := yaml.Marshal(res.message)
+		w.Write(o)
+	}
+}